@@ -0,0 +1,470 @@
+package guide
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// apiGuide is the JSON representation of a guide in the /api/v1 API.
+type apiGuide struct {
+	Id           int64   `json:"id"`
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	ForkedFromID int64   `json:"forked_from_id,omitempty"`
+	// DistanceKm is only set on nearby results.
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+}
+
+func newAPIGuide(g guide) apiGuide {
+	return apiGuide{
+		Id:           g.Id,
+		Name:         g.Name,
+		Description:  g.Description,
+		Latitude:     g.Coordinate.Latitude,
+		Longitude:    g.Coordinate.Longitude,
+		ForkedFromID: g.ForkedFromID,
+	}
+}
+
+// apiPoi is the JSON representation of a point of interest in the /api/v1 API.
+type apiPoi struct {
+	Id          int64    `json:"id"`
+	GuideID     int64    `json:"guide_id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Latitude    float64  `json:"latitude"`
+	Longitude   float64  `json:"longitude"`
+	Category    string   `json:"category,omitempty"`
+	DistanceKm  *float64 `json:"distance_km,omitempty"`
+}
+
+func newAPIPoi(p pointOfInterest) apiPoi {
+	return apiPoi{
+		Id:          p.Id,
+		GuideID:     p.GuideID,
+		Name:        p.Name,
+		Description: p.Description,
+		Latitude:    p.Coordinate.Latitude,
+		Longitude:   p.Coordinate.Longitude,
+		Category:    p.Category,
+	}
+}
+
+// apiInput is the request body to create or update guides and pois. Coordinates are pointers
+// so a missing coordinate is reported as empty instead of defaulting to 0. Category only
+// applies to pois.
+type apiInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	Category    string   `json:"category"`
+	// The read-only fields of apiGuide and apiPoi are accepted, and ignored, so a client
+	// can send back an object it received.
+	Id           int64    `json:"id"`
+	GuideID      int64    `json:"guide_id"`
+	ForkedFromID int64    `json:"forked_from_id"`
+	DistanceKm   *float64 `json:"distance_km"`
+}
+
+// coordinates returns the input coordinates as the strings the form validation expects.
+func (in apiInput) coordinates() (latitude, longitude string) {
+	if in.Latitude != nil {
+		latitude = strconv.FormatFloat(*in.Latitude, 'f', -1, 64)
+	}
+	if in.Longitude != nil {
+		longitude = strconv.FormatFloat(*in.Longitude, 'f', -1, 64)
+	}
+	return latitude, longitude
+}
+
+// apiError is the body of every error response of the API. On 422 responses Fields maps input
+// fields to their validation error, and Errors has all of them with their codes.
+type apiError struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"`
+	Errors validationErrors  `json:"errors,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
+
+// writeValidationError responds 422 with the validation errors of err by field.
+func writeValidationError(w http.ResponseWriter, err error) {
+	errs := asValidationErrors(err)
+	if errs == nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, apiError{
+		Error:  "validation failed",
+		Fields: errs.Fields(),
+		Errors: errs,
+	})
+}
+
+func decodeAPIInput(w http.ResponseWriter, r *http.Request) (apiInput, bool) {
+	var in apiInput
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&in)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "not able to parse request body: "+err.Error())
+		return apiInput{}, false
+	}
+	return in, true
+}
+
+// apiID parses the mux variable name or responds 400.
+func apiID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)[name], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("not able to parse %s", name))
+		return 0, false
+	}
+	return id, true
+}
+
+// apiGuideByID loads the guide of the id mux variable or responds with an error.
+func (s *Server) apiGuideByID(w http.ResponseWriter, r *http.Request) (*guide, bool) {
+	id, ok := apiID(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+	g, err := s.store.GetGuidebyID(id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal server error")
+		return nil, false
+	}
+	if g == nil {
+		writeJSONError(w, http.StatusNotFound, "guide not found")
+		return nil, false
+	}
+	return g, true
+}
+
+// apiPoiByID loads the poi of the id and poiID mux variables or responds with an error.
+func (s *Server) apiPoiByID(w http.ResponseWriter, r *http.Request) (*pointOfInterest, bool) {
+	guideID, ok := apiID(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+	poiID, ok := apiID(w, r, "poiID")
+	if !ok {
+		return nil, false
+	}
+	poi, err := s.store.GetPoi(guideID, poiID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal server error")
+		return nil, false
+	}
+	if poi == nil {
+		writeJSONError(w, http.StatusNotFound, "point of interest not found")
+		return nil, false
+	}
+	return poi, true
+}
+
+// nearbyQuery parses the latitude, longitude and optional radius(km) query parameters.
+func nearbyQuery(w http.ResponseWriter, r *http.Request) (coordinate, float64, bool) {
+	query := r.URL.Query()
+	center, err := parseCoordinates(query.Get("latitude"), query.Get("longitude"))
+	if err != nil {
+		writeValidationError(w, err)
+		return coordinate{}, 0, false
+	}
+	radius := defaultNearbyRadiusKm
+	if query.Get("radius") != "" {
+		radius, err = strconv.ParseFloat(query.Get("radius"), 64)
+		if err != nil || radius <= 0 {
+			writeValidationError(w, newValidationError("radius", errRadiusInvalid))
+			return coordinate{}, 0, false
+		}
+	}
+	return center, radius, true
+}
+
+const defaultNearbyRadiusKm = 5.0
+
+func (s *Server) HandleAPIGuides() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guides, err := s.store.Search(r.URL.Query().Get("q"))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		result := make([]apiGuide, 0, len(guides))
+		for _, g := range guides {
+			result = append(result, newAPIGuide(g))
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func (s *Server) HandleAPIGuideCount() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]int{"count": s.store.CountGuides()})
+	}
+}
+
+// HandleAPINearbyGuides returns the guides within radius km of the given coordinate, closest first.
+func (s *Server) HandleAPINearbyGuides() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		center, radius, ok := nearbyQuery(w, r)
+		if !ok {
+			return
+		}
+		result := make([]apiGuide, 0)
+		for _, g := range s.store.GetAllGuides() {
+			d := distance(center, g.Coordinate)
+			if d <= radius {
+				nearby := newAPIGuide(g)
+				nearby.DistanceKm = &d
+				result = append(result, nearby)
+			}
+		}
+		sort.SliceStable(result, func(i, j int) bool { return *result[i].DistanceKm < *result[j].DistanceKm })
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func (s *Server) HandleAPIGuide() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, ok := s.apiGuideByID(w, r)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, newAPIGuide(*g))
+	}
+}
+
+func (s *Server) HandleAPICreateGuide() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		in, ok := decodeAPIInput(w, r)
+		if !ok {
+			return
+		}
+		latitude, longitude := in.coordinates()
+		g, err := NewGuide(in.Name, WithValidStringCoordinates(latitude, longitude), WithDescription(in.Description))
+		if err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		if u := s.currentUser(r); u != nil {
+			g.OwnerID = u.Id
+		}
+		err = s.store.CreateGuide(&g)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/guides/%d", g.Id))
+		writeJSON(w, http.StatusCreated, newAPIGuide(g))
+	}
+}
+
+func (s *Server) HandleAPIUpdateGuide() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, ok := s.apiGuideByID(w, r)
+		if !ok {
+			return
+		}
+		in, ok := decodeAPIInput(w, r)
+		if !ok {
+			return
+		}
+		latitude, longitude := in.coordinates()
+		updated, err := NewGuide(in.Name, WithValidStringCoordinates(latitude, longitude), WithDescription(in.Description))
+		if err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		g.Name = updated.Name
+		g.Description = updated.Description
+		g.Coordinate = updated.Coordinate
+		err = s.store.UpdateGuide(g)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		writeJSON(w, http.StatusOK, newAPIGuide(*g))
+	}
+}
+
+func (s *Server) HandleAPIDeleteGuide() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, ok := s.apiGuideByID(w, r)
+		if !ok {
+			return
+		}
+		err := s.store.DeleteGuide(g.Id)
+		if errors.Is(err, errConflict) {
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) HandleAPIPois() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, ok := s.apiGuideByID(w, r)
+		if !ok {
+			return
+		}
+		pois := s.store.GetAllPois(g.Id)
+		result := make([]apiPoi, 0, len(pois))
+		for _, p := range pois {
+			result = append(result, newAPIPoi(p))
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// HandleAPINearbyPois returns the pois of a guide within radius km of the given coordinate, closest first.
+func (s *Server) HandleAPINearbyPois() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, ok := s.apiGuideByID(w, r)
+		if !ok {
+			return
+		}
+		center, radius, ok := nearbyQuery(w, r)
+		if !ok {
+			return
+		}
+		result := make([]apiPoi, 0)
+		for _, p := range s.store.GetAllPois(g.Id) {
+			d := distance(center, p.Coordinate)
+			if d <= radius {
+				nearby := newAPIPoi(p)
+				nearby.DistanceKm = &d
+				result = append(result, nearby)
+			}
+		}
+		sort.SliceStable(result, func(i, j int) bool { return *result[i].DistanceKm < *result[j].DistanceKm })
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func (s *Server) HandleAPIPoi() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		poi, ok := s.apiPoiByID(w, r)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, newAPIPoi(*poi))
+	}
+}
+
+func (s *Server) HandleAPICreatePoi() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, ok := s.apiGuideByID(w, r)
+		if !ok {
+			return
+		}
+		in, ok := decodeAPIInput(w, r)
+		if !ok {
+			return
+		}
+		latitude, longitude := in.coordinates()
+		poi, err := NewPointOfInterest(in.Name, g.Id, PoiWithValidStringCoordinates(latitude, longitude), PoiWithDescription(in.Description), PoiWithCategory(in.Category))
+		if err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		err = s.store.CreatePoi(&poi)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/guides/%d/pois/%d", g.Id, poi.Id))
+		writeJSON(w, http.StatusCreated, newAPIPoi(poi))
+	}
+}
+
+func (s *Server) HandleAPIUpdatePoi() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		poi, ok := s.apiPoiByID(w, r)
+		if !ok {
+			return
+		}
+		in, ok := decodeAPIInput(w, r)
+		if !ok {
+			return
+		}
+		latitude, longitude := in.coordinates()
+		updated, err := NewPointOfInterest(in.Name, poi.GuideID, PoiWithValidStringCoordinates(latitude, longitude), PoiWithDescription(in.Description), PoiWithCategory(in.Category))
+		if err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		poi.Name = updated.Name
+		poi.Description = updated.Description
+		poi.Coordinate = updated.Coordinate
+		poi.Category = updated.Category
+		err = s.store.UpdatePoi(poi)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		writeJSON(w, http.StatusOK, newAPIPoi(*poi))
+	}
+}
+
+func (s *Server) HandleAPIDeletePoi() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		poi, ok := s.apiPoiByID(w, r)
+		if !ok {
+			return
+		}
+		err := s.store.DeletePoi(poi.GuideID, poi.Id)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// apiRoutes registers the JSON API on router.
+func (s *Server) apiRoutes(router *mux.Router) {
+	router.HandleFunc("/api/openapi.json", s.HandleOpenAPISpec()).Methods(http.MethodGet)
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/guides", s.HandleAPIGuides()).Methods(http.MethodGet)
+	api.HandleFunc("/guides", s.HandleAPICreateGuide()).Methods(http.MethodPost)
+	api.HandleFunc("/guides/count", s.HandleAPIGuideCount()).Methods(http.MethodGet)
+	api.HandleFunc("/guides/nearby", s.HandleAPINearbyGuides()).Methods(http.MethodGet)
+	api.HandleFunc("/guides/{id}", s.HandleAPIGuide()).Methods(http.MethodGet)
+	api.HandleFunc("/guides/{id}", s.HandleAPIUpdateGuide()).Methods(http.MethodPut)
+	api.HandleFunc("/guides/{id}", s.HandleAPIDeleteGuide()).Methods(http.MethodDelete)
+	api.HandleFunc("/guides/{id}/pois", s.HandleAPIPois()).Methods(http.MethodGet)
+	api.HandleFunc("/guides/{id}/pois", s.HandleAPICreatePoi()).Methods(http.MethodPost)
+	api.HandleFunc("/guides/{id}/pois/nearby", s.HandleAPINearbyPois()).Methods(http.MethodGet)
+	api.HandleFunc("/guides/{id}/pois/{poiID}", s.HandleAPIPoi()).Methods(http.MethodGet)
+	api.HandleFunc("/guides/{id}/pois/{poiID}", s.HandleAPIUpdatePoi()).Methods(http.MethodPut)
+	api.HandleFunc("/guides/{id}/pois/{poiID}", s.HandleAPIDeletePoi()).Methods(http.MethodDelete)
+	api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusNotFound, "not found")
+	})
+	api.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
+}
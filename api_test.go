@@ -0,0 +1,219 @@
+package guide_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIRoutes(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		path               string
+		httpMethod         string
+		body               string
+		expectedStatusCode int
+	}{
+		{"/api/v1/guides", http.MethodGet, "", http.StatusOK},
+		{"/api/v1/guides?q=non-existent", http.MethodGet, "", http.StatusOK},
+		{"/api/v1/guides/count", http.MethodGet, "", http.StatusOK},
+		{"/api/v1/guides/nearby?latitude=10&longitude=10", http.MethodGet, "", http.StatusOK},
+		{"/api/v1/guides/nearby?latitude=10", http.MethodGet, "", http.StatusUnprocessableEntity},
+		{"/api/v1/guides/nearby?latitude=10&longitude=10&radius=-1", http.MethodGet, "", http.StatusUnprocessableEntity},
+		{"/api/v1/guides/1", http.MethodGet, "", http.StatusOK},
+		{"/api/v1/guides/42", http.MethodGet, "", http.StatusNotFound},
+		{"/api/v1/guides/blah", http.MethodGet, "", http.StatusBadRequest},
+		{"/api/v1/guides", http.MethodPost, `{"name":"Oaxaca","latitude":17.06,"longitude":-96.72}`, http.StatusCreated},
+		{"/api/v1/guides", http.MethodPost, `{"name":"Oaxaca"`, http.StatusBadRequest},
+		{"/api/v1/guides", http.MethodPost, `{"name":"Oaxaca","unknown":1}`, http.StatusBadRequest},
+		{"/api/v1/guides", http.MethodPost, `{"name":"","latitude":17.06,"longitude":-96.72}`, http.StatusUnprocessableEntity},
+		{"/api/v1/guides/2", http.MethodPut, `{"name":"renamed","latitude":10,"longitude":10}`, http.StatusOK},
+		{"/api/v1/guides/42", http.MethodPut, `{"name":"renamed","latitude":10,"longitude":10}`, http.StatusNotFound},
+		{"/api/v1/guides/3", http.MethodDelete, "", http.StatusConflict}, //has pois
+		{"/api/v1/guides/42", http.MethodDelete, "", http.StatusNotFound},
+		{"/api/v1/guides/1/pois", http.MethodGet, "", http.StatusOK},
+		{"/api/v1/guides/42/pois", http.MethodGet, "", http.StatusNotFound},
+		{"/api/v1/guides/1/pois/nearby?latitude=10&longitude=10&radius=1", http.MethodGet, "", http.StatusOK},
+		{"/api/v1/guides/1/pois/1", http.MethodGet, "", http.StatusOK},
+		{"/api/v1/guides/1/pois/42", http.MethodGet, "", http.StatusNotFound},
+		{"/api/v1/guides/2/pois/1", http.MethodGet, "", http.StatusNotFound},
+		{"/api/v1/guides/1/pois", http.MethodPost, `{"name":"Mercado","latitude":17.06,"longitude":-96.72}`, http.StatusCreated},
+		{"/api/v1/guides/42/pois", http.MethodPost, `{"name":"Mercado","latitude":17.06,"longitude":-96.72}`, http.StatusNotFound},
+		{"/api/v1/guides/1/pois", http.MethodPost, `{"name":"Mercado","latitude":91,"longitude":-96.72}`, http.StatusUnprocessableEntity},
+		{"/api/v1/guides/1/pois/2", http.MethodPut, `{"name":"renamed","latitude":10,"longitude":10}`, http.StatusOK},
+		{"/api/v1/guides/1/pois/2", http.MethodDelete, "", http.StatusNoContent},
+		{"/api/v1/guides/1/pois/1", http.MethodPut, `{"id":1,"guide_id":1,"name":"Mercado","description":"","latitude":10,"longitude":10,"category":"market"}`, http.StatusOK},
+		{"/api/v1/unknown", http.MethodGet, "", http.StatusNotFound},
+		{"/api/v1/guides/count", http.MethodPost, "", http.StatusMethodNotAllowed},
+	}
+	server := newProvisionedServer(t)
+	ts := httptest.NewServer(server.Routes())
+	defer ts.Close()
+
+	client := ts.Client()
+	for _, tc := range testCases {
+		req, err := http.NewRequest(tc.httpMethod, ts.URL+tc.path, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != tc.expectedStatusCode {
+			t.Errorf("for %s %s want status %d, got %d", tc.httpMethod, tc.path, tc.expectedStatusCode, res.StatusCode)
+		}
+		if res.StatusCode != http.StatusNoContent && res.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("for %s %s want JSON response, got %s", tc.httpMethod, tc.path, res.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestAPIUpdatePoiKeepsCategory(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guides/1/pois/1", nil)
+	server.Routes().ServeHTTP(rec, req)
+	var poi map[string]any
+	err := json.NewDecoder(rec.Result().Body).Decode(&poi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	poi["category"] = "market"
+	body, err := json.Marshal(poi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/guides/1/pois/1", strings.NewReader(string(body)))
+	server.Routes().ServeHTTP(rec, req)
+	res := rec.Result()
+	if res.StatusCode != http.StatusOK {
+		got, _ := io.ReadAll(res.Body)
+		t.Fatalf("want status %d sending back the poi received, got %d: %s", http.StatusOK, res.StatusCode, got)
+	}
+	var updated map[string]any
+	err = json.NewDecoder(res.Body).Decode(&updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated["category"] != "market" {
+		t.Errorf("want category market, got %v", updated["category"])
+	}
+}
+
+func TestAPICreateGuideReturnsLocation(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	rec := httptest.NewRecorder()
+	body := strings.NewReader(`{"name":"Oaxaca","description":"mole","latitude":17.06,"longitude":-96.72}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/guides", body)
+	server.Routes().ServeHTTP(rec, req)
+
+	res := rec.Result()
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("want status 201 Created, got %d", res.StatusCode)
+	}
+	want := "/api/v1/guides/4"
+	if res.Header.Get("Location") != want {
+		t.Errorf("want Location %s, got %s", want, res.Header.Get("Location"))
+	}
+
+	var got struct {
+		Id          int64
+		Name        string
+		Description string
+		Latitude    float64
+	}
+	err := json.NewDecoder(res.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != 4 || got.Name != "Oaxaca" || got.Description != "mole" || got.Latitude != 17.06 {
+		t.Errorf("want created guide in body, got %+v", got)
+	}
+}
+
+func TestAPIValidationErrorsHaveFields(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		body  string
+		field string
+		want  string
+	}{
+		{`{"name":"","latitude":10,"longitude":10}`, "name", "name cannot be empty"},
+		{`{"name":"test","longitude":10}`, "latitude", "latitude cannot be empty"},
+		{`{"name":"test","latitude":10}`, "longitude", "longitude cannot be empty"},
+		{`{"name":"test","latitude":-91,"longitude":10}`, "latitude", "latitude has to be in the -90°, 90° range"},
+	}
+	server := newProvisionedServer(t)
+	handler := server.HandleAPICreateGuide()
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/guides", strings.NewReader(tc.body))
+		handler(rec, req)
+
+		res := rec.Result()
+		if res.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 Unprocessable Entity, got %d", res.StatusCode)
+		}
+		var got struct {
+			Error  string
+			Fields map[string]string
+		}
+		err := json.NewDecoder(res.Body).Decode(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got.Fields[tc.field], tc.want) {
+			t.Errorf("want field %s error to contain %s, got %v", tc.field, tc.want, got.Fields)
+		}
+	}
+}
+
+func TestAPINearbyGuidesSortedByDistance(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	for _, body := range []string{
+		`{"name":"far","latitude":10.04,"longitude":10}`,
+		`{"name":"near","latitude":10.01,"longitude":10}`,
+		`{"name":"out of range","latitude":11,"longitude":10}`,
+	} {
+		rec := httptest.NewRecorder()
+		server.HandleAPICreateGuide()(rec, httptest.NewRequest(http.MethodPost, "/api/v1/guides", strings.NewReader(body)))
+		if rec.Result().StatusCode != http.StatusCreated {
+			t.Fatalf("want status 201 Created, got %d", rec.Result().StatusCode)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guides/nearby?latitude=10.02&longitude=10&radius=5", nil)
+	server.HandleAPINearbyGuides()(rec, req)
+
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []struct {
+		Name       string
+		DistanceKm float64 `json:"distance_km"`
+	}
+	err = json.Unmarshal(body, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, g := range got {
+		names = append(names, g.Name)
+	}
+	want := "near,far,test 1,guide 1,test 2"
+	if strings.Join(names, ",") != want {
+		t.Errorf("want nearby guides %s, got %s", want, strings.Join(names, ","))
+	}
+}
@@ -0,0 +1,247 @@
+package guide
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//go:generate go run ./cmd/vendorassets static
+
+// staticFS has the vendored frontend assets and assetManifestFile, which lists them. Both are
+// written by VendorAssets, run it with go generate to update the assets.
+//
+//go:embed static
+var staticFS embed.FS
+
+const (
+	staticDir         = "static"
+	assetManifestFile = "assets.json"
+)
+
+// frontendAsset is a third-party file the pages load.
+type frontendAsset struct {
+	// Name is how templates refer to the asset, {{asset "htmx.js"}}.
+	Name   string
+	Source string
+	// Integrity pins the source, when known, so downloads are checked against it.
+	Integrity string
+	// Fixed assets keep their name because other assets refer to it, like the marker images of the
+	// Leaflet CSS. They are cached for a day instead of forever.
+	Fixed bool
+}
+
+var frontendAssets = []frontendAsset{
+	{Name: "leaflet.js", Source: "https://unpkg.com/leaflet@1.8.0/dist/leaflet.js", Integrity: "sha512-BB3hKbKWOc9Ez/TAwyWxNXeoV9c1v6FIeYiBieIWkpLjauysF18NzgR1MBNBXf8/KABdlkX68nAhlwcDFLGPCQ=="},
+	{Name: "leaflet.css", Source: "https://unpkg.com/leaflet@1.8.0/dist/leaflet.css", Integrity: "sha512-hoalWLoI8r4UszCkZ5kL8vayOGVae1oxXe/2A4AO6J9+580uKHDO3JdHb7NzwwzK5xr/Fs0W40kiNHxM9vyTtQ=="},
+	{Name: "htmx.js", Source: "https://unpkg.com/htmx.org@1.9.4/dist/htmx.min.js"},
+	{Name: "sortable.js", Source: "https://cdn.jsdelivr.net/npm/sortablejs@1.15.0/Sortable.min.js"},
+	{Name: "bulma.css", Source: "https://cdn.jsdelivr.net/npm/bulma@0.9.4/css/bulma.min.css"},
+	{Name: "images/marker-icon.png", Source: "https://unpkg.com/leaflet@1.8.0/dist/images/marker-icon.png", Fixed: true},
+	{Name: "images/marker-icon-2x.png", Source: "https://unpkg.com/leaflet@1.8.0/dist/images/marker-icon-2x.png", Fixed: true},
+	{Name: "images/marker-shadow.png", Source: "https://unpkg.com/leaflet@1.8.0/dist/images/marker-shadow.png", Fixed: true},
+	{Name: "images/layers.png", Source: "https://unpkg.com/leaflet@1.8.0/dist/images/layers.png", Fixed: true},
+	{Name: "images/layers-2x.png", Source: "https://unpkg.com/leaflet@1.8.0/dist/images/layers-2x.png", Fixed: true},
+}
+
+// vendoredAsset is an asset in staticFS, with its subresource integrity computed when it was vendored.
+type vendoredAsset struct {
+	File      string `json:"file"`
+	Integrity string `json:"integrity"`
+	Fixed     bool   `json:"fixed,omitempty"`
+}
+
+// assetManifest maps asset names to their vendored files.
+type assetManifest map[string]vendoredAsset
+
+var vendoredAssets = mustLoadAssetManifest()
+
+func mustLoadAssetManifest() assetManifest {
+	data, err := staticFS.ReadFile(path.Join(staticDir, assetManifestFile))
+	if err != nil {
+		panic(err)
+	}
+	manifest := assetManifest{}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		panic(fmt.Sprintf("not able to parse %s: %v", assetManifestFile, err))
+	}
+	return manifest
+}
+
+// assetLink is how a page loads an asset.
+type assetLink struct {
+	URL       string
+	Integrity string
+}
+
+// assetURL links to the vendored asset name, or to its source for assets that aren't vendored yet,
+// like a new asset before go generate runs. Only development uses the sources: the server and the
+// static export refuse to run until every asset is vendored, see checkAssetsVendored.
+func assetURL(name string) (assetLink, error) {
+	if a, ok := vendoredAssets[name]; ok {
+		return assetLink{URL: "/static/" + a.File, Integrity: a.Integrity}, nil
+	}
+	for _, a := range frontendAssets {
+		if a.Name == name {
+			return assetLink{URL: a.Source, Integrity: a.Integrity}, nil
+		}
+	}
+	return assetLink{}, fmt.Errorf("unknown asset %s", name)
+}
+
+// checkAssetsVendored fails when an asset isn't in the manifest, so pages never load it from its
+// source in production.
+func checkAssetsVendored() error {
+	missing := make([]string, 0)
+	for _, a := range frontendAssets {
+		if _, ok := vendoredAssets[a.Name]; !ok {
+			missing = append(missing, a.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("frontend assets %s are not vendored, run go generate ./...", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// HandleStatic serves the vendored assets. Their names have the hash of their content so they are
+// cached forever, a new version has a new name.
+func HandleStatic() http.HandlerFunc {
+	files := map[string]vendoredAsset{}
+	for _, a := range vendoredAssets {
+		files[a.File] = a
+	}
+	// the URL path /static/ is the directory of the embedded files
+	fileServer := http.FileServer(http.FS(staticFS))
+	return func(w http.ResponseWriter, r *http.Request) {
+		a, ok := files[strings.TrimPrefix(r.URL.Path, "/static/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if a.Fixed {
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		fileServer.ServeHTTP(w, r)
+	}
+}
+
+// VendorAssets downloads the frontend assets with get into dir, under names with the hash of their
+// content, and writes their manifest with their subresource integrity. Downloads of pinned assets
+// have to match the pin. Files of assets that are no longer used are removed.
+func VendorAssets(dir string, get func(url string) ([]byte, error)) error {
+	manifest := assetManifest{}
+	for _, a := range frontendAssets {
+		data, err := get(a.Source)
+		if err != nil {
+			return fmt.Errorf("not able to download %s: %w", a.Name, err)
+		}
+		if a.Integrity != "" {
+			algorithm, _, _ := strings.Cut(a.Integrity, "-")
+			got, err := subresourceIntegrity(algorithm, data)
+			if err != nil {
+				return err
+			}
+			if got != a.Integrity {
+				return fmt.Errorf("%s doesn't match its integrity %s, got %s", a.Source, a.Integrity, got)
+			}
+		}
+		integrity, err := subresourceIntegrity("sha384", data)
+		if err != nil {
+			return err
+		}
+		file := a.Name
+		if !a.Fixed {
+			sum := sha256.Sum256(data)
+			ext := path.Ext(a.Name)
+			file = strings.TrimSuffix(a.Name, ext) + "." + hex.EncodeToString(sum[:5]) + ext
+		}
+		filename := filepath.Join(dir, filepath.FromSlash(file))
+		err = os.MkdirAll(filepath.Dir(filename), 0o755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filename, data, 0o644)
+		if err != nil {
+			return err
+		}
+		manifest[a.Name] = vendoredAsset{File: file, Integrity: integrity, Fixed: a.Fixed}
+	}
+
+	used := map[string]bool{assetManifestFile: true}
+	for _, a := range manifest {
+		used[a.File] = true
+	}
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if used[filepath.ToSlash(rel)] {
+			return nil
+		}
+		return os.Remove(p)
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, assetManifestFile), append(data, '\n'), 0o644)
+}
+
+// subresourceIntegrity is the integrity attribute value of data, e.g. "sha384-<base64 digest>".
+func subresourceIntegrity(algorithm string, data []byte) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", errors.New("unsupported integrity algorithm " + algorithm)
+	}
+	h.Write(data)
+	return algorithm + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyVendoredAssets copies the vendored assets into dir, for sites served without the server.
+func copyVendoredAssets(dir string) error {
+	for _, a := range vendoredAssets {
+		data, err := staticFS.ReadFile(path.Join(staticDir, a.File))
+		if err != nil {
+			return err
+		}
+		err = writeStaticFile(dir, path.Join(staticDir, a.File), func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package guide_test
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"guide"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var rxAssetTag = regexp.MustCompile(`<(?:script src|link rel="stylesheet" href)="([^"]+)"(?: integrity="([^"]+)")?`)
+
+func TestPagesLoadAssetsWithIntegrity(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/guide/1", nil))
+	tags := rxAssetTag.FindAllStringSubmatch(rr.Body.String(), -1)
+	if len(tags) != 5 {
+		t.Fatalf("want leaflet, htmx, sortable, bulma and leaflet styles loaded, got %d assets", len(tags))
+	}
+	for _, tag := range tags {
+		url, integrity := tag[1], tag[2]
+		if !strings.HasPrefix(url, "/static/") {
+			// not vendored yet, the server refuses to start until it is
+			continue
+		}
+		if integrity == "" {
+			t.Errorf("want integrity for %s", url)
+			continue
+		}
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: want status %d, got %d", url, http.StatusOK, rr.Code)
+			continue
+		}
+		if !strings.Contains(rr.Header().Get("Cache-Control"), "immutable") {
+			t.Errorf("%s: want immutable cache, got %q", url, rr.Header().Get("Cache-Control"))
+		}
+		sum := sha512.Sum384(rr.Body.Bytes())
+		if got := "sha384-" + base64.StdEncoding.EncodeToString(sum[:]); got != integrity {
+			t.Errorf("%s: want integrity %s, got %s", url, integrity, got)
+		}
+	}
+}
+
+func TestHandleStaticServesOnlyVendoredAssets(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	for _, path := range []string{"/static/", "/static/assets.json", "/static/htmx.js", "/static/../server.go"} {
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusNotFound && rr.Code != http.StatusMovedPermanently {
+			t.Errorf("%s: want not found, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestVendorAssetsRejectsDownloadsNotMatchingTheirPin(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "assets.json"), []byte("{}\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guide.VendorAssets(dir, func(url string) ([]byte, error) {
+		return []byte("alert('tampered')"), nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "doesn't match its integrity") {
+		t.Errorf("want integrity error, got %v", err)
+	}
+	manifest, err := os.ReadFile(filepath.Join(dir, "assets.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(manifest) != "{}\n" {
+		t.Errorf("want manifest untouched, got %s", manifest)
+	}
+}
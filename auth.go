@@ -2,8 +2,8 @@ package guide
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"golang.org/x/crypto/argon2"
 	"regexp"
@@ -12,27 +12,31 @@ import (
 type user struct {
 	Id                        int64
 	Username, Password, Email string
+	// Admin allows the user to use the admin endpoints, like downloading backups. Only the
+	// grant-admin command sets it, signing up never does.
+	Admin bool
 }
 
 func newUser(username, password, confirmPassword, email string) (user, error) {
+	var errs validationErrors
 	if username == "" {
-		return user{}, errors.New("username cannot be empty")
+		errs.collect(newValidationError("username", errUsernameEmpty))
 	}
 	if password == "" {
-		return user{}, errors.New("password cannot be empty")
-	}
-	if len(password) < 8 {
-		return user{}, errors.New("password has to be at least 8 characters long")
+		errs.collect(newValidationError("password", errPasswordEmpty))
+	} else if len(password) < 8 {
+		errs.collect(newValidationError("password", errPasswordTooShort))
 	}
 	if password != confirmPassword {
-		return user{}, errors.New("passwords do not match")
+		errs.collect(newValidationError("confirm-password", errPasswordsDoNotMatch))
 	}
 	if email == "" {
-		return user{}, errors.New("email cannot be empty")
+		errs.collect(newValidationError("email", errEmailEmpty))
+	} else if !rxEmail.MatchString(email) {
+		errs.collect(newValidationError("email", errEmailInvalid))
 	}
-	match := rxEmail.Match([]byte(email))
-	if !match {
-		return user{}, errors.New("email has to be a valid address")
+	if err := errs.err(); err != nil {
+		return user{}, err
 	}
 
 	salt, err := generateSalt(saltSize)
@@ -60,6 +64,30 @@ func generateSalt(size int) ([]byte, error) {
 	return b, nil
 }
 
+// verifyPassword checks password against the salt and hash encoded by newUser.
+func verifyPassword(encodedHash, password string) bool {
+	saltLen := base64.RawStdEncoding.EncodedLen(saltSize)
+	if len(encodedHash) <= saltLen {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(encodedHash[:saltLen])
+	if err != nil {
+		return false
+	}
+	hashedPassword := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	encodedPassword := base64.RawStdEncoding.EncodeToString(hashedPassword)
+	return subtle.ConstantTimeCompare([]byte(encodedPassword), []byte(encodedHash[saltLen:])) == 1
+}
+
+// newSessionToken returns a random token to identify a logged-in user's session cookie.
+func newSessionToken() (string, error) {
+	b, err := generateSalt(sessionTokenSize)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 var rxEmail = regexp.MustCompile(".+@.+\\..+")
 
 const (
@@ -68,4 +96,7 @@ const (
 	argon2Threads = 24
 	argon2KeyLen  = 32
 	saltSize      = 16
+
+	sessionTokenSize  = 32
+	sessionCookieName = "session"
 )
@@ -0,0 +1,291 @@
+package guide
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	databaseFile = "city_guide.db"
+	// mediaArchiveDir is the directory of the media files in backup archives.
+	mediaArchiveDir = "media/"
+)
+
+// createBackup writes a consistent snapshot of the store to output while the store is in use.
+// Without a mediaDir the backup is the SQLite database itself, with it the backup is a tar.gz
+// archive of the database and the media files.
+func createBackup(store Storage, output, mediaDir string) error {
+	_, err := os.Stat(output)
+	if err == nil {
+		return fmt.Errorf("backup %s already exists", output)
+	}
+	if mediaDir == "" {
+		return store.Backup(output)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "cityguide-backup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	snapshot := filepath.Join(tmpDir, databaseFile)
+	err = store.Backup(snapshot)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	err = writeBackupArchive(f, snapshot, mediaDir)
+	if err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+	return f.Close()
+}
+
+// writeBackupArchive writes a tar.gz archive of the database snapshot and the files of mediaDir.
+func writeBackupArchive(w io.Writer, snapshot, mediaDir string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := addArchiveFile(tw, snapshot, databaseFile)
+	if err != nil {
+		return err
+	}
+	err = filepath.WalkDir(mediaDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(mediaDir, p)
+		if err != nil {
+			return err
+		}
+		return addArchiveFile(tw, p, mediaArchiveDir+filepath.ToSlash(rel))
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func addArchiveFile(tw *tar.Writer, filename, name string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	err = tw.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// restoreBackup replaces the database at dbPath with the backup at input, a database or an
+// archive made by createBackup. The media files of archives are restored into mediaDir, if any.
+// The server must not be running, the backup is validated before anything is replaced.
+func restoreBackup(input, dbPath, mediaDir string) error {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dbPath), ".restore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot := input
+	isArchive, err := isGzipFile(input)
+	if err != nil {
+		return err
+	}
+	if isArchive {
+		err = extractBackupArchive(input, tmpDir)
+		if err != nil {
+			return err
+		}
+		snapshot = filepath.Join(tmpDir, databaseFile)
+	}
+	err = validateBackup(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// copy next to the database so the final rename doesn't cross file systems
+	restored := filepath.Join(tmpDir, "restored.db")
+	err = copyFile(snapshot, restored)
+	if err != nil {
+		return err
+	}
+	for _, stale := range []string{dbPath + "-wal", dbPath + "-shm"} {
+		err = os.Remove(stale)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	err = os.Rename(restored, dbPath)
+	if err != nil {
+		return err
+	}
+
+	media := filepath.Join(tmpDir, mediaArchiveDir)
+	if mediaDir == "" {
+		return nil
+	}
+	if _, err = os.Stat(media); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return filepath.WalkDir(media, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(media, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(mediaDir, rel)
+		err = os.MkdirAll(filepath.Dir(target), 0o755)
+		if err != nil {
+			return err
+		}
+		return copyFile(p, target)
+	})
+}
+
+// validateBackup checks backup is an intact city guide database whose schema version this
+// version can migrate, that is, not from a newer version.
+func validateBackup(backup string) error {
+	_, err := os.Stat(backup)
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite", "file:"+backup+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var check string
+	err = db.QueryRow(pragmaQuickCheck).Scan(&check)
+	if err != nil {
+		return fmt.Errorf("backup is not a SQLite database: %w", err)
+	}
+	if check != "ok" {
+		return fmt.Errorf("backup is corrupted: %s", check)
+	}
+	var tables int
+	err = db.QueryRow(countGuideTables).Scan(&tables)
+	if err != nil {
+		return err
+	}
+	if tables == 0 {
+		return errors.New("backup is not a city guide database")
+	}
+	var version int
+	err = db.QueryRow(pragmaUserVersion).Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("backup schema version %d is newer than the supported version %d, upgrade first", version, len(migrations))
+	}
+	return nil
+}
+
+func isGzipFile(filename string) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic, err := bufio.NewReader(f).Peek(2)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return bytes.Equal(magic, []byte{0x1f, 0x8b}), nil
+}
+
+// extractBackupArchive extracts the database and media files of an archive into dir.
+func extractBackupArchive(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("not able to read backup archive: %w", err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("not able to read backup archive: %w", err)
+		}
+		name := path.Clean(header.Name)
+		if header.Typeflag != tar.TypeReg || (name != databaseFile && !strings.HasPrefix(name, mediaArchiveDir)) || !filepath.IsLocal(name) {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(target), 0o700)
+		if err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
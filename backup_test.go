@@ -0,0 +1,257 @@
+package guide_test
+
+import (
+	"bytes"
+	"database/sql"
+	"guide"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openDBPathStorage opens the database the commands use, in a temporary DB_PATH.
+func openDBPathStorage(t *testing.T) (guide.Storage, string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("DB_PATH", dir)
+	storage, err := guide.OpenSQLiteStorage(filepath.Join(dir, "city_guide.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage, filepath.Join(dir, "city_guide.db")
+}
+
+func createTestGuide(t *testing.T, storage guide.Storage, name string) {
+	t.Helper()
+	g, err := guide.NewGuide(name, guide.WithValidStringCoordinates("10", "10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.CreateGuide(&g)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunCommandBackupAndRestore(t *testing.T) {
+	storage, dbPath := openDBPathStorage(t)
+	createTestGuide(t, storage, "Oaxaca")
+	backup := filepath.Join(t.TempDir(), "backup.db")
+
+	err := guide.RunCommand([]string{"backup", backup}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guide.RunCommand([]string{"backup", backup}, io.Discard)
+	if err == nil {
+		t.Error("want error backing up over an existing file")
+	}
+	createTestGuide(t, storage, "after the backup")
+
+	err = guide.RunCommand([]string{"restore", backup}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := guide.OpenSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.CountGuides() != 1 {
+		t.Errorf("want 1 guide restored, got %d", restored.CountGuides())
+	}
+}
+
+func TestRunCommandBackupAndRestoreWithMedia(t *testing.T) {
+	storage, dbPath := openDBPathStorage(t)
+	createTestGuide(t, storage, "Oaxaca")
+	media := t.TempDir()
+	err := os.MkdirAll(filepath.Join(media, "guides"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(media, "guides", "cover.jpg"), []byte("cover"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	err = guide.RunCommand([]string{"backup", "-media", media, backup}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredMedia := t.TempDir()
+	err = guide.RunCommand([]string{"restore", "-media", restoredMedia, backup}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cover, err := os.ReadFile(filepath.Join(restoredMedia, "guides", "cover.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cover) != "cover" {
+		t.Errorf("want media restored, got %q", cover)
+	}
+	restored, err := guide.OpenSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.CountGuides() != 1 {
+		t.Errorf("want 1 guide restored, got %d", restored.CountGuides())
+	}
+}
+
+func TestRunCommandRestoreRejectsInvalidBackups(t *testing.T) {
+	storage, dbPath := openDBPathStorage(t)
+	createTestGuide(t, storage, "Oaxaca")
+	dir := t.TempDir()
+
+	notADatabase := filepath.Join(dir, "notes.txt")
+	err := os.WriteFile(notADatabase, []byte("not a database"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newerVersion := filepath.Join(dir, "newer.db")
+	_, err = guide.OpenSQLiteStorage(newerVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", newerVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("PRAGMA user_version = 999")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherDatabase := filepath.Join(dir, "other.db")
+	db, err = sql.Open("sqlite", otherDatabase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE notes (text TEXT)")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]string{
+		notADatabase:                     "not a SQLite database",
+		newerVersion:                     "newer than the supported version",
+		otherDatabase:                    "not a city guide database",
+		filepath.Join(dir, "missing.db"): "no such file",
+	}
+	for backup, want := range testCases {
+		err = guide.RunCommand([]string{"restore", backup}, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: want error containing %q, got %v", filepath.Base(backup), want, err)
+		}
+	}
+	current, err := guide.OpenSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.CountGuides() != 1 {
+		t.Errorf("want database untouched, got %d guides", current.CountGuides())
+	}
+}
+
+func TestRunCommandUsageErrors(t *testing.T) {
+	t.Parallel()
+	for _, args := range [][]string{{"bogus"}, {"backup"}, {"restore", "a.db", "b.db"}} {
+		err := guide.RunCommand(args, io.Discard)
+		if err == nil {
+			t.Errorf("%v: want usage error", args)
+		}
+	}
+}
+
+func TestHandleAdminBackup(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	server, err := guide.NewServer(":8080", storage, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTestGuide(t, storage, "Oaxaca")
+	adminCookie := newSessionCookie(t, &server, "admin")
+	req := httptest.NewRequest(http.MethodGet, "/admin/backup", nil)
+	req.AddCookie(adminCookie)
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("want signing up as admin to be forbidden until granted, got status %d", rr.Code)
+	}
+	err = storage.SetUserAdmin("admin", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		cookie *http.Cookie
+		want   int
+	}{
+		"anonymous": {want: http.StatusUnauthorized},
+		"user":      {cookie: newSessionCookie(t, &server, "traveler"), want: http.StatusForbidden},
+		"admin":     {cookie: adminCookie, want: http.StatusOK},
+	}
+	for name, tc := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/admin/backup", nil)
+		if tc.cookie != nil {
+			req.AddCookie(tc.cookie)
+		}
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("%s: want status %d, got %d", name, tc.want, rr.Code)
+			continue
+		}
+		if tc.want != http.StatusOK {
+			continue
+		}
+		if !bytes.HasPrefix(rr.Body.Bytes(), []byte("SQLite format 3\x00")) {
+			t.Errorf("want a SQLite database, got %q", rr.Body.String()[:16])
+		}
+		if !strings.HasPrefix(rr.Header().Get("Content-Disposition"), `attachment; filename="city_guide-`) {
+			t.Errorf("want backup downloaded as an attachment, got %q", rr.Header().Get("Content-Disposition"))
+		}
+	}
+}
+
+func TestRunCommandGrantAndRevokeAdmin(t *testing.T) {
+	storage, _ := openDBPathStorage(t)
+	server, err := guide.NewServer(":8080", storage, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := newSessionCookie(t, &server, "admin")
+	status := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/backup", nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	err = guide.RunCommand([]string{"grant-admin", "nobody"}, io.Discard)
+	if err == nil {
+		t.Error("want error granting admin rights to a user not signed up")
+	}
+	err = guide.RunCommand([]string{"grant-admin", "admin"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != http.StatusOK {
+		t.Errorf("want status 200 after granting admin rights, got %d", got)
+	}
+	err = guide.RunCommand([]string{"revoke-admin", "admin"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != http.StatusForbidden {
+		t.Errorf("want status 403 after revoking admin rights, got %d", got)
+	}
+}
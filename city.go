@@ -0,0 +1,237 @@
+package guide
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// city is a place that guides cover. A guide belongs to at most one city, the one whose bounds
+// contain it when it's suggested.
+type city struct {
+	Id       int64
+	Name     string
+	Country  string
+	Timezone string
+	// Slug names the city in its URL, e.g. "oaxaca-de-juarez".
+	Slug   string
+	Center coordinate
+	Bounds boundingBox
+
+	// GuideCount and Guides are set by the queries that list them.
+	GuideCount int
+	Guides     []guide
+}
+
+// boundingBox is the area between two parallels and two meridians.
+type boundingBox struct {
+	South, West, North, East float64
+}
+
+// Contains reports whether c is inside the box, edges included.
+func (b boundingBox) Contains(c coordinate) bool {
+	return c.Latitude >= b.South && c.Latitude <= b.North && c.Longitude >= b.West && c.Longitude <= b.East
+}
+
+// defaultCityRadiusKm is how far the bounds of a city extend from its center when they aren't given.
+const defaultCityRadiusKm = 15
+
+// Location is the time zone of the city, UTC if it isn't valid.
+func (c city) Location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// LocalTime is the current time in the city, e.g. "Mon 15:04 CST".
+func (c city) LocalTime() string {
+	return time.Now().In(c.Location()).Format("Mon 15:04 MST")
+}
+
+type cityOption func(*city) error
+
+// CityWithValidStringCenter sets the center of the city, where its map opens.
+func CityWithValidStringCenter(latitude, longitude string) cityOption {
+	return func(c *city) error {
+		center, err := parseCoordinates(latitude, longitude)
+		if err != nil {
+			return err
+		}
+		c.Center = center
+		return nil
+	}
+}
+
+// CityWithBounds sets the area of the city, guides in it are suggested the city. Empty bounds are
+// left to the default around the center.
+func CityWithBounds(south, west, north, east string) cityOption {
+	return func(c *city) error {
+		if south == "" && west == "" && north == "" && east == "" {
+			return nil
+		}
+		var errs validationErrors
+		sw, err := parseCoordinates(south, west)
+		errs.collect(cornerError(err, "south", "west"))
+		ne, err := parseCoordinates(north, east)
+		errs.collect(cornerError(err, "north", "east"))
+		if err := errs.err(); err != nil {
+			return err
+		}
+		if sw.Latitude >= ne.Latitude || sw.Longitude >= ne.Longitude {
+			return newValidationError("", errBoundsInverted)
+		}
+		c.Bounds = boundingBox{South: sw.Latitude, West: sw.Longitude, North: ne.Latitude, East: ne.Longitude}
+		return nil
+	}
+}
+
+func NewCity(name, country, timezone string, opts ...cityOption) (city, error) {
+	var errs validationErrors
+	name = strings.TrimSpace(name)
+	if name == "" {
+		errs.collect(newValidationError("name", errCityNameEmpty))
+	} else if slugify(name) == "" {
+		errs.collect(newValidationError("name", errCityNameNoLetter))
+	}
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if len(country) != 2 {
+		errs.collect(newValidationError("country", errCountryInvalid))
+	}
+	if timezone == "" {
+		errs.collect(newValidationError("timezone", errTimezoneEmpty))
+	} else if _, err := time.LoadLocation(timezone); err != nil {
+		errs.collect(newValidationError("timezone", errTimezoneInvalid))
+	}
+	c := city{
+		Name:     name,
+		Country:  country,
+		Timezone: timezone,
+		Slug:     slugify(name),
+	}
+
+	for _, opt := range opts {
+		err := opt(&c)
+		if !errs.collect(err) {
+			return city{}, err
+		}
+	}
+	if err := errs.err(); err != nil {
+		return city{}, err
+	}
+	if c.Center == (coordinate{}) {
+		return city{}, newValidationError("", errCityCenterEmpty)
+	}
+	if c.Bounds == (boundingBox{}) {
+		c.Bounds = boundsAround(c.Center, defaultCityRadiusKm)
+	}
+	if !c.Bounds.Contains(c.Center) {
+		return city{}, newValidationError("", errCenterOutOfBounds)
+	}
+	return c, nil
+}
+
+// cornerError is err of the coordinates of a corner of the bounds, with the latitude and
+// longitude errors under the fields of the corner, like south and west.
+func cornerError(err error, latitudeField, longitudeField string) error {
+	errs := asValidationErrors(err)
+	for _, e := range errs {
+		switch e.Field {
+		case "latitude":
+			e.Field = latitudeField
+		case "longitude":
+			e.Field = longitudeField
+		}
+	}
+	return err
+}
+
+// boundsAround is the box of radiusKm around center, a degree of longitude being shorter away
+// from the equator.
+func boundsAround(center coordinate, radiusKm float64) boundingBox {
+	dLat := radiusKm / kmPerDegree
+	dLon := dLat / math.Max(0.01, math.Cos(center.Latitude*math.Pi/180))
+	return boundingBox{
+		South: max(-90, center.Latitude-dLat),
+		West:  max(-180, center.Longitude-dLon),
+		North: min(90, center.Latitude+dLat),
+		East:  min(180, center.Longitude+dLon),
+	}
+}
+
+type cityForm struct {
+	Name, Country, Timezone, Latitude, Longitude string
+	South, West, North, East                     string
+	formErrors
+}
+
+// cityChoice is the city field of the guide forms. City is the chosen city ID, or cityAuto to
+// suggest it from the guide coordinates.
+type cityChoice struct {
+	City      string
+	Cities    []city
+	Suggested *city
+}
+
+const cityAuto = "auto"
+
+// cityID is the ID of the chosen city, of the suggested one for cityAuto, or 0 for no city.
+func (c cityChoice) cityID() (int64, error) {
+	switch c.City {
+	case "":
+		return 0, nil
+	case cityAuto:
+		if c.Suggested == nil {
+			return 0, nil
+		}
+		return c.Suggested.Id, nil
+	}
+	id, err := strconv.ParseInt(c.City, 10, 64)
+	if err != nil {
+		return 0, errors.New("not able to parse city ID")
+	}
+	for _, city := range c.Cities {
+		if city.Id == id {
+			return id, nil
+		}
+	}
+	return 0, errors.New("city not found")
+}
+
+// markerMap is a map of links to pages, like the guides of a city.
+type markerMap struct {
+	Center  coordinate
+	Zoom    int
+	Markers []mapMarker
+}
+
+type mapMarker struct {
+	Name, URL  string
+	Coordinate coordinate
+}
+
+// GuideMap is the map of the guides of the city.
+func (c city) GuideMap() markerMap {
+	m := markerMap{Center: c.Center, Zoom: 12, Markers: make([]mapMarker, 0, len(c.Guides))}
+	for _, g := range c.Guides {
+		m.Markers = append(m.Markers, mapMarker{Name: g.Name, URL: "/g/" + g.Slug, Coordinate: g.Coordinate})
+	}
+	return m
+}
+
+// cityIndex is the data of the cities page.
+type cityIndex struct {
+	Cities []city
+	Map    markerMap
+}
+
+func newCityIndex(cities []city) cityIndex {
+	m := markerMap{Center: coordinate{Latitude: 20}, Zoom: 2, Markers: make([]mapMarker, 0, len(cities))}
+	for _, c := range cities {
+		m.Markers = append(m.Markers, mapMarker{Name: c.Name, URL: "/city/" + c.Slug, Coordinate: c.Center})
+	}
+	return cityIndex{Cities: cities, Map: m}
+}
@@ -0,0 +1,199 @@
+package guide_test
+
+import (
+	"guide"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewCity(t *testing.T) {
+	t.Parallel()
+	c, err := guide.NewCity(" Oaxaca de Juárez ", "mx", "America/Mexico_City", guide.CityWithValidStringCenter("17.06", "-96.72"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "Oaxaca de Juárez" || c.Country != "MX" || c.Slug != "oaxaca-de-juarez" {
+		t.Errorf("want trimmed name, upper case country and slug, got %q %q %q", c.Name, c.Country, c.Slug)
+	}
+	if !c.Bounds.Contains(c.Center) || c.Bounds.North-c.Bounds.South < 0.2 {
+		t.Errorf("want default bounds around the center, got %+v", c.Bounds)
+	}
+
+	testCases := map[string]struct {
+		name, country, timezone  string
+		latitude, longitude      string
+		south, west, north, east string
+	}{
+		"empty name":        {"", "MX", "America/Mexico_City", "17", "-96", "", "", "", ""},
+		"no letters":        {"!!", "MX", "America/Mexico_City", "17", "-96", "", "", "", ""},
+		"country name":      {"Oaxaca", "Mexico", "America/Mexico_City", "17", "-96", "", "", "", ""},
+		"unknown timezone":  {"Oaxaca", "MX", "Mexico/Oaxaca", "17", "-96", "", "", "", ""},
+		"no center":         {"Oaxaca", "MX", "America/Mexico_City", "", "", "", "", "", ""},
+		"half bounds":       {"Oaxaca", "MX", "America/Mexico_City", "17", "-96", "16", "-97", "", ""},
+		"inverted bounds":   {"Oaxaca", "MX", "America/Mexico_City", "17", "-96", "18", "-95", "16", "-97"},
+		"center off bounds": {"Oaxaca", "MX", "America/Mexico_City", "17", "-96", "18", "-97", "19", "-95"},
+	}
+	for name, tc := range testCases {
+		_, err := guide.NewCity(tc.name, tc.country, tc.timezone, guide.CityWithValidStringCenter(tc.latitude, tc.longitude), guide.CityWithBounds(tc.south, tc.west, tc.north, tc.east))
+		if err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestStoreSuggestsTheNearestCityContainingTheCoordinate(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	for _, c := range []struct{ name, latitude, longitude string }{
+		{"Oaxaca de Juárez", "17.06", "-96.72"},
+		{"Santa Cruz Xoxocotlán", "17.03", "-96.73"},
+		{"Mexico City", "19.43", "-99.13"},
+	} {
+		city, err := guide.NewCity(c.name, "MX", "America/Mexico_City", guide.CityWithValidStringCenter(c.latitude, c.longitude))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.CreateCity(&city)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	duplicate, err := guide.NewCity("Oaxaca de Juarez", "MX", "America/Mexico_City", guide.CityWithValidStringCenter("17", "-96"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.CreateCity(&duplicate); err == nil {
+		t.Error("want error creating a city with the slug of another")
+	}
+
+	testCases := []struct {
+		latitude, longitude string
+		want                string
+	}{
+		{"17.065", "-96.72", "oaxaca-de-juarez"},
+		{"17.025", "-96.735", "santa-cruz-xoxocotlan"},
+		{"19.40", "-99.10", "mexico-city"},
+		{"48.85", "2.35", ""},
+	}
+	for _, tc := range testCases {
+		g, err := guide.NewGuide("here", guide.WithValidStringCoordinates(tc.latitude, tc.longitude))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := storage.SuggestCity(g.Coordinate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if c != nil {
+			got = c.Slug
+		}
+		if got != tc.want {
+			t.Errorf("%s, %s: want %q, got %q", tc.latitude, tc.longitude, tc.want, got)
+		}
+	}
+}
+
+func TestCityPages(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	server, err := guide.NewServer(":8080", storage, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := newSessionCookie(t, &server, "admin")
+	traveler := newSessionCookie(t, &server, "traveler")
+	send := func(method, target string, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	oaxaca := url.Values{"name": {"Oaxaca de Juárez"}, "country": {"MX"}, "timezone": {"America/Mexico_City"}, "latitude": {"17.06"}, "longitude": {"-96.72"}}
+	if rr := send(http.MethodPost, "/city/create", traveler, oaxaca); rr.Code != http.StatusForbidden {
+		t.Errorf("want only admins creating cities, got %d", rr.Code)
+	}
+	if rr := send(http.MethodPost, "/city/create", admin, oaxaca); rr.Code != http.StatusForbidden {
+		t.Errorf("want signing up as admin not enough to create cities, got %d", rr.Code)
+	}
+	err = storage.SetUserAdmin("admin", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := send(http.MethodPost, "/city/create", admin, oaxaca)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/city/oaxaca-de-juarez" {
+		t.Fatalf("want city created, got status %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := send(http.MethodPost, "/city/create", admin, oaxaca); rr.Code != http.StatusConflict {
+		t.Errorf("want conflict creating the city again, got %d", rr.Code)
+	}
+	oaxaca.Set("timezone", "Oaxaca")
+	if rr := send(http.MethodPost, "/city/create", admin, oaxaca); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "IANA time zone") {
+		t.Errorf("want invalid timezone rejected, got %d", rr.Code)
+	}
+
+	rr = send(http.MethodGet, "/city/suggest?city=auto&latitude=17.07&longitude=-96.72", nil, nil)
+	if !strings.Contains(rr.Body.String(), "Suggest from the coordinates (Oaxaca de Juárez)") {
+		t.Errorf("want city suggested from the coordinates, got %q", rr.Body.String())
+	}
+	if !strings.Contains(send(http.MethodGet, "/guide/create", nil, nil).Body.String(), `<option value="auto" selected>`) {
+		t.Error("want guide form suggesting the city by default")
+	}
+
+	rr = send(http.MethodPost, "/guide/create", nil, url.Values{"name": {"Mezcal bars"}, "latitude": {"17.07"}, "longitude": {"-96.72"}, "city": {"auto"}})
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("want guide created, got status %d %q", rr.Code, rr.Body.String())
+	}
+	rr = send(http.MethodPost, "/guide/create", nil, url.Values{"name": {"Paris"}, "latitude": {"48.85"}, "longitude": {"2.35"}, "city": {"auto"}})
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("want guide without city created, got status %d %q", rr.Code, rr.Body.String())
+	}
+	rr = send(http.MethodPost, "/guide/create", nil, url.Values{"name": {"Nowhere"}, "latitude": {"48.85"}, "longitude": {"2.35"}, "city": {"42"}})
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "city not found") {
+		t.Errorf("want unknown city rejected, got status %d", rr.Code)
+	}
+	mezcal, err := storage.GetGuidebyID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mezcal.CityID != 1 || mezcal.CitySlug != "oaxaca-de-juarez" {
+		t.Errorf("want guide in the suggested city, got %d %q", mezcal.CityID, mezcal.CitySlug)
+	}
+	paris, err := storage.GetGuidebyID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paris.CityID != 0 {
+		t.Errorf("want guide outside the cities without city, got %d", paris.CityID)
+	}
+
+	rr = send(http.MethodGet, "/cities", nil, nil)
+	if !strings.Contains(rr.Body.String(), `<a href="/city/oaxaca-de-juarez">Oaxaca de Juárez</a>`) || !strings.Contains(rr.Body.String(), "<td>1</td>") {
+		t.Errorf("want cities with their guide count, got %q", rr.Body.String())
+	}
+	rr = send(http.MethodGet, "/city/oaxaca-de-juarez", nil, nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Mezcal bars") || strings.Contains(rr.Body.String(), "Paris") {
+		t.Errorf("want city page with its guides, got status %d %q", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(send(http.MethodGet, "/guide/1", nil, nil).Body.String(), `<a href="/city/oaxaca-de-juarez">`) {
+		t.Error("want guide page linking its city")
+	}
+
+	rr = send(http.MethodPost, "/guide/1/edit", nil, url.Values{"name": {"Mezcal bars"}, "latitude": {"17.07"}, "longitude": {"-96.72"}, "city": {""}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want guide edited, got status %d %q", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(send(http.MethodGet, "/city/oaxaca-de-juarez", nil, nil).Body.String(), "Mezcal bars") {
+		t.Error("want guide removed from the city")
+	}
+}
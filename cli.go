@@ -0,0 +1,197 @@
+package guide
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: server [command]
+
+commands:
+  serve                              run the server, the default
+  backup [-media dir] <output>       write a snapshot of the database, with -media an archive including the media files
+  restore [-media dir] <input>       replace the database with a backup, stop the server first
+  dump <output>                      write all the data as newline-delimited JSON, - writes to stdout
+  load <input>                       load a dump into an empty database, - reads from stdin
+  export-static <dir>                render all guides as a static site into dir
+  import-places <input>              add a GeoNames or OpenAddresses file to the places the address fields search
+  grant-admin <username>             allow a signed up user to use the admin endpoints, like /admin/backup
+  revoke-admin <username>            take the admin rights of a user back
+
+the database is city_guide.db in DB_PATH, the home directory by default, and the places are
+places.db next to it or in GEOCODER_PATH`
+
+// RunCommand runs the command of the command line arguments, the server by default.
+func RunCommand(args []string, output io.Writer) error {
+	if len(args) == 0 || args[0] == "serve" {
+		RunServer(output)
+		return nil
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(output)
+	var mediaDir *string
+	var run func(dbPath, file string) error
+	switch args[0] {
+	case "backup":
+		mediaDir = flags.String("media", "", "directory of the uploaded media")
+		run = func(dbPath, file string) error { return runBackup(dbPath, file, *mediaDir, output) }
+	case "restore":
+		mediaDir = flags.String("media", "", "directory to restore the uploaded media to")
+		run = func(dbPath, file string) error { return runRestore(dbPath, file, *mediaDir, output) }
+	case "dump":
+		run = func(dbPath, file string) error { return runDump(dbPath, file, output) }
+	case "load":
+		run = func(dbPath, file string) error { return runLoad(dbPath, file, output) }
+	case "export-static":
+		run = func(dbPath, dir string) error { return runExportStatic(dbPath, dir, output) }
+	case "import-places":
+		run = func(dbPath, file string) error { return runImportPlaces(dbPath, file, output) }
+	case "grant-admin", "revoke-admin":
+		admin := args[0] == "grant-admin"
+		run = func(dbPath, username string) error { return runSetAdmin(dbPath, username, admin, output) }
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%s needs exactly one argument\n%s", args[0], usage)
+	}
+
+	dbPath, err := databasePath()
+	if err != nil {
+		return err
+	}
+	return run(dbPath, flags.Arg(0))
+}
+
+func runBackup(dbPath, file, mediaDir string, output io.Writer) error {
+	storage, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		return err
+	}
+	err = createBackup(storage, file, mediaDir)
+	if err != nil {
+		return fmt.Errorf("not able to back up %s: %w", dbPath, err)
+	}
+	fmt.Fprintf(output, "backed up %s to %s\n", dbPath, file)
+	return nil
+}
+
+func runSetAdmin(dbPath, username string, admin bool, output io.Writer) error {
+	storage, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		return err
+	}
+	err = storage.SetUserAdmin(username, admin)
+	if err != nil {
+		return err
+	}
+	if admin {
+		fmt.Fprintf(output, "%s is an admin\n", username)
+	} else {
+		fmt.Fprintf(output, "%s is not an admin anymore\n", username)
+	}
+	return nil
+}
+
+func runRestore(dbPath, file, mediaDir string, output io.Writer) error {
+	err := restoreBackup(file, dbPath, mediaDir)
+	if err != nil {
+		return fmt.Errorf("not able to restore %s: %w", file, err)
+	}
+	fmt.Fprintf(output, "restored %s to %s\n", file, dbPath)
+	return nil
+}
+
+func runDump(dbPath, file string, output io.Writer) error {
+	storage, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		return err
+	}
+	if file == "-" {
+		_, err = WriteDump(output, storage)
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	counts, err := WriteDump(f, storage)
+	if err != nil {
+		f.Close()
+		os.Remove(file)
+		return fmt.Errorf("not able to dump %s: %w", dbPath, err)
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "dumped %s to %s\n", formatDumpCounts(counts), file)
+	return nil
+}
+
+func runLoad(dbPath, file string, output io.Writer) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	storage, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		return err
+	}
+	counts, err := LoadDump(r, storage)
+	if err != nil {
+		return fmt.Errorf("not able to load %s: %w", file, err)
+	}
+	fmt.Fprintf(output, "loaded %s into %s\n", formatDumpCounts(counts), dbPath)
+	return nil
+}
+
+func runImportPlaces(dbPath, file string, output io.Writer) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	path := placeIndexPath(dbPath)
+	places, err := OpenPlaceIndex(path)
+	if err != nil {
+		return err
+	}
+	count, err := places.Import(f)
+	if err != nil {
+		return fmt.Errorf("not able to import %s: %w", file, err)
+	}
+	fmt.Fprintf(output, "imported %d places into %s\n", count, path)
+	return nil
+}
+
+func runExportStatic(dbPath, dir string, output io.Writer) error {
+	// the exported site has to work offline, without the sources of the assets
+	err := checkAssetsVendored()
+	if err != nil {
+		return err
+	}
+	storage, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		return err
+	}
+	count, err := ExportStaticSite(storage, dir)
+	if err != nil {
+		return fmt.Errorf("not able to export %s: %w", dir, err)
+	}
+	fmt.Fprintf(output, "exported %d guides to %s\n", count, dir)
+	return nil
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"guide"
 	"os"
 )
 
 func main() {
-	guide.RunServer(os.Stdout)
+	err := guide.RunCommand(os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
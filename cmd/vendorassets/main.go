@@ -0,0 +1,35 @@
+// vendorassets downloads the frontend assets into the static directory of the guide package, run
+// it with go generate.
+package main
+
+import (
+	"fmt"
+	"guide"
+	"io"
+	"net/http"
+	"os"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: vendorassets <dir>")
+		os.Exit(2)
+	}
+	err := guide.VendorAssets(os.Args[1], get)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func get(url string) ([]byte, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
@@ -0,0 +1,126 @@
+package guide
+
+import (
+	"errors"
+	"html/template"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// comment is a message in the discussion of a guide. Comments with a ParentID are replies,
+// forming threads.
+type comment struct {
+	Id        int64
+	GuideID   int64
+	UserID    int64
+	Username  string
+	ParentID  int64
+	Body      string
+	Hidden    bool
+	Deleted   bool
+	CreatedAt time.Time
+	Replies   []comment
+
+	// CanReply, CanEdit and CanModerate are set per request for the current user: any logged-in
+	// user, the author and the guide owner respectively.
+	CanReply    bool
+	CanEdit     bool
+	CanModerate bool
+}
+
+type commentOption func(*comment) error
+
+func CommentReplyTo(parentID int64) commentOption {
+	return func(c *comment) error {
+		if parentID < 0 {
+			return errors.New("parent comment ID cannot be negative")
+		}
+		c.ParentID = parentID
+		return nil
+	}
+}
+
+func NewComment(body string, guideID, userID int64, opts ...commentOption) (comment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return comment{}, errors.New("comment cannot be empty")
+	}
+	if len(body) > maxCommentLength {
+		return comment{}, errors.New("comment has to be at most 2000 characters long")
+	}
+	if guideID <= 0 {
+		return comment{}, errors.New("guide ID cannot be empty")
+	}
+	if userID <= 0 {
+		return comment{}, errors.New("user ID cannot be empty")
+	}
+	c := comment{
+		Body:    body,
+		GuideID: guideID,
+		UserID:  userID,
+	}
+
+	for _, opt := range opts {
+		err := opt(&c)
+		if err != nil {
+			return comment{}, err
+		}
+	}
+	return c, nil
+}
+
+const maxCommentLength = 2000
+
+// BodyHTML renders the comment body as markdown-lite: `code`, **bold**, *emphasis*, [links](https://...)
+// and line breaks. The body is escaped before any markup is added so users cannot inject HTML.
+func (c comment) BodyHTML() template.HTML {
+	var b strings.Builder
+	// odd segments are between backticks
+	for i, segment := range strings.Split(c.Body, "`") {
+		escaped := template.HTMLEscapeString(segment)
+		if i%2 == 1 {
+			b.WriteString("<code>" + escaped + "</code>")
+			continue
+		}
+		escaped = rxMarkdownLink.ReplaceAllString(escaped, `<a href="$2" rel="nofollow noopener">$1</a>`)
+		escaped = rxMarkdownBold.ReplaceAllString(escaped, "<strong>$1</strong>")
+		escaped = rxMarkdownEmphasis.ReplaceAllString(escaped, "<em>$1</em>")
+		b.WriteString(strings.ReplaceAll(escaped, "\n", "<br>"))
+	}
+	return template.HTML(b.String())
+}
+
+var (
+	rxMarkdownLink     = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^\s)*]+)\)`)
+	rxMarkdownBold     = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	rxMarkdownEmphasis = regexp.MustCompile(`\*([^*]+)\*`)
+)
+
+// threadComments nests replies under their parent comments. comments have to be sorted by Id,
+// so that parents come before their replies.
+func threadComments(comments []comment) []comment {
+	children := map[int64][]comment{}
+	for _, c := range comments {
+		children[c.ParentID] = append(children[c.ParentID], c)
+	}
+
+	var nest func(parentID int64) []comment
+	nest = func(parentID int64) []comment {
+		thread := make([]comment, 0, len(children[parentID]))
+		for _, c := range children[parentID] {
+			c.Replies = nest(c.Id)
+			thread = append(thread, c)
+		}
+		return thread
+	}
+	return nest(0)
+}
+
+// commentSection is the data of the comments of a guide page.
+type commentSection struct {
+	GuideID  int64
+	LoggedIn bool
+	Comments []comment
+	Errors   []string
+}
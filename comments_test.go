@@ -0,0 +1,52 @@
+package guide_test
+
+import (
+	"guide"
+	"strings"
+	"testing"
+)
+
+func TestNewCommentErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name            string
+		body            string
+		guideID, userID int64
+	}{
+		{name: "empty body", body: " ", guideID: 1, userID: 1},
+		{name: "too long body", body: strings.Repeat("a", 2001), guideID: 1, userID: 1},
+		{name: "no guide", body: "hi", guideID: 0, userID: 1},
+		{name: "anonymous user", body: "hi", guideID: 1, userID: 0},
+	}
+	for _, tc := range testCases {
+		_, err := guide.NewComment(tc.body, tc.guideID, tc.userID)
+		if err == nil {
+			t.Errorf("want error on %s", tc.name)
+		}
+	}
+}
+
+func TestCommentBodyHTML(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		body, want string
+	}{
+		{"<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"**best** *tacos*", "<strong>best</strong> <em>tacos</em>"},
+		{"`<b>`", "<code>&lt;b&gt;</code>"},
+		{"[map](https://osm.org/?a=1&b=2)", `<a href="https://osm.org/?a=1&amp;b=2" rel="nofollow noopener">map</a>`},
+		{"[click](javascript:alert(1))", "[click](javascript:alert(1))"},
+		{`[x](https://a.com/"onmouseover="alert(1))`, `<a href="https://a.com/&#34;onmouseover=&#34;alert(1" rel="nofollow noopener">x</a>)`},
+		{"line\nbreak", "line<br>break"},
+	}
+	for _, tc := range testCases {
+		c, err := guide.NewComment(tc.body, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(c.BodyHTML())
+		if got != tc.want {
+			t.Errorf("for %q want %q, got %q", tc.body, tc.want, got)
+		}
+	}
+}
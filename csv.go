@@ -0,0 +1,175 @@
+package guide
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var csvHeader = []string{"id", "name", "description", "latitude", "longitude", "category"}
+
+// WriteGuideCSV exports the guide pois as CSV, one row per poi. The id column lets an edited
+// export be imported back in upsert mode.
+func WriteGuideCSV(w io.Writer, g guide) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+	for _, poi := range g.Pois {
+		err = cw.Write([]string{
+			strconv.FormatInt(poi.Id, 10),
+			poi.Name,
+			poi.Description,
+			strconv.FormatFloat(poi.Coordinate.Latitude, 'f', -1, 64),
+			strconv.FormatFloat(poi.Coordinate.Longitude, 'f', -1, 64),
+			poi.Category,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvColumnAliases are other common headers of poi columns, after the ones chosen in the import form.
+var csvColumnAliases = map[string][]string{
+	"id":          {"poi_id", "poi id"},
+	"latitude":    {"lat"},
+	"longitude":   {"lon", "lng", "long"},
+	"name":        {"title"},
+	"description": {"desc", "notes"},
+	"category":    {"type", "folder"},
+}
+
+// readCSVImportRows reads one row per CSV record, mapping the header to poi fields. The delimiter
+// is a comma or, as spreadsheets export them in locales with a decimal comma, a semicolon.
+// Coordinates with a decimal comma are accepted.
+func readCSVImportRows(r io.Reader, form importForm) ([]importRow, error) {
+	br := bufio.NewReader(r)
+	// spreadsheets start UTF-8 files with a byte order mark
+	bom, _ := br.Peek(3)
+	if bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+	firstLine, _ := br.Peek(br.Buffered())
+	if i := bytes.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.TrimLeadingSpace = true
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		cr.Comma = ';'
+	}
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("not able to parse CSV: %w", err)
+	}
+	columns := csvColumns(header, map[string]string{
+		"name":        form.NameKey,
+		"description": form.DescriptionKey,
+		"category":    form.CategoryKey,
+		"latitude":    "latitude",
+		"longitude":   "longitude",
+		"id":          "id",
+	})
+	for _, required := range []string{"name", "latitude", "longitude"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV has no %s column", required)
+		}
+	}
+
+	rows := make([]importRow, 0)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not able to parse CSV: %w", err)
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		row := importRow{
+			Number:      line,
+			Name:        field("name"),
+			Description: field("description"),
+			Category:    field("category"),
+			Latitude:    normalizeDecimal(field("latitude")),
+			Longitude:   normalizeDecimal(field("longitude")),
+		}
+		if form.Upsert {
+			row.ID = field("id")
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("CSV has no rows")
+	}
+	validateImportRows(rows, form.GuideID, form.catalog)
+	return rows, nil
+}
+
+// csvColumns maps poi fields to the index of their column in header, matching the header chosen
+// for each field and then its aliases, case-insensitively.
+func csvColumns(header []string, chosen map[string]string) map[string]int {
+	index := map[string]int{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if _, ok := index[h]; !ok {
+			index[h] = i
+		}
+	}
+
+	columns := map[string]int{}
+	for field, name := range chosen {
+		candidates := append([]string{strings.ToLower(name), field}, csvColumnAliases[field]...)
+		for _, candidate := range candidates {
+			if i, ok := index[candidate]; ok {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	return columns
+}
+
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeDecimal turns a decimal comma into a point, "17,06" into "17.06". Values with both
+// or neither are left alone for the coordinate validation to judge.
+func normalizeDecimal(value string) string {
+	if strings.Count(value, ",") == 1 && !strings.Contains(value, ".") {
+		return strings.Replace(value, ",", ".", 1)
+	}
+	return value
+}
@@ -0,0 +1,185 @@
+package guide_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"guide"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWriteGuideCSV(t *testing.T) {
+	t.Parallel()
+	g, err := guide.NewGuide("Oaxaca", guide.WithValidStringCoordinates("17", "-96"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	poi, err := guide.NewPointOfInterest("Mercado, 20 de Noviembre", 1, guide.PoiWithValidStringCoordinates("17.0588", "-96.7266"),
+		guide.PoiWithDescription("Smoke \"alley\"\nand more"), guide.PoiWithCategory("food"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	poi.Id = 4
+	g.Pois = append(g.Pois, poi)
+
+	var b bytes.Buffer
+	err = guide.WriteGuideCSV(&b, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"id", "name", "description", "latitude", "longitude", "category"},
+		{"4", "Mercado, 20 de Noviembre", "Smoke \"alley\"\nand more", "17.0588", "-96.7266", "food"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("want %d records, got %d", len(want), len(records))
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("want record %v, got %v", want[i], records[i])
+		}
+	}
+}
+
+func TestImportCSVPreview(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		csv    string
+		fields map[string]string
+		want   []string
+	}{
+		"aliases": {
+			csv:  "Title,Lat,Lng,Notes,Type,ignored\nMercado,17.0588,-96.7266,Smoke alley,food,x\n",
+			want: []string{`value="Mercado"`, `value="17.0588"`, `value="-96.7266"`, `value="Smoke alley"`, `value="food"`, "Import 1 points of interest"},
+		},
+		"decimal comma and semicolons with a byte order mark": {
+			csv:  "\xef\xbb\xbfname;latitude;longitude\nMercado;17,0588;-96,7266\n",
+			want: []string{`value="Mercado"`, `value="17.0588"`, `value="-96.7266"`, "Import 1 points of interest"},
+		},
+		"mapped columns": {
+			csv:    "spot,latitude,longitude,kind\nMercado,17.0588,-96.7266,food\n",
+			fields: map[string]string{"name_key": "spot", "category_key": "kind"},
+			want:   []string{`value="Mercado"`, `value="food"`},
+		},
+		"row errors": {
+			csv:  "name,latitude,longitude\nMercado,17.0588,-96.7266\n,17,-96\nOut,97,-96\n\nNaN,abc,-96\n",
+			want: []string{"Import 1 points of interest", "poi name cannot be empty", "latitude has to be in the", "latitude has to be a number", "<td>6</td>"},
+		},
+	}
+	server := newProvisionedServer(t)
+	for name, tc := range testCases {
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/1/import", "spots.csv", tc.csv, tc.fields))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: want status %d, got %d", name, http.StatusOK, rr.Code)
+			continue
+		}
+		body := rr.Body.String()
+		for _, want := range tc.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: want preview to contain %q", name, want)
+			}
+		}
+	}
+}
+
+func TestImportCSVErrors(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	testCases := map[string]string{
+		"empty":          "",
+		"no name column": "title2,latitude,longitude\nMercado,17,-96\n",
+		"no coordinates": "name,description\nMercado,food\n",
+		"no rows":        "name,latitude,longitude\n",
+	}
+	for name, input := range testCases {
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/1/import", "spots.csv", input, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: want status %d, got %d", name, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+var rxHiddenInput = regexp.MustCompile(`<input type="hidden" name="(\w+)" value="([^"]*)">`)
+
+// commitPreview posts the commit form of an import preview.
+func commitPreview(t *testing.T, server *guide.Server, preview string) *httptest.ResponseRecorder {
+	t.Helper()
+	form := url.Values{}
+	for _, m := range rxHiddenInput.FindAllStringSubmatch(preview, -1) {
+		form.Add(m[1], m[2])
+	}
+	req := httptest.NewRequest(http.MethodPost, "/guide/1/import/commit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestImportCSVUpsertUpdatesEditedExport(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	server := newProvisionedServerWithStore(storage, t)
+
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/guide/1.csv", nil))
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records[1][1] = "renamed"
+	records = append(records, []string{"", "new spot", "", "10", "10", ""})
+	var edited bytes.Buffer
+	cw := csv.NewWriter(&edited)
+	cw.WriteAll(records)
+
+	rr = httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/1/import", "guide-1.csv", edited.String(), map[string]string{"upsert": "on"}))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "update #"+records[1][0]) {
+		t.Errorf("want preview to update poi %s", records[1][0])
+	}
+
+	rr = commitPreview(t, server, rr.Body.String())
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("want status %d, got %d", http.StatusSeeOther, rr.Code)
+	}
+	pois := storage.GetAllPois(1)
+	if len(pois) != 4 {
+		t.Fatalf("want 3 updated pois and 1 new, got %d", len(pois))
+	}
+	if pois[0].Name != "renamed" || pois[3].Name != "new spot" {
+		t.Errorf("want first poi renamed and new spot created, got %s and %s", pois[0].Name, pois[3].Name)
+	}
+}
+
+func TestImportCSVUpsertRejectsPoisOfOtherGuides(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	input := "id,name,latitude,longitude\n4,Other guide poi,10,10\n1,twice,10,10\n1,twice,10,10\nx,bad id,10,10\n"
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/1/import", "spots.csv", input, map[string]string{"upsert": "on"}))
+	body := rr.Body.String()
+	for _, want := range []string{"poi 4 is not in this guide", "poi 1 is updated by another row", "poi ID has to be a positive number", "Import 1 points of interest"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want preview to contain %q", want)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/1/import", "spots.csv", input, nil))
+	if !strings.Contains(rr.Body.String(), "Import 4 points of interest") {
+		t.Error("want ids ignored without upsert")
+	}
+}
@@ -0,0 +1,302 @@
+package guide
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A dump is a backend neutral copy of all the data of a Storage, to move it between Storage
+// implementations. It is newline-delimited JSON: a header line with the format version, a line per
+// entity, and an end line with the count of each kind of entity so truncated dumps are detected.
+// Entities keep their IDs, so the references between them don't change. Sessions aren't dumped.
+const (
+	dumpFormat  = "cityguide-dump"
+	dumpVersion = 4
+)
+
+const (
+	dumpKindUser      = "user"
+	dumpKindCity      = "city"
+	dumpKindGuide     = "guide"
+	dumpKindPoi       = "poi"
+	dumpKindItinerary = "itinerary"
+	dumpKindFavorite  = "favorite"
+	dumpKindList      = "list"
+	dumpKindComment   = "comment"
+	dumpKindEnd       = "end"
+)
+
+// dumpKinds are the kinds of entities in the order they are dumped, entities only reference
+// entities of earlier kinds, or of the same kind with lower IDs.
+var dumpKinds = []string{dumpKindUser, dumpKindCity, dumpKindGuide, dumpKindPoi, dumpKindItinerary, dumpKindFavorite, dumpKindList, dumpKindComment}
+
+type dumpHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type dumpLine struct {
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+// dumpEntity is a pointer to an entity of a dump, e.g. *dumpGuide.
+type dumpEntity interface {
+	dumpKind() string
+}
+
+type dumpUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// PasswordHash is the encoded salt and hash of the password.
+	PasswordHash string `json:"password_hash"`
+	Email        string `json:"email"`
+	Admin        bool   `json:"admin,omitempty"`
+}
+
+type dumpCity struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	Country   string  `json:"country"`
+	Timezone  string  `json:"timezone"`
+	Slug      string  `json:"slug"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	South     float64 `json:"south"`
+	West      float64 `json:"west"`
+	North     float64 `json:"north"`
+	East      float64 `json:"east"`
+}
+
+type dumpGuide struct {
+	ID           int64   `json:"id"`
+	Name         string  `json:"name"`
+	Slug         string  `json:"slug,omitempty"`
+	Description  string  `json:"description"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	OwnerID      int64   `json:"owner_id,omitempty"`
+	ForkedFromID int64   `json:"forked_from_id,omitempty"`
+	CityID       int64   `json:"city_id,omitempty"`
+	// OldSlugs redirect to the guide, it had them before being renamed.
+	OldSlugs []string `json:"old_slugs,omitempty"`
+	// Language is the locale of the guide, Translations are in other locales.
+	Language     string                     `json:"language,omitempty"`
+	Translations map[string]dumpTranslation `json:"translations,omitempty"`
+}
+
+type dumpTranslation struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type dumpPoi struct {
+	ID          int64   `json:"id"`
+	GuideID     int64   `json:"guide_id"`
+	Name        string  `json:"name"`
+	Slug        string  `json:"slug,omitempty"`
+	Description string  `json:"description"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Category    string  `json:"category,omitempty"`
+	// Translations are by locale.
+	Translations map[string]dumpTranslation `json:"translations,omitempty"`
+}
+
+type dumpItinerary struct {
+	ID      int64   `json:"id"`
+	GuideID int64   `json:"guide_id"`
+	Name    string  `json:"name"`
+	PoiIDs  []int64 `json:"poi_ids"`
+}
+
+type dumpFavorite struct {
+	UserID  int64 `json:"user_id"`
+	GuideID int64 `json:"guide_id"`
+}
+
+type dumpList struct {
+	ID     int64   `json:"id"`
+	UserID int64   `json:"user_id"`
+	Name   string  `json:"name"`
+	PoiIDs []int64 `json:"poi_ids"`
+}
+
+type dumpComment struct {
+	ID        int64     `json:"id"`
+	GuideID   int64     `json:"guide_id"`
+	UserID    int64     `json:"user_id"`
+	ParentID  int64     `json:"parent_id,omitempty"`
+	Body      string    `json:"body"`
+	Hidden    bool      `json:"hidden"`
+	Deleted   bool      `json:"deleted"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type dumpEnd struct {
+	Counts map[string]int `json:"counts"`
+}
+
+func (dumpUser) dumpKind() string      { return dumpKindUser }
+func (dumpCity) dumpKind() string      { return dumpKindCity }
+func (dumpGuide) dumpKind() string     { return dumpKindGuide }
+func (dumpPoi) dumpKind() string       { return dumpKindPoi }
+func (dumpItinerary) dumpKind() string { return dumpKindItinerary }
+func (dumpFavorite) dumpKind() string  { return dumpKindFavorite }
+func (dumpList) dumpKind() string      { return dumpKindList }
+func (dumpComment) dumpKind() string   { return dumpKindComment }
+func (dumpEnd) dumpKind() string       { return dumpKindEnd }
+
+// newDumpEntity returns a pointer to an empty entity of kind to decode into.
+func newDumpEntity(kind string) (dumpEntity, error) {
+	switch kind {
+	case dumpKindUser:
+		return &dumpUser{}, nil
+	case dumpKindCity:
+		return &dumpCity{}, nil
+	case dumpKindGuide:
+		return &dumpGuide{}, nil
+	case dumpKindPoi:
+		return &dumpPoi{}, nil
+	case dumpKindItinerary:
+		return &dumpItinerary{}, nil
+	case dumpKindFavorite:
+		return &dumpFavorite{}, nil
+	case dumpKindList:
+		return &dumpList{}, nil
+	case dumpKindComment:
+		return &dumpComment{}, nil
+	case dumpKindEnd:
+		return &dumpEnd{}, nil
+	}
+	return nil, fmt.Errorf("unknown kind %q", kind)
+}
+
+// WriteDump writes all the data of store as a dump and returns the count of each kind of entity.
+func WriteDump(w io.Writer, store Storage) (map[string]int, error) {
+	enc := json.NewEncoder(w)
+	err := enc.Encode(dumpHeader{Format: dumpFormat, Version: dumpVersion, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	err = store.Dump(func(e dumpEntity) error {
+		counts[e.dumpKind()]++
+		return writeDumpLine(enc, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, writeDumpLine(enc, dumpEnd{Counts: counts})
+}
+
+func writeDumpLine(enc *json.Encoder, e dumpEntity) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return enc.Encode(dumpLine{Kind: e.dumpKind(), Data: data})
+}
+
+// LoadDump loads a dump into store, which has to be empty, and returns the count of each kind of
+// entity. The counts of the dump, what was read, and what the store has after loading must match,
+// otherwise nothing is loaded.
+func LoadDump(r io.Reader, store Storage) (map[string]int, error) {
+	before, err := store.CountEntities()
+	if err != nil {
+		return nil, err
+	}
+	for _, kind := range dumpKinds {
+		if before[kind] > 0 {
+			return nil, fmt.Errorf("store is not empty, it has %d %s entities", before[kind], kind)
+		}
+	}
+
+	dec := json.NewDecoder(r)
+	var header dumpHeader
+	err = dec.Decode(&header)
+	if err != nil {
+		return nil, fmt.Errorf("not able to read dump header: %w", err)
+	}
+	if header.Format != dumpFormat {
+		return nil, errors.New("not a city guide dump")
+	}
+	if header.Version < 1 || header.Version > dumpVersion {
+		return nil, fmt.Errorf("dump version %d is not supported, the supported version is %d", header.Version, dumpVersion)
+	}
+
+	read := map[string]int{}
+	var end *dumpEnd
+	line := 1
+	err = store.Load(func() (dumpEntity, error) {
+		if end != nil {
+			return nil, io.EOF
+		}
+		line++
+		var l dumpLine
+		err := dec.Decode(&l)
+		if err == io.EOF {
+			return nil, errors.New("dump is truncated, the end line is missing")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		e, err := newDumpEntity(l.Kind)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		err = json.Unmarshal(l.Data, e)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if e, ok := e.(*dumpEnd); ok {
+			// checked before the store commits, so a damaged dump loads nothing
+			if !equalDumpCounts(read, e.Counts) {
+				return nil, fmt.Errorf("dump has %s entities but its end line counts %s", formatDumpCounts(read), formatDumpCounts(e.Counts))
+			}
+			end = e
+			return nil, io.EOF
+		}
+		read[l.Kind]++
+		return e, nil
+	}, func(loaded map[string]int) error {
+		if !equalDumpCounts(loaded, read) {
+			return fmt.Errorf("loaded %s entities but the dump has %s", formatDumpCounts(loaded), formatDumpCounts(read))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return read, nil
+}
+
+func equalDumpCounts(a, b map[string]int) bool {
+	for kind, count := range a {
+		if b[kind] != count {
+			return false
+		}
+	}
+	for kind, count := range b {
+		if a[kind] != count {
+			return false
+		}
+	}
+	return true
+}
+
+// formatDumpCounts formats counts in dump order, e.g. "2 user, 3 guide".
+func formatDumpCounts(counts map[string]int) string {
+	s := ""
+	for _, kind := range dumpKinds {
+		if s != "" {
+			s += ", "
+		}
+		s += fmt.Sprintf("%d %s", counts[kind], kind)
+	}
+	return s
+}
@@ -0,0 +1,225 @@
+package guide_test
+
+import (
+	"bytes"
+	"guide"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newDumpedServer provisions a store with an entity of every kind and the relationships between them.
+func newDumpedServer(t *testing.T) guide.Storage {
+	t.Helper()
+	storage := openTmpStorage(t)
+	server := newProvisionedServerWithStore(storage, t)
+	cookie := newSessionCookie(t, server, "traveler")
+	u, err := storage.GetUserByUsername("traveler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := guide.NewCity("Oaxaca de Juárez", "MX", "America/Mexico_City", guide.CityWithValidStringCenter("17.06", "-96.72"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.CreateCity(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := storage.GetGuidebyID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.CityID = c.Id
+	g.Name = "Tacos de Oaxaca"
+	g.Language = "es"
+	err = storage.UpdateGuide(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.ForkGuide(1, u.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.ToggleFavorite(u.Id, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment, err := guide.NewComment("great tacos", 1, u.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.CreateComment(&comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := guide.NewComment("agreed", 1, u.Id, guide.CommentReplyTo(comment.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.CreateComment(&reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/lists", strings.NewReader("name=tacos")),
+		httptest.NewRequest(http.MethodPost, "/guide/1/poi/2/lists/1", nil),
+		httptest.NewRequest(http.MethodPost, "/guide/1/translations", strings.NewReader("locale=en&name=Oaxacan+tacos&poi-1-name=Taco+stand")),
+	} {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, req)
+		if rr.Code >= http.StatusBadRequest {
+			t.Fatalf("%s: want success, got %d", req.URL, rr.Code)
+		}
+	}
+	return storage
+}
+
+// dumpEntityLines dumps store and returns the lines after the header, which has the dump time.
+func dumpEntityLines(t *testing.T, store guide.Storage) []string {
+	t.Helper()
+	var b bytes.Buffer
+	_, err := guide.WriteDump(&b, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	return lines[1:]
+}
+
+func TestDumpAndLoadRoundTrip(t *testing.T) {
+	t.Parallel()
+	source := newDumpedServer(t)
+	var b bytes.Buffer
+	counts, err := guide.WriteDump(&b, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"user": 1, "city": 1, "guide": 4, "poi": 12, "itinerary": 4, "favorite": 1, "list": 1, "comment": 2}
+	for kind, count := range want {
+		if counts[kind] != count {
+			t.Errorf("want %d %s dumped, got %d", count, kind, counts[kind])
+		}
+	}
+
+	target := openTmpStorage(t)
+	loaded, err := guide.LoadDump(&b, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for kind, count := range want {
+		if loaded[kind] != count {
+			t.Errorf("want %d %s loaded, got %d", count, kind, loaded[kind])
+		}
+	}
+	got, wantLines := dumpEntityLines(t, target), dumpEntityLines(t, source)
+	if strings.Join(got, "\n") != strings.Join(wantLines, "\n") {
+		t.Errorf("want loaded store to dump the same entities\nwant:\n%s\ngot:\n%s", strings.Join(wantLines, "\n"), strings.Join(got, "\n"))
+	}
+
+	fork, err := target.GetGuidebyID(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.ForkedFromID != 1 || fork.OwnerID != 1 {
+		t.Errorf("want fork of guide 1 owned by user 1, got forked from %d owned by %d", fork.ForkedFromID, fork.OwnerID)
+	}
+	if fork.CityID != 1 || fork.CitySlug != "oaxaca-de-juarez" {
+		t.Errorf("want fork in the city of guide 1, got city %d %q", fork.CityID, fork.CitySlug)
+	}
+	id, slug, err := target.ResolveGuideSlug("test-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || slug != "tacos-de-oaxaca" {
+		t.Errorf("want old slug of the renamed guide 1 loaded, got guide %d with slug %q", id, slug)
+	}
+	translations, err := target.GetTranslations(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translations.Language != "es" || translations.Guide["en"].Name != "Oaxacan tacos" || translations.Pois[1]["en"].Name != "Taco stand" {
+		t.Errorf("want guide language and translations loaded, got %+v", translations)
+	}
+	u, err := target.GetUserByUsername("traveler")
+	if err != nil || u == nil {
+		t.Fatalf("want user loaded, got %v", err)
+	}
+	if lists := target.GetAllLists(u.Id); len(lists) != 1 || len(lists[0].Pois) != 1 || lists[0].Pois[0].Id != 2 {
+		t.Errorf("want list with poi 2 loaded, got %+v", lists)
+	}
+}
+
+func TestLoadDumpErrors(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	_, err := guide.WriteDump(&b, newDumpedServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := b.String()
+	lines := strings.SplitAfter(dump, "\n")
+
+	testCases := map[string]string{
+		"not a dump":      `{"format":"something-else","version":1}` + "\n",
+		"newer version":   `{"format":"cityguide-dump","version":99}` + "\n",
+		"truncated":       strings.Join(lines[:len(lines)-2], ""),
+		"missing entity":  strings.Join(append(lines[:2:2], lines[3:]...), ""),
+		"unknown kind":    lines[0] + `{"kind":"photo","data":{}}` + "\n",
+		"broken relation": lines[0] + `{"kind":"poi","data":{"id":1,"guide_id":42,"name":"orphan"}}` + "\n" + `{"kind":"end","data":{"counts":{"poi":1}}}` + "\n",
+	}
+	for name, input := range testCases {
+		target := openTmpStorage(t)
+		_, err = guide.LoadDump(strings.NewReader(input), target)
+		if err == nil {
+			t.Errorf("%s: want error", name)
+		}
+		counts, err := target.CountEntities()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for kind, count := range counts {
+			if count != 0 {
+				t.Errorf("%s: want nothing loaded, got %d %s", name, count, kind)
+			}
+		}
+	}
+
+	_, err = guide.LoadDump(strings.NewReader(dump), newDumpedServer(t))
+	if err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Errorf("want error loading into a store with data, got %v", err)
+	}
+}
+
+func TestRunCommandDumpAndLoad(t *testing.T) {
+	storage, _ := openDBPathStorage(t)
+	createTestGuide(t, storage, "Oaxaca")
+	dump := filepath.Join(t.TempDir(), "city_guide.ndjson")
+	var output bytes.Buffer
+	err := guide.RunCommand([]string{"dump", dump}, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "1 guide") {
+		t.Errorf("want dumped counts reported, got %q", output.String())
+	}
+
+	err = guide.RunCommand([]string{"load", dump}, io.Discard)
+	if err == nil {
+		t.Error("want error loading into a database with data")
+	}
+	t.Setenv("DB_PATH", t.TempDir())
+	output.Reset()
+	err = guide.RunCommand([]string{"load", dump}, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "loaded 0 user, 0 city, 1 guide") {
+		t.Errorf("want loaded counts reported, got %q", output.String())
+	}
+}
@@ -0,0 +1,15 @@
+package guide
+
+// SuggestOrder is suggestOrder of pois at the latitude, longitude pairs of coordinates, as the
+// indices of coordinates in visiting order, since the external tests can't name the poi type.
+func SuggestOrder(coordinates ...[2]float64) []int {
+	pois := make([]pointOfInterest, 0, len(coordinates))
+	for i, c := range coordinates {
+		pois = append(pois, pointOfInterest{Id: int64(i), Coordinate: coordinate{Latitude: c[0], Longitude: c[1]}})
+	}
+	order := make([]int, 0, len(pois))
+	for _, poi := range suggestOrder(pois) {
+		order = append(order, int(poi.Id))
+	}
+	return order
+}
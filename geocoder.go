@@ -0,0 +1,407 @@
+package guide
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Geocoder finds the coordinates of addresses and the address of coordinates.
+type Geocoder interface {
+	// Geocode returns up to limit places matching the start of query, the most relevant first.
+	Geocode(query string, limit int) ([]place, error)
+	// ReverseGeocode returns the place nearest to c, nil if there is none nearby.
+	ReverseGeocode(c coordinate) (*place, error)
+}
+
+// place is a named location of a geocoding dataset, like a city or a street address.
+type place struct {
+	Name string
+	// Region is where the place is, like a city and country.
+	Region     string
+	Coordinate coordinate
+}
+
+// Label is how the place is shown, its name and region.
+func (p place) Label() string {
+	if p.Region == "" {
+		return p.Name
+	}
+	return p.Name + ", " + p.Region
+}
+
+const (
+	placesFile = "places.db"
+	// maxGeocodeResults is the number of candidates the address autocomplete shows.
+	maxGeocodeResults = 8
+	// maxReverseGeocodeKm is how far the nearest place can be to describe a coordinate.
+	maxReverseGeocodeKm = 25
+	// kmPerDegree is the length of a degree of latitude.
+	kmPerDegree = earthRadiusKm * math.Pi / 180
+)
+
+// poiView is a poi with the place nearest to it, when geocoding.
+type poiView struct {
+	pointOfInterest
+	Place *place
+}
+
+// WithGeocoder adds an address field to the guide and poi forms, resolved by geocoder, and shows the
+// nearest place of pois.
+func WithGeocoder(geocoder Geocoder) serverOption {
+	return func(s *Server) error {
+		if geocoder == nil {
+			return errors.New("geocoder cannot be nil")
+		}
+		s.geocoder = geocoder
+		return nil
+	}
+}
+
+// HandleGeocode renders the places matching the address typed in a form, for htmx to show as
+// choices that fill in its coordinates.
+func (s *Server) HandleGeocode() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.geocoder == nil {
+			http.Error(w, "geocoding is not enabled", http.StatusNotFound)
+			return
+		}
+		address := strings.TrimSpace(r.URL.Query().Get("address"))
+		if address == "" {
+			// clears the choices of a cleared field
+			return
+		}
+		places, err := s.geocoder.Geocode(address, maxGeocodeResults)
+		if err != nil {
+			fmt.Fprintln(s.output, err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		err = s.templates(w, r).renderPartial(w, placeOptionsTemplate, places)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// resolveAddress fills in the coordinates of a form from its address, when they are left empty.
+func (s *Server) resolveAddress(address string, latitude, longitude *string) error {
+	address = strings.TrimSpace(address)
+	if s.geocoder == nil || address == "" || *latitude != "" || *longitude != "" {
+		return nil
+	}
+	places, err := s.geocoder.Geocode(address, 1)
+	if err != nil {
+		return err
+	}
+	if len(places) == 0 {
+		return fmt.Errorf("address %q not found, pick one of the suggestions or enter its coordinates", address)
+	}
+	*latitude = strconv.FormatFloat(places[0].Coordinate.Latitude, 'f', -1, 64)
+	*longitude = strconv.FormatFloat(places[0].Coordinate.Longitude, 'f', -1, 64)
+	return nil
+}
+
+// placeIndex is an offline Geocoder over places imported into a SQLite database, kept apart from
+// the guides so backups stay small and the dataset can be imported again.
+type placeIndex struct {
+	db *sql.DB
+}
+
+// OpenPlaceIndex opens the place database at path, creating it if needed.
+func OpenPlaceIndex(path string) (*placeIndex, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range []string{createPlaceTable, createPlaceKeyTable, createPlaceKeyIndex, createPlaceLocationIndex} {
+		_, err = db.Exec(stmt)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("not able to open place index %s: %w", path, err)
+		}
+	}
+	return &placeIndex{db: db}, nil
+}
+
+// placeIndexPath is the place database in GEOCODER_PATH, next to the database by default.
+func placeIndexPath(dbPath string) string {
+	if path := os.Getenv("GEOCODER_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(dbPath), placesFile)
+}
+
+// geocoderFromEnv is the place index of the database, nil when no places were imported.
+func geocoderFromEnv(dbPath string) (Geocoder, error) {
+	path := placeIndexPath(dbPath)
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return OpenPlaceIndex(path)
+}
+
+func (p *placeIndex) Geocode(query string, limit int) ([]place, error) {
+	key := placeKey(query)
+	if key == "" {
+		return []place{}, nil
+	}
+	// the keys starting with key sort between it and it followed by the last code point
+	rows, err := p.db.Query(searchPlaces, key, key+string(utf8.MaxRune), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	places := make([]place, 0)
+	for rows.Next() {
+		var pl place
+		err = rows.Scan(&pl.Name, &pl.Region, &pl.Coordinate.Latitude, &pl.Coordinate.Longitude)
+		if err != nil {
+			return nil, err
+		}
+		places = append(places, pl)
+	}
+	return places, rows.Err()
+}
+
+func (p *placeIndex) ReverseGeocode(c coordinate) (*place, error) {
+	// widen the search box until it has a place closer than its sides, no place outside it can be
+	// nearer then
+	deltas := []float64{0.01, 0.05, 0.25}
+	for i, delta := range deltas {
+		lonDelta := delta / math.Max(0.01, math.Cos(c.Latitude*math.Pi/180))
+		rows, err := p.db.Query(nearbyPlaces, c.Latitude-delta, c.Latitude+delta, c.Longitude-lonDelta, c.Longitude+lonDelta)
+		if err != nil {
+			return nil, err
+		}
+		var nearest *place
+		nearestKm := math.Inf(1)
+		for rows.Next() {
+			var pl place
+			err = rows.Scan(&pl.Name, &pl.Region, &pl.Coordinate.Latitude, &pl.Coordinate.Longitude)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if d := distance(c, pl.Coordinate); d < nearestKm {
+				nearest, nearestKm = &pl, d
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		if nearest == nil || (nearestKm > delta*kmPerDegree && i < len(deltas)-1) {
+			continue
+		}
+		if nearestKm > maxReverseGeocodeKm {
+			return nil, nil
+		}
+		return nearest, nil
+	}
+	return nil, nil
+}
+
+// Import adds the places of a GeoNames dump (tab-separated, like cities15000.txt) or an
+// OpenAddresses CSV, told apart by the OpenAddresses header, and returns how many were imported.
+// Places already in the index, with the same name, region and coordinates, are updated instead,
+// so importing a newer version of a dataset doesn't add them twice.
+func (p *placeIndex) Import(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len("LON,LAT"))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	next := nextGeoNamesPlace(br)
+	if strings.EqualFold(string(header), "LON,LAT") {
+		next, err = nextOpenAddressesPlace(br)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	count := 0
+	for {
+		pl, keys, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("place %d: %w", count+1, err)
+		}
+		var existing int64
+		err = tx.QueryRow(findPlace, pl.Coordinate.Latitude, pl.Coordinate.Longitude, pl.Name, pl.Region).Scan(&existing)
+		if err == nil {
+			_, err = tx.Exec(updatePlacePopulation, pl.population, existing)
+			if err != nil {
+				return 0, err
+			}
+			count++
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		rs, err := tx.Exec(insertPlace, pl.Name, pl.Region, pl.Coordinate.Latitude, pl.Coordinate.Longitude, pl.population)
+		if err != nil {
+			return 0, err
+		}
+		id, err := rs.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		added := map[string]bool{}
+		for _, k := range keys {
+			k = placeKey(k)
+			if k == "" || added[k] {
+				continue
+			}
+			added[k] = true
+			_, err = tx.Exec(insertPlaceKey, k, id)
+			if err != nil {
+				return 0, err
+			}
+		}
+		count++
+	}
+	return count, tx.Commit()
+}
+
+// importedPlace is a place read from a dataset, ranked by its population.
+type importedPlace struct {
+	place
+	population int64
+}
+
+// nextGeoNamesPlace reads the places of the GeoNames main table, searchable by their name and
+// ASCII name. The region is the country code.
+func nextGeoNamesPlace(r io.Reader) func() (importedPlace, []string, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	return func() (importedPlace, []string, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return importedPlace{}, nil, err
+		}
+		if len(record) < 15 {
+			return importedPlace{}, nil, fmt.Errorf("want at least 15 GeoNames columns, up to the population, got %d", len(record))
+		}
+		c, err := parseCoordinates(record[4], record[5])
+		if err != nil {
+			return importedPlace{}, nil, err
+		}
+		population, _ := strconv.ParseInt(record[14], 10, 64)
+		pl := importedPlace{place: place{Name: record[1], Region: record[8], Coordinate: c}, population: population}
+		return pl, []string{record[1], record[2]}, nil
+	}
+}
+
+// nextOpenAddressesPlace reads the addresses of an OpenAddresses CSV, searchable from their number
+// or their street.
+func nextOpenAddressesPlace(r io.Reader) (func() (importedPlace, []string, error), error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToUpper(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"LON", "LAT", "STREET"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("OpenAddresses CSV has no %s column", required)
+		}
+	}
+	column := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	return func() (importedPlace, []string, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return importedPlace{}, nil, err
+		}
+		c, err := parseCoordinates(column(record, "LAT"), column(record, "LON"))
+		if err != nil {
+			return importedPlace{}, nil, err
+		}
+		street := column(record, "STREET")
+		name := strings.TrimSpace(column(record, "NUMBER") + " " + street)
+		region := column(record, "CITY")
+		if postcode := column(record, "POSTCODE"); postcode != "" {
+			region = strings.TrimSpace(region + " " + postcode)
+		}
+		return importedPlace{place: place{Name: name, Region: region, Coordinate: c}}, []string{name, street}, nil
+	}, nil
+}
+
+// accentFolder spells the accented latin letters without their accents, so "Juarez" finds "Juárez".
+var accentFolder = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o", "õ", "o", "ø", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ñ", "n", "ç", "c", "ß", "ss",
+)
+
+// placeKey is the normalized form of a place name that searches match the start of.
+func placeKey(name string) string {
+	return strings.Join(strings.Fields(accentFolder.Replace(strings.ToLower(name))), " ")
+}
+
+const createPlaceTable = `
+CREATE TABLE IF NOT EXISTS place(
+Id INTEGER NOT NULL PRIMARY KEY,
+name TEXT NOT NULL,
+region TEXT NOT NULL,
+latitude REAL NOT NULL,
+longitude REAL NOT NULL,
+population INTEGER NOT NULL DEFAULT 0);`
+
+const createPlaceKeyTable = `
+CREATE TABLE IF NOT EXISTS place_key(
+key TEXT NOT NULL,
+placeId INTEGER NOT NULL,
+FOREIGN KEY(placeId) REFERENCES place(Id) ON DELETE CASCADE);`
+
+const createPlaceKeyIndex = `CREATE INDEX IF NOT EXISTS place_key_key ON place_key(key);`
+
+const createPlaceLocationIndex = `CREATE INDEX IF NOT EXISTS place_location ON place(latitude, longitude);`
+
+const insertPlace = `INSERT INTO place(name, region, latitude, longitude, population) VALUES (?, ?, ?, ?, ?);`
+
+const findPlace = `SELECT Id FROM place WHERE latitude = ? AND longitude = ? AND name = ? AND region = ?`
+
+const updatePlacePopulation = `UPDATE place SET population = ? WHERE Id = ?`
+
+const insertPlaceKey = `INSERT INTO place_key(key, placeId) VALUES (?, ?);`
+
+const searchPlaces = `SELECT place.name, place.region, place.latitude, place.longitude FROM place WHERE place.Id IN (SELECT placeId FROM place_key WHERE key >= ? AND key < ?) ORDER BY place.population DESC, place.name LIMIT ?`
+
+const nearbyPlaces = `SELECT name, region, latitude, longitude FROM place WHERE latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?`
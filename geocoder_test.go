@@ -0,0 +1,197 @@
+package guide_test
+
+import (
+	"bytes"
+	"guide"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// geoNamesCities has the GeoNames columns up to the population, the rest are not read.
+const geoNamesCities = "3522507\tOaxaca de Juárez\tOaxaca de Juarez\tOaxaca\t17.06542\t-96.72365\tP\tPPLA\tMX\t\t20\t\t\t\t258913\n" +
+	"3522509\tOaxaca\tOaxaca\t\t17.0\t-96.5\tA\tADM1\tMX\t\t20\t\t\t\t3801962\n" +
+	"3530597\tMexico City\tMexico City\tCDMX\t19.42847\t-99.12766\tP\tPPLC\tMX\t\t09\t\t\t\t12294193\n"
+
+const openAddresses = "LON,LAT,NUMBER,STREET,UNIT,CITY,DISTRICT,REGION,POSTCODE,ID,HASH\n" +
+	"-96.72532,17.06104,100,Avenida de la Independencia,,Oaxaca de Juárez,,OAX,68000,,abc\n"
+
+func newPlaceIndex(t *testing.T) guide.Geocoder {
+	t.Helper()
+	places, err := guide.OpenPlaceIndex(filepath.Join(t.TempDir(), "places.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dataset := range []string{geoNamesCities, openAddresses} {
+		_, err = places.Import(strings.NewReader(dataset))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return places
+}
+
+func TestPlaceIndexGeocodes(t *testing.T) {
+	t.Parallel()
+	places := newPlaceIndex(t)
+	testCases := map[string][]string{
+		"oax":                 {"Oaxaca, MX", "Oaxaca de Juárez, MX"},
+		"Oaxaca de Juar":      {"Oaxaca de Juárez, MX"},
+		"  oaxaca   DE juár ": {"Oaxaca de Juárez, MX"},
+		"mexico":              {"Mexico City, MX"},
+		"100 avenida":         {"100 Avenida de la Independencia, Oaxaca de Juárez 68000"},
+		"avenida de la":       {"100 Avenida de la Independencia, Oaxaca de Juárez 68000"},
+		"paris":               {},
+		"%":                   {},
+	}
+	for query, want := range testCases {
+		got, err := places.Geocode(query, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		labels := []string{}
+		for _, p := range got {
+			labels = append(labels, p.Label())
+		}
+		if strings.Join(labels, "|") != strings.Join(want, "|") {
+			t.Errorf("%q: want %q, got %q", query, want, labels)
+		}
+	}
+}
+
+func TestPlaceIndexReverseGeocodes(t *testing.T) {
+	t.Parallel()
+	places := newPlaceIndex(t)
+	testCases := []struct {
+		latitude, longitude float64
+		want                string
+	}{
+		{17.0611, -96.7254, "100 Avenida de la Independencia, Oaxaca de Juárez 68000"},
+		{17.0700, -96.7100, "Oaxaca de Juárez, MX"},
+		{19.4000, -99.1000, "Mexico City, MX"},
+		{48.8566, 2.3522, ""},
+	}
+	for _, tc := range testCases {
+		c, err := guide.NewPointOfInterest("here", 1, guide.PoiWithValidStringCoordinates(strconv.FormatFloat(tc.latitude, 'f', -1, 64), strconv.FormatFloat(tc.longitude, 'f', -1, 64)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := places.ReverseGeocode(c.Coordinate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if p != nil {
+			got = p.Label()
+		}
+		if got != tc.want {
+			t.Errorf("%v, %v: want %q, got %q", tc.latitude, tc.longitude, tc.want, got)
+		}
+	}
+}
+
+func TestGeocodingForms(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	provisioned := newProvisionedServerWithStore(storage, t)
+	server, err := guide.NewServer(":8080", storage, io.Discard, guide.WithGeocoder(newPlaceIndex(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(s *guide.Server, method, target string, form url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		s.Routes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send(&server, http.MethodGet, "/geocode?address=oaxaca+de", nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Oaxaca de Juárez, MX") {
+		t.Errorf("want place choices, got status %d %q", rr.Code, rr.Body.String())
+	}
+	for _, form := range []string{"/guide/create", "/guide/1/poi/create"} {
+		if !strings.Contains(send(&server, http.MethodGet, form, nil).Body.String(), `name="address"`) {
+			t.Errorf("%s: want address field", form)
+		}
+		if strings.Contains(send(provisioned, http.MethodGet, form, nil).Body.String(), `name="address"`) {
+			t.Errorf("%s: want no address field without geocoder", form)
+		}
+	}
+	if rr := send(provisioned, http.MethodGet, "/geocode?address=oaxaca", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("want geocoding not found without geocoder, got %d", rr.Code)
+	}
+
+	rr = send(&server, http.MethodPost, "/guide/create", url.Values{"name": {"Oaxaca"}, "address": {"oaxaca de juarez"}})
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("want guide created from its address, got status %d %q", rr.Code, rr.Body.String())
+	}
+	g, err := storage.GetGuidebyID(4)
+	if err != nil || g == nil {
+		t.Fatalf("want guide 4 created, got %v", err)
+	}
+	if g.Coordinate.Latitude != 17.06542 || g.Coordinate.Longitude != -96.72365 {
+		t.Errorf("want guide at the coordinates of its address, got %v", g.Coordinate)
+	}
+	rr = send(&server, http.MethodPost, "/guide/4/poi/create", url.Values{"name": {"Zocalo"}, "address": {"nowhere"}})
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "not found") {
+		t.Errorf("want unknown address rejected, got status %d", rr.Code)
+	}
+	rr = send(&server, http.MethodPost, "/guide/4/poi/create", url.Values{"name": {"Zocalo"}, "address": {"100 avenida"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want poi created from its address, got status %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = send(&server, http.MethodGet, "/guide/4/poi/10", nil)
+	if !strings.Contains(rr.Body.String(), "Near 100 Avenida de la Independencia") {
+		t.Errorf("want poi view with its address, got %q", rr.Body.String())
+	}
+}
+
+func TestRunCommandImportPlaces(t *testing.T) {
+	openDBPathStorage(t)
+	input := filepath.Join(t.TempDir(), "cities15000.txt")
+	err := os.WriteFile(input, []byte(geoNamesCities), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	placesPath := filepath.Join(t.TempDir(), "places.db")
+	t.Setenv("GEOCODER_PATH", placesPath)
+	var output bytes.Buffer
+	err = guide.RunCommand([]string{"import-places", input}, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "imported 3 places") {
+		t.Errorf("want imported places reported, got %q", output.String())
+	}
+	places, err := guide.OpenPlaceIndex(placesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := places.Geocode("mexico", 1)
+	if err != nil || len(got) != 1 {
+		t.Errorf("want imported place found, got %v %v", got, err)
+	}
+
+	err = guide.RunCommand([]string{"import-places", input}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = places.Geocode("oaxaca", 5)
+	if err != nil || len(got) != 2 {
+		t.Errorf("want places imported again not duplicated, got %v %v", got, err)
+	}
+
+	err = guide.RunCommand([]string{"import-places", filepath.Join(t.TempDir(), "missing.txt")}, io.Discard)
+	if err == nil {
+		t.Error("want error importing a missing file")
+	}
+}
@@ -0,0 +1,174 @@
+package guide
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// geoJSONFeatureCollection is a GeoJSON(RFC 7946) FeatureCollection. BBox is the area covered by
+// the features as [west, south, east, north].
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	BBox     []float64        `json:"bbox,omitempty"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   geoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// geoJSONGeometry is any geometry, we only write and read Points. Coordinates are decoded once
+// the geometry is known to be a Point, their shape depends on the type.
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// newGeoJSONPoint returns a Point geometry, GeoJSON positions are [longitude, latitude].
+func newGeoJSONPoint(c coordinate) geoJSONGeometry {
+	position, _ := json.Marshal([]float64{c.Longitude, c.Latitude})
+	return geoJSONGeometry{Type: "Point", Coordinates: position}
+}
+
+// coordinate validates the geometry is a Point within the coordinate ranges.
+func (g geoJSONGeometry) coordinate() (coordinate, error) {
+	if g.Type != "Point" {
+		return coordinate{}, fmt.Errorf("geometry has to be a Point, got %q", g.Type)
+	}
+	var position []float64
+	err := json.Unmarshal(g.Coordinates, &position)
+	if err != nil || len(position) < 2 {
+		return coordinate{}, errors.New("point has to have longitude and latitude")
+	}
+	return newCoordinate(position[1], position[0])
+}
+
+func newGeoJSONFeatureCollection(features ...geoJSONFeature) geoJSONFeatureCollection {
+	return geoJSONFeatureCollection{Type: "FeatureCollection", Features: append([]geoJSONFeature{}, features...)}
+}
+
+const (
+	geoJSONKindGuide = "guide"
+	geoJSONKindPoi   = "poi"
+)
+
+func guideFeature(g guide) geoJSONFeature {
+	return geoJSONFeature{
+		Type:     "Feature",
+		Geometry: newGeoJSONPoint(g.Coordinate),
+		Properties: map[string]any{
+			"kind":        geoJSONKindGuide,
+			"id":          g.Id,
+			"name":        g.Name,
+			"description": g.Description,
+		},
+	}
+}
+
+func poiFeature(p pointOfInterest) geoJSONFeature {
+	return geoJSONFeature{
+		Type:     "Feature",
+		Geometry: newGeoJSONPoint(p.Coordinate),
+		Properties: map[string]any{
+			"kind":        geoJSONKindPoi,
+			"id":          p.Id,
+			"guide_id":    p.GuideID,
+			"name":        p.Name,
+			"description": p.Description,
+			"category":    p.Category,
+		},
+	}
+}
+
+// guideFeatureCollection is the guide center followed by one feature per poi, bounded by the
+// area they cover.
+func guideFeatureCollection(g guide) geoJSONFeatureCollection {
+	features := []geoJSONFeature{guideFeature(g)}
+	west, south, east, north := g.Coordinate.Longitude, g.Coordinate.Latitude, g.Coordinate.Longitude, g.Coordinate.Latitude
+	for _, poi := range g.Pois {
+		features = append(features, poiFeature(poi))
+		west, east = math.Min(west, poi.Coordinate.Longitude), math.Max(east, poi.Coordinate.Longitude)
+		south, north = math.Min(south, poi.Coordinate.Latitude), math.Max(north, poi.Coordinate.Latitude)
+	}
+	fc := newGeoJSONFeatureCollection(features...)
+	fc.BBox = []float64{west, south, east, north}
+	return fc
+}
+
+// WriteGuideGeoJSON exports the guide and its pois as a GeoJSON FeatureCollection.
+func WriteGuideGeoJSON(w io.Writer, g guide) error {
+	return json.NewEncoder(w).Encode(guideFeatureCollection(g))
+}
+
+// ReadGuideGeoJSON reads a guide exported by WriteGuideGeoJSON, the reverse of it.
+func ReadGuideGeoJSON(r io.Reader) (guide, error) {
+	var fc geoJSONFeatureCollection
+	err := json.NewDecoder(r).Decode(&fc)
+	if err != nil {
+		return guide{}, fmt.Errorf("not able to parse GeoJSON: %w", err)
+	}
+	if fc.Type != "FeatureCollection" {
+		return guide{}, fmt.Errorf("GeoJSON has to be a FeatureCollection, got %q", fc.Type)
+	}
+
+	var g *guide
+	pois := make([]pointOfInterest, 0)
+	for i, f := range fc.Features {
+		c, err := f.Geometry.coordinate()
+		if err != nil {
+			return guide{}, fmt.Errorf("feature %d: %w", i, err)
+		}
+		switch stringProperty(f.Properties, "kind") {
+		case geoJSONKindGuide:
+			parsed, err := NewGuide(stringProperty(f.Properties, "name"), WithDescription(stringProperty(f.Properties, "description")))
+			if err != nil {
+				return guide{}, fmt.Errorf("feature %d: %w", i, err)
+			}
+			parsed.Id = idProperty(f.Properties, "id")
+			parsed.Coordinate = c
+			g = &parsed
+		case geoJSONKindPoi:
+			poi, err := NewPointOfInterest(stringProperty(f.Properties, "name"), idProperty(f.Properties, "guide_id"),
+				PoiWithDescription(stringProperty(f.Properties, "description")),
+				PoiWithCategory(stringProperty(f.Properties, "category")))
+			if err != nil {
+				return guide{}, fmt.Errorf("feature %d: %w", i, err)
+			}
+			poi.Id = idProperty(f.Properties, "id")
+			poi.Coordinate = c
+			pois = append(pois, poi)
+		}
+	}
+	if g == nil {
+		return guide{}, errors.New("GeoJSON has no guide feature")
+	}
+	g.Pois = pois
+	return *g, nil
+}
+
+// stringProperty returns the property as a string, "" when it is missing or isn't a string,
+// number or boolean.
+func stringProperty(properties map[string]any, key string) string {
+	switch v := properties[key].(type) {
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	default:
+		return ""
+	}
+}
+
+// idProperty returns the property as an ID, 0 when it is missing or not a whole number.
+func idProperty(properties map[string]any, key string) int64 {
+	n, ok := properties[key].(float64)
+	if !ok || n != math.Trunc(n) {
+		return 0
+	}
+	return int64(n)
+}
@@ -0,0 +1,129 @@
+package guide_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"guide"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGuideGeoJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+	g, err := guide.NewGuide("Oaxaca", guide.WithValidStringCoordinates("17.0654", "-96.7236"), guide.WithDescription("Mezcal and *mole*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Id = 7
+	market, err := guide.NewPointOfInterest("Mercado 20 de Noviembre", g.Id, guide.PoiWithValidStringCoordinates("17.0588", "-96.7266"),
+		guide.PoiWithDescription("Smoke alley"), guide.PoiWithCategory("food"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	market.Id = 1
+	temple, err := guide.NewPointOfInterest("Santo Domingo", g.Id, guide.PoiWithValidStringCoordinates("17.0656", "-96.7233"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	temple.Id = 2
+	g.Pois = append(g.Pois, market, temple)
+
+	var b bytes.Buffer
+	err = guide.WriteGuideGeoJSON(&b, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := guide.ReadGuideGeoJSON(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g, got) {
+		t.Errorf("want %+v, got %+v", g, got)
+	}
+}
+
+func TestGuideGeoJSONHasBoundingBoxAndCategories(t *testing.T) {
+	t.Parallel()
+	g, err := guide.NewGuide("Oaxaca", guide.WithValidStringCoordinates("17", "-96"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Id = 1
+	poi, err := guide.NewPointOfInterest("Monte Alban", g.Id, guide.PoiWithValidStringCoordinates("16", "-97"), guide.PoiWithCategory("ruins"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Pois = append(g.Pois, poi)
+
+	var b bytes.Buffer
+	err = guide.WriteGuideGeoJSON(&b, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fc struct {
+		BBox     []float64
+		Features []struct{ Properties map[string]any }
+	}
+	err = json.NewDecoder(&b).Decode(&fc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{-97, 16, -96, 17}
+	if !reflect.DeepEqual(fc.BBox, want) {
+		t.Errorf("want bbox %v, got %v", want, fc.BBox)
+	}
+	if fc.Features[1].Properties["category"] != "ruins" {
+		t.Errorf("want poi category ruins, got %v", fc.Features[1].Properties["category"])
+	}
+}
+
+func TestReadGuideGeoJSONErrors(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{
+		"not json":           `{"type":`,
+		"not a collection":   `{"type":"Feature"}`,
+		"no guide":           `{"type":"FeatureCollection","features":[]}`,
+		"invalid latitude":   `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[10,91]},"properties":{"kind":"guide","name":"g"}}]}`,
+		"not a point":        `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"LineString","coordinates":[[10,10],[11,11]]},"properties":{"kind":"guide","name":"g"}}]}`,
+		"guide without name": `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[10,10]},"properties":{"kind":"guide"}}]}`,
+	}
+	for name, input := range testCases {
+		_, err := guide.ReadGuideGeoJSON(strings.NewReader(input))
+		if err == nil {
+			t.Errorf("%s: want error, got nil", name)
+		}
+	}
+}
+
+func TestGuideGeoJSONHandler(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	routes := server.Routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/guide/1.geojson", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Header().Get("Content-Type") != "application/geo+json" {
+		t.Errorf("want GeoJSON content type, got %s", rr.Header().Get("Content-Type"))
+	}
+	g, err := guide.ReadGuideGeoJSON(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Id != 1 || len(g.Pois) != 3 {
+		t.Errorf("want guide 1 with 3 pois, got guide %d with %d pois", g.Id, len(g.Pois))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/guide/42.geojson", nil)
+	rr = httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("want status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,174 @@
+package guide
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const gpxNamespace = "http://www.topografix.com/GPX/1/1"
+
+// gpx is a GPX 1.1 document, the format of GPS devices and hiking and cycling apps.
+type gpx struct {
+	XMLName   xml.Name    `xml:"gpx"`
+	Xmlns     string      `xml:"xmlns,attr"`
+	Version   string      `xml:"version,attr"`
+	Creator   string      `xml:"creator,attr"`
+	Metadata  gpxMetadata `xml:"metadata"`
+	Waypoints []gpxPoint  `xml:"wpt"`
+	Routes    []gpxRoute  `xml:"rte"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name"`
+	Desc string `xml:"desc,omitempty"`
+}
+
+// gpxPoint is a wpt, rtept or trkpt. Coordinates are strings so imports validate them like form input.
+type gpxPoint struct {
+	Lat  string `xml:"lat,attr"`
+	Lon  string `xml:"lon,attr"`
+	Name string `xml:"name,omitempty"`
+	Desc string `xml:"desc,omitempty"`
+	Type string `xml:"type,omitempty"`
+}
+
+type gpxRoute struct {
+	Name   string     `xml:"name"`
+	Points []gpxPoint `xml:"rtept"`
+}
+
+func newGPXPoint(p pointOfInterest) gpxPoint {
+	return gpxPoint{
+		Lat:  strconv.FormatFloat(p.Coordinate.Latitude, 'f', -1, 64),
+		Lon:  strconv.FormatFloat(p.Coordinate.Longitude, 'f', -1, 64),
+		Name: p.Name,
+		Desc: p.Description,
+		Type: p.Category,
+	}
+}
+
+// WriteGuideGPX exports the guide pois as waypoints and its itineraries, with their pois in
+// visiting order, as routes.
+func WriteGuideGPX(w io.Writer, g guide) error {
+	doc := gpx{
+		Xmlns:     gpxNamespace,
+		Version:   "1.1",
+		Creator:   "CityGuide",
+		Metadata:  gpxMetadata{Name: g.Name, Desc: g.Description},
+		Waypoints: make([]gpxPoint, 0, len(g.Pois)),
+		Routes:    make([]gpxRoute, 0, len(g.Itineraries)),
+	}
+	for _, poi := range g.Pois {
+		doc.Waypoints = append(doc.Waypoints, newGPXPoint(poi))
+	}
+	for _, i := range g.Itineraries {
+		route := gpxRoute{Name: i.Name, Points: make([]gpxPoint, 0, len(i.Pois))}
+		for _, poi := range i.Pois {
+			route.Points = append(route.Points, newGPXPoint(poi))
+		}
+		doc.Routes = append(doc.Routes, route)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+// readGPXImportRows reads one row per waypoint, route point and track point of a GPX file. The
+// points of each route and track become an itinerary named after it, in their order, and the
+// unnamed ones are named after it and their position, like "Hike 3". The file is decoded point by
+// point, so large tracks don't have to fit in memory.
+func readGPXImportRows(r io.Reader, form importForm) ([]importRow, error) {
+	dec := xml.NewDecoder(r)
+	rows := make([]importRow, 0)
+	foundGPX := false
+	// route is the itinerary of the route or track being read, named after it once its name is read
+	var route string
+	routes, tracks, points := 0, 0, 0
+	itineraries := map[string]int{}
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not able to parse GPX: %w", err)
+		}
+		if end, ok := token.(xml.EndElement); ok && (end.Name.Local == "rte" || end.Name.Local == "trk") {
+			route = ""
+			continue
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "gpx":
+			foundGPX = true
+		case "rte":
+			routes++
+			route, points = fmt.Sprintf("Route %d", routes), 0
+		case "trk":
+			tracks++
+			route, points = fmt.Sprintf("Track %d", tracks), 0
+		case "name":
+			// the names of points are decoded with them, this is the one of a route or track
+			if route == "" {
+				continue
+			}
+			var name string
+			err = dec.DecodeElement(&name, &start)
+			if err != nil {
+				return nil, fmt.Errorf("not able to parse GPX: %w", err)
+			}
+			if name = strings.TrimSpace(name); name != "" {
+				route = name
+			}
+		case "wpt", "rtept", "trkpt":
+			var p gpxPoint
+			err = dec.DecodeElement(&p, &start)
+			if err != nil {
+				return nil, fmt.Errorf("not able to parse GPX: %w", err)
+			}
+			row := importRow{
+				Number:      len(rows) + 1,
+				Name:        strings.TrimSpace(p.Name),
+				Description: strings.TrimSpace(p.Desc),
+				Category:    strings.TrimSpace(p.Type),
+				Latitude:    p.Lat,
+				Longitude:   p.Lon,
+			}
+			if start.Name.Local != "wpt" && route != "" {
+				if points == 0 {
+					// routes with the same name become different itineraries
+					itineraries[route]++
+					if n := itineraries[route]; n > 1 {
+						route = fmt.Sprintf("%s (%d)", route, n)
+					}
+				}
+				points++
+				row.Itinerary = route
+				if row.Name == "" {
+					row.Name = fmt.Sprintf("%s %d", route, points)
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	if !foundGPX {
+		return nil, errors.New("not able to parse GPX: gpx element is missing")
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("GPX has no waypoints, routes or tracks")
+	}
+	validateImportRows(rows, form.GuideID, form.catalog)
+	return rows, nil
+}
@@ -0,0 +1,193 @@
+package guide_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"guide"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type gpxDocument struct {
+	Name      string `xml:"metadata>name"`
+	Waypoints []struct {
+		Lat  float64 `xml:"lat,attr"`
+		Lon  float64 `xml:"lon,attr"`
+		Name string  `xml:"name"`
+		Type string  `xml:"type"`
+	} `xml:"wpt"`
+	Routes []struct {
+		Name   string `xml:"name"`
+		Points []struct {
+			Name string `xml:"name"`
+		} `xml:"rtept"`
+	} `xml:"rte"`
+}
+
+func TestWriteGuideGPX(t *testing.T) {
+	t.Parallel()
+	g, err := guide.NewGuide("Oaxaca & around", guide.WithValidStringCoordinates("17", "-96"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Id = 1
+	market, err := guide.NewPointOfInterest("Mercado <20>", g.Id, guide.PoiWithValidStringCoordinates("17.0588", "-96.7266"), guide.PoiWithCategory("food"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	temple, err := guide.NewPointOfInterest("Santo Domingo", g.Id, guide.PoiWithValidStringCoordinates("17.0656", "-96.7233"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Pois = append(g.Pois, market, temple)
+	walk, err := guide.NewItinerary("Walk", g.Id, guide.ItineraryWithPois(temple, market))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Itineraries = append(g.Itineraries, walk)
+
+	var b bytes.Buffer
+	err = guide.WriteGuideGPX(&b, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got gpxDocument
+	err = xml.Unmarshal(b.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != g.Name {
+		t.Errorf("want name %q, got %q", g.Name, got.Name)
+	}
+	if len(got.Waypoints) != 2 || got.Waypoints[0].Name != "Mercado <20>" || got.Waypoints[0].Lat != 17.0588 || got.Waypoints[0].Lon != -96.7266 || got.Waypoints[0].Type != "food" {
+		t.Errorf("want 2 waypoints starting with Mercado, got %+v", got.Waypoints)
+	}
+	if len(got.Routes) != 1 || len(got.Routes[0].Points) != 2 || got.Routes[0].Points[0].Name != "Santo Domingo" {
+		t.Errorf("want the walk route in visiting order, got %+v", got.Routes)
+	}
+}
+
+func TestGuideGPXHandler(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/guide/1.gpx", nil)
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var got gpxDocument
+	err := xml.Unmarshal(rr.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Waypoints) != 3 || len(got.Routes) != 1 {
+		t.Errorf("want 3 waypoints and 1 route, got %d and %d", len(got.Waypoints), len(got.Routes))
+	}
+}
+
+const importGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="17.0588" lon="-96.7266"><name>Mercado</name><desc>Smoke alley</desc><type>food</type></wpt>
+  <wpt lat="97.0588" lon="-96.7266"><name>Out of range</name></wpt>
+  <wpt lat="17.0588" lon="-96.7266"></wpt>
+  <trk><name>Hike</name><trkseg>
+    <trkpt lat="17.04" lon="-96.76"></trkpt>
+    <trkpt lat="17.05" lon="-96.77"><name>Viewpoint</name></trkpt>
+    <trkpt lat="17.06" lon="-96.78"></trkpt>
+  </trkseg></trk>
+</gpx>`
+
+func TestImportGPXPreview(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	req := newImportRequest(t, "/guide/1/import", "hike.GPX", importGPX, nil)
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"Mercado", `value="Smoke alley"`, `value="food"`, "Viewpoint", `value="Hike 1"`, `value="Hike 3"`, `name="itinerary" value="Hike"`, "latitude has to be in the", "poi name cannot be empty", "Import 4 points of interest"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want preview to contain %q", want)
+		}
+	}
+}
+
+func TestImportGPXErrors(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	testCases := map[string]string{
+		"not xml":   `<gpx><wpt`,
+		"not gpx":   `<kml></kml>`,
+		"no points": `<gpx><metadata><name>Empty</name></metadata><trk><name>Hike</name></trk></gpx>`,
+	}
+	for name, input := range testCases {
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/1/import", "file.gpx", input, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: want status %d, got %d", name, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+func TestImportGPXCommitCreatesItineraries(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	server := newProvisionedServerWithStore(storage, t)
+	input := `<gpx>
+  <rte><name>Walk</name>
+    <rtept lat="17.06" lon="-96.72"><name>Zócalo</name></rtept>
+    <rtept lat="17.07" lon="-96.72"><name>Santo Domingo</name></rtept>
+  </rte>
+  <trk><trkseg>
+    <trkpt lat="17.04" lon="-96.76"></trkpt>
+    <trkpt lat="17.05" lon="-96.77"></trkpt>
+  </trkseg></trk>
+  <rte><name>Walk</name><rtept lat="17.08" lon="-96.72"></rtept></rte>
+</gpx>`
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/1/import", "walks.gpx", input, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want preview, got status %d", rr.Code)
+	}
+	// the commit form of the preview
+	form := url.Values{}
+	for _, input := range regexp.MustCompile(`<input type="hidden" name="(\w+)" value="([^"]*)">`).FindAllStringSubmatch(rr.Body.String(), -1) {
+		form.Add(input[1], html.UnescapeString(input[2]))
+	}
+	req := httptest.NewRequest(http.MethodPost, "/guide/1/import/commit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("want status %d, got %d %q", http.StatusSeeOther, rr.Code, rr.Body.String())
+	}
+
+	want := map[string][]string{
+		"Walk":     {"Zócalo", "Santo Domingo"},
+		"Track 1":  {"Track 1 1", "Track 1 2"},
+		"Walk (2)": {"Walk (2) 1"},
+	}
+	got := map[string][]string{}
+	for _, i := range storage.GetAllItineraries(1) {
+		full, err := storage.GetItinerary(1, i.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, poi := range full.Pois {
+			got[i.Name] = append(got[i.Name], poi.Name)
+		}
+	}
+	for name, stops := range want {
+		if strings.Join(got[name], "|") != strings.Join(stops, "|") {
+			t.Errorf("want itinerary %s with stops %q, got %q", name, stops, got[name])
+		}
+	}
+}
@@ -2,8 +2,8 @@ package guide
 
 import (
 	_ "embed"
-	"errors"
 	"strconv"
+	"strings"
 )
 
 func WithValidStringCoordinates(latitude, longitude string) guideOption {
@@ -25,6 +25,22 @@ func WithDescription(description string) guideOption {
 	}
 }
 
+// WithLanguage sets the locale the guide is written in, like en or pt-BR. It can be empty.
+func WithLanguage(language string) guideOption {
+	return func(g *guide) error {
+		if strings.TrimSpace(language) == "" {
+			g.Language = ""
+			return nil
+		}
+		locale, err := parseLocale(language)
+		if err != nil {
+			return newValidationError("language", errLocaleInvalid)
+		}
+		g.Language = locale
+		return nil
+	}
+}
+
 func PoiWithValidStringCoordinates(latitude, longitude string) poiOption {
 	return func(poi *pointOfInterest) error {
 		coordinate, err := parseCoordinates(latitude, longitude)
@@ -43,58 +59,101 @@ func PoiWithDescription(description string) poiOption {
 	}
 }
 
+// PoiWithCategory groups the poi with others of the same kind, e.g. "food" or "museums".
+func PoiWithCategory(category string) poiOption {
+	return func(poi *pointOfInterest) error {
+		poi.Category = strings.TrimSpace(category)
+		return nil
+	}
+}
+
 type guide struct {
-	Id          int64
-	Name        string
+	Id   int64
+	Name string
+	// Slug names the guide in its permalink, /g/{slug}. The store keeps it unique.
+	Slug        string
 	Description string
 	Coordinate  coordinate
 	Pois        []pointOfInterest
+	Itineraries []itinerary
+
+	// OwnerID is the user that created the guide, 0 for guides created anonymously.
+	OwnerID int64
+	// ForkedFromID is the upstream guide this guide was forked from, 0 if it isn't a fork.
+	ForkedFromID   int64
+	ForkedFromName string
+	ForkedFromSlug string
+	// CityID is the city the guide covers, 0 if it isn't in one.
+	CityID   int64
+	CityName string
+	CitySlug string
+	// Language is the locale of the name and description, empty if it isn't known. Locales are the
+	// locales the guide is translated to, and Locale the one it is shown in, empty for Language.
+	Language string
+	Locales  []string
+	Locale   string
 
 	// guide.mapArea/coordinates}
 }
 
+// guidePage is the data of the guide page. Focus is the poi to open, from its permalink.
+type guidePage struct {
+	guide
+	Focus *pointOfInterest
+}
+
 type coordinate struct {
 	Latitude, Longitude float64
 }
 
 func newCoordinate(latitude, longitude float64) (coordinate, error) {
+	var errs validationErrors
 	if latitude < -90 || latitude > 90 {
-		return coordinate{}, errors.New("latitude has to be in the -90°, 90° range")
+		errs.collect(newValidationError("latitude", errLatitudeOutOfRange))
 	}
 	if longitude < -180 || longitude > 180 {
-		return coordinate{}, errors.New("longitude has to be in the -90°, 90° range")
+		errs.collect(newValidationError("longitude", errLongitudeOutOfRange))
+	}
+	if err := errs.err(); err != nil {
+		return coordinate{}, err
 	}
 	return coordinate{Latitude: latitude, Longitude: longitude}, nil
 }
 
+// parseCoordinates validates both coordinates, with the errors of each one.
 func parseCoordinates(latitude, longitude string) (coordinate, error) {
-	if latitude == "" {
-		return coordinate{}, errors.New("latitude cannot be empty")
-	}
-	if longitude == "" {
-		return coordinate{}, errors.New("longitude cannot be empty")
+	var errs validationErrors
+	lat, err := parseDegrees(latitude, "latitude", errLatitudeEmpty, errLatitudeNotNumber)
+	errs.collect(err)
+	lon, err := parseDegrees(longitude, "longitude", errLongitudeEmpty, errLongitudeNotNumber)
+	errs.collect(err)
+	// coordinates that aren't numbers are 0 here, only the ones out of range add errors
+	coord, err := newCoordinate(lat, lon)
+	errs.collect(err)
+	if err := errs.err(); err != nil {
+		return coordinate{}, err
 	}
+	return coord, nil
+}
 
-	lat, err := strconv.ParseFloat(latitude, 64)
-	if err != nil {
-		return coordinate{}, errors.New("latitude has to be a number")
+// parseDegrees parses the coordinate of field, failing with the empty or notNumber codes.
+func parseDegrees(degrees, field string, empty, notNumber errorCode) (float64, error) {
+	if degrees == "" {
+		return 0, newValidationError(field, empty)
 	}
-	lon, err := strconv.ParseFloat(longitude, 64)
+	d, err := strconv.ParseFloat(degrees, 64)
 	if err != nil {
-		return coordinate{}, errors.New("longitude has to be a number")
+		return 0, newValidationError(field, notNumber)
 	}
-	coord, err := newCoordinate(lat, lon)
-	if err != nil {
-		return coordinate{}, err
-	}
-	return coord, nil
+	return d, nil
 }
 
 type guideOption func(*guide) error
 
 func NewGuide(name string, opts ...guideOption) (guide, error) {
+	var errs validationErrors
 	if name == "" {
-		return guide{}, errors.New("guide name cannot be empty")
+		errs.collect(newValidationError("name", errGuideNameEmpty))
 	}
 	g := guide{
 		Name: name,
@@ -103,10 +162,13 @@ func NewGuide(name string, opts ...guideOption) (guide, error) {
 
 	for _, opt := range opts {
 		err := opt(&g)
-		if err != nil {
+		if !errs.collect(err) {
 			return guide{}, err
 		}
 	}
+	if err := errs.err(); err != nil {
+		return guide{}, err
+	}
 	return g, nil
 }
 
@@ -119,6 +181,10 @@ type pointOfInterest struct {
 	Coordinate  coordinate
 	Name        string
 	Description string
+	Category    string
+	// Slug names the poi in its permalink, /g/{guide slug}/{slug}, unique within its guide.
+	Slug      string
+	GuideSlug string
 }
 
 // IsBounded determines if a pointOfInterest is bounded within guide.mapArea/coordinates
@@ -129,11 +195,12 @@ func (p pointOfInterest) IsBounded() bool {
 type poiOption func(*pointOfInterest) error
 
 func NewPointOfInterest(name string, guideID int64, opts ...poiOption) (pointOfInterest, error) {
+	var errs validationErrors
 	if name == "" {
-		return pointOfInterest{}, errors.New("poi name cannot be empty")
+		errs.collect(newValidationError("name", errPoiNameEmpty))
 	}
 	if guideID <= 0 {
-		return pointOfInterest{}, errors.New("guide ID cannot be empty")
+		errs.collect(newValidationError("", errGuideIDEmpty))
 	}
 	poi := pointOfInterest{
 		Name:    name,
@@ -142,28 +209,40 @@ func NewPointOfInterest(name string, guideID int64, opts ...poiOption) (pointOfI
 
 	for _, opt := range opts {
 		err := opt(&poi)
-		if err != nil {
+		if !errs.collect(err) {
 			return pointOfInterest{}, err
 		}
 	}
+	if err := errs.err(); err != nil {
+		return pointOfInterest{}, err
+	}
 	return poi, nil
 }
 
 type guideForm struct {
 	GuideId                                int64
 	Name, Description, Latitude, Longitude string
-	Errors                                 []string
+	// Language is the locale the guide is written in.
+	Language string
+	// Address is geocoded into the coordinates when they are left empty.
+	Address string
+	cityChoice
+	formErrors
 }
 
 type poiForm struct {
 	PoiID                                  int64
 	GuideID                                int64
 	GuideName                              string
+	GuideSlug                              string
 	Name, Description, Latitude, Longitude string
-	Errors                                 []string
+	Category                               string
+	// Address is geocoded into the coordinates when they are left empty.
+	Address string
+	formErrors
 }
 
 type userForm struct {
 	Username, Password, ConfirmPassword, Email string
-	Errors                                     []string
+	formErrors
 }
@@ -0,0 +1,136 @@
+package guide
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// defaultUILocale is the locale of the interface when the request accepts none of uiLocales, the
+// templates and error messages are written in it.
+const defaultUILocale = "en"
+
+//go:embed locales
+var localesFS embed.FS
+
+// catalog translates the messages of the interface to a locale. The keys are the English messages
+// of the templates, and the codes of the validation errors.
+type catalog map[string]string
+
+// catalogs are the message catalogs by locale, read from locales/{locale}.json. The default
+// locale has none, its messages are the keys.
+var catalogs = mustLoadCatalogs()
+
+// uiLocales are the locales the interface is translated to, the default one first.
+var uiLocales = func() []string {
+	locales := []string{defaultUILocale}
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales[1:])
+	return locales
+}()
+
+func mustLoadCatalogs() map[string]catalog {
+	entries, err := localesFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := map[string]catalog{}
+	for _, entry := range entries {
+		locale, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		b, err := localesFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		c := catalog{}
+		err = json.Unmarshal(b, &c)
+		if err != nil {
+			panic(fmt.Errorf("not able to read the %s catalog: %w", locale, err))
+		}
+		catalogs[locale] = c
+	}
+	return catalogs
+}
+
+// translate is message in the locale of the catalog, or message itself when it isn't translated.
+// Messages with args are formats, like "Itinerary of %s".
+func (c catalog) translate(message string, args ...any) string {
+	if t, ok := c[message]; ok && t != "" {
+		message = t
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// translateError is the message of err in the locale of the catalog, if it is a validation error,
+// otherwise the message of err as is.
+func (c catalog) translateError(err error) string {
+	var all validationErrors
+	if errors.As(err, &all) {
+		messages := make([]string, 0, len(all))
+		for _, err := range all {
+			messages = append(messages, c.translateError(err))
+		}
+		return strings.Join(messages, ", ")
+	}
+	var v *validationError
+	if errors.As(err, &v) {
+		if t, ok := c[string(v.Code)]; ok && t != "" {
+			return t
+		}
+	}
+	return err.Error()
+}
+
+// uiLocale is the locale of the interface for the request, negotiated like the one of the guides:
+// the lang query parameter, the one of the page of htmx requests, then Accept-Language.
+func uiLocale(r *http.Request) string {
+	if locale := matchLocale(preferredLocales(r), uiLocales); locale != "" {
+		return locale
+	}
+	return defaultUILocale
+}
+
+// localize is message in the locale of the interface for r.
+func localize(r *http.Request, message string, args ...any) string {
+	return catalogs[uiLocale(r)].translate(message, args...)
+}
+
+// localizeError is the message of err in the locale of the interface for r.
+func localizeError(r *http.Request, err error) string {
+	return catalogs[uiLocale(r)].translateError(err)
+}
+
+// localeFuncs are the template functions that depend on the locale: t translates a message and
+// uiLocale is the locale, for the lang attribute of the page.
+func localeFuncs(locale string) template.FuncMap {
+	c := catalogs[locale]
+	return template.FuncMap{
+		"t":        c.translate,
+		"uiLocale": func() string { return locale },
+	}
+}
+
+// addVary adds header to the Vary header of the response, unless it is there already.
+func addVary(w http.ResponseWriter, header string) {
+	for _, v := range w.Header().Values("Vary") {
+		for _, h := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(h), header) {
+				return
+			}
+		}
+	}
+	w.Header().Add("Vary", header)
+}
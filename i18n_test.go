@@ -0,0 +1,134 @@
+package guide_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestUITranslatedToTheNegotiatedLocale(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	routes := server.Routes()
+	testCases := map[string]struct {
+		method, target, form string
+		header               map[string]string
+		status               int
+		want, notWant        []string
+	}{
+		"accept language": {
+			method: http.MethodGet, target: "/guides",
+			header: map[string]string{"Accept-Language": "es-MX,es;q=0.9,en;q=0.5"},
+			status: http.StatusOK,
+			want:   []string{`<html lang="es">`, "Buscar guías:", "¿Seguro que quieres eliminar esta guía?", "Crear nueva guía"},
+		},
+		"default locale": {
+			method: http.MethodGet, target: "/guides",
+			header:  map[string]string{"Accept-Language": "fr"},
+			status:  http.StatusOK,
+			want:    []string{`<html lang="en">`, "Search Guides:"},
+			notWant: []string{"Buscar guías:"},
+		},
+		"lang parameter": {
+			method: http.MethodGet, target: "/guide/1?lang=es",
+			status: http.StatusOK,
+			want:   []string{"Agregar punto de interés", "Exportar GeoJSON"},
+		},
+		"htmx partial of a page": {
+			method: http.MethodGet, target: "/guide/1/poi/create",
+			header: map[string]string{"HX-Request": "true", "HX-Current-URL": "http://example.com/g/test-1?lang=es"},
+			status: http.StatusOK,
+			want:   []string{"Datos del punto de interés", "comida, museos, miradores..."},
+		},
+		"validation errors": {
+			method: http.MethodPost, target: "/guide/create", form: "name=&latitude=10&longitude=1000",
+			header: map[string]string{"Accept-Language": "es"},
+			status: http.StatusBadRequest,
+			want:   []string{"el nombre de la guía no puede estar vacío"},
+		},
+		"validation errors of the user form": {
+			method: http.MethodPost, target: "/user/signup", form: "username=test&password=password1&confirm-password=password2&email=a@b.com",
+			header: map[string]string{"Accept-Language": "es"},
+			status: http.StatusBadRequest,
+			want:   []string{"las contraseñas no coinciden"},
+		},
+	}
+	for name, tc := range testCases {
+		req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.form))
+		if tc.form != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for key, value := range tc.header {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s: want status %d, got %d", name, tc.status, rec.Code)
+		}
+		if vary := strings.Join(rec.Header().Values("Vary"), ","); !strings.Contains(vary, "Accept-Language") {
+			t.Errorf("%s: want response to vary by Accept-Language, got %q", name, vary)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s: want response to contain %s", name, want)
+			}
+		}
+		for _, notWant := range tc.notWant {
+			if strings.Contains(rec.Body.String(), notWant) {
+				t.Errorf("%s: want response not to contain %s", name, notWant)
+			}
+		}
+	}
+}
+
+func TestCatalogsTranslateEveryTemplateMessage(t *testing.T) {
+	t.Parallel()
+	rxMessage := regexp.MustCompile(`\{\{t "([^"]+)"`)
+	messages := map[string]bool{}
+	err := filepath.WalkDir("templates", func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, match := range rxMessage.FindAllStringSubmatch(string(b), -1) {
+			messages[match[1]] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) == 0 {
+		t.Fatal("want templates with messages to translate")
+	}
+
+	catalogs, err := filepath.Glob("locales/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range catalogs {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		catalog := map[string]string{}
+		err = json.Unmarshal(b, &catalog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for message := range messages {
+			if catalog[message] == "" {
+				t.Errorf("%s: want a translation of %q", path, message)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package guide
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxImportSize limits the size of uploaded import files.
+const maxImportSize = 10 << 20
+
+// importRow is a poi read from an import file, Number is its position in the file. Coordinates are
+// kept as strings, so rows go back and forth between the preview and the commit forms unchanged.
+// ID is the poi the row updates in upsert mode, rows without it create pois. Itinerary is the name
+// of the itinerary the row is a stop of, like the routes and tracks of GPX files, in row order.
+type importRow struct {
+	Number                                           int
+	ID                                               string
+	Name, Description, Category, Latitude, Longitude string
+	Itinerary                                        string
+	Error                                            string
+}
+
+// poi validates the row as a poi of guideID.
+func (row importRow) poi(guideID int64) (pointOfInterest, error) {
+	poi, err := NewPointOfInterest(row.Name, guideID,
+		PoiWithValidStringCoordinates(row.Latitude, row.Longitude),
+		PoiWithDescription(row.Description),
+		PoiWithCategory(row.Category))
+	if err != nil || row.ID == "" {
+		return poi, err
+	}
+	poi.Id, err = strconv.ParseInt(row.ID, 10, 64)
+	if err != nil || poi.Id <= 0 {
+		return pointOfInterest{}, newValidationError("id", errPoiIDInvalid)
+	}
+	return poi, nil
+}
+
+// validateImportRows sets the Error of the rows that aren't valid pois of guideID, in the
+// language of c.
+func validateImportRows(rows []importRow, guideID int64, c catalog) {
+	for i := range rows {
+		if rows[i].Error != "" {
+			continue
+		}
+		_, err := rows[i].poi(guideID)
+		if err != nil {
+			rows[i].Error = c.translateError(err)
+		}
+	}
+}
+
+// importItineraries are the itineraries of the rows, with the pois imported from them in row order.
+func importItineraries(rows []importRow, pois []pointOfInterest, guideID int64) ([]itinerary, error) {
+	names := make([]string, 0)
+	stops := map[string][]pointOfInterest{}
+	for i, row := range rows {
+		if row.Itinerary == "" {
+			continue
+		}
+		if _, ok := stops[row.Itinerary]; !ok {
+			names = append(names, row.Itinerary)
+		}
+		stops[row.Itinerary] = append(stops[row.Itinerary], pois[i])
+	}
+	itineraries := make([]itinerary, 0, len(names))
+	for _, name := range names {
+		i, err := NewItinerary(name, guideID, ItineraryWithPois(stops[name]...))
+		if err != nil {
+			return nil, err
+		}
+		itineraries = append(itineraries, i)
+	}
+	return itineraries, nil
+}
+
+// validateImportIDs sets the Error of the rows updating pois that aren't in existing, or that
+// another row updates already, in the language of c.
+func validateImportIDs(rows []importRow, existing []pointOfInterest, c catalog) {
+	ids := map[string]bool{}
+	for _, poi := range existing {
+		ids[strconv.FormatInt(poi.Id, 10)] = true
+	}
+	seen := map[string]bool{}
+	for i := range rows {
+		id := rows[i].ID
+		if rows[i].Error != "" || id == "" {
+			continue
+		}
+		switch {
+		case !ids[id]:
+			rows[i].Error = c.translate("poi %s is not in this guide", id)
+		case seen[id]:
+			rows[i].Error = c.translate("poi %s is updated by another row", id)
+		}
+		seen[id] = true
+	}
+}
+
+// importForm is the data of the import page: the upload form and the preview of the uploaded file.
+type importForm struct {
+	GuideID   int64
+	GuideName string
+	GuideSlug string
+	// NameKey, DescriptionKey and CategoryKey are the GeoJSON feature properties and CSV columns
+	// mapped to poi fields.
+	NameKey, DescriptionKey, CategoryKey string
+	// Upsert updates the pois of the rows with an ID, e.g. when importing an edited CSV export.
+	Upsert bool
+	Rows   []importRow
+	Errors []string
+	// catalog translates the errors of the rows to the language of the interface.
+	catalog catalog
+}
+
+func newImportForm(g guide) importForm {
+	return importForm{
+		GuideID:        g.Id,
+		GuideName:      g.Name,
+		GuideSlug:      g.Slug,
+		NameKey:        "name",
+		DescriptionKey: "description",
+		CategoryKey:    "category",
+		Rows:           []importRow{},
+		Errors:         []string{},
+	}
+}
+
+// ValidRows are the rows that will be imported on commit.
+func (f importForm) ValidRows() []importRow {
+	valid := make([]importRow, 0, len(f.Rows))
+	for _, row := range f.Rows {
+		if row.Error == "" {
+			valid = append(valid, row)
+		}
+	}
+	return valid
+}
+
+// InvalidCount is the number of rows that will be skipped on commit.
+func (f importForm) InvalidCount() int {
+	return len(f.Rows) - len(f.ValidRows())
+}
+
+// readImportRows reads the rows of an import file in the format of its extension, GeoJSON by default.
+func readImportRows(r io.Reader, filename string, form importForm) ([]importRow, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gpx":
+		return readGPXImportRows(r, form)
+	case ".kml":
+		return readKMLImportRows(r, form)
+	case ".kmz":
+		return readKMZImportRows(r, form)
+	case ".csv":
+		return readCSVImportRows(r, form)
+	default:
+		return readGeoJSONImportRows(r, form)
+	}
+}
+
+// readGeoJSONImportRows reads one row per feature of a GeoJSON FeatureCollection, taking the
+// poi fields from the properties named in form. Only errors of the whole file are returned,
+// features that aren't valid pois get their row Error set instead.
+func readGeoJSONImportRows(r io.Reader, form importForm) ([]importRow, error) {
+	var fc geoJSONFeatureCollection
+	err := json.NewDecoder(r).Decode(&fc)
+	if err != nil {
+		return nil, fmt.Errorf("not able to parse GeoJSON: %w", err)
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("GeoJSON has to be a FeatureCollection, got %q", fc.Type)
+	}
+	if len(fc.Features) == 0 {
+		return nil, errors.New("GeoJSON has no features")
+	}
+
+	rows := make([]importRow, 0, len(fc.Features))
+	for i, f := range fc.Features {
+		row := importRow{
+			Number:      i + 1,
+			Name:        stringProperty(f.Properties, form.NameKey),
+			Description: stringProperty(f.Properties, form.DescriptionKey),
+			Category:    stringProperty(f.Properties, form.CategoryKey),
+		}
+		c, err := f.Geometry.coordinate()
+		if err != nil {
+			row.Error = form.catalog.translateError(err)
+		} else {
+			row.Latitude = strconv.FormatFloat(c.Latitude, 'f', -1, 64)
+			row.Longitude = strconv.FormatFloat(c.Longitude, 'f', -1, 64)
+		}
+		rows = append(rows, row)
+	}
+	validateImportRows(rows, form.GuideID, form.catalog)
+	return rows, nil
+}
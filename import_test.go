@@ -0,0 +1,211 @@
+package guide_test
+
+import (
+	"bytes"
+	"guide"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const importGeoJSON = `{"type":"FeatureCollection","features":[
+{"type":"Feature","geometry":{"type":"Point","coordinates":[-96.7266,17.0588]},"properties":{"title":"Mercado","notes":"Smoke alley","kind":"food"}},
+{"type":"Feature","geometry":{"type":"Point","coordinates":[-96.7233,17.0656]},"properties":{"title":"Santo Domingo"}},
+{"type":"Feature","geometry":{"type":"Point","coordinates":[-96.7233,97.0656]},"properties":{"title":"Out of range"}},
+{"type":"Feature","geometry":{"type":"Point","coordinates":[-96.7233,17.0656]},"properties":{}},
+{"type":"Feature","geometry":{"type":"LineString","coordinates":[[-96.7,17],[-96.8,17.1]]},"properties":{"title":"Route"}}
+]}`
+
+func newImportRequest(t *testing.T, path, filename, content string, fields map[string]string) *http.Request {
+	t.Helper()
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	for key, value := range fields {
+		err := mw.WriteField(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, content)
+	err = mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, &b)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestImportPreviewShowsFeatureErrorsWithoutStoring(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	server := newProvisionedServerWithStore(storage, t)
+
+	req := newImportRequest(t, "/guide/1/import", "spots.geojson", importGeoJSON, map[string]string{"name_key": "title", "description_key": "notes", "category_key": "kind"})
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"Mercado", "Santo Domingo", "latitude has to be in the", "poi name cannot be empty", "geometry has to be a Point", "Import 2 points of interest", `value="Smoke alley"`, `value="food"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want preview to contain %q", want)
+		}
+	}
+	if got := len(storage.GetAllPois(1)); got != 3 {
+		t.Errorf("want preview to store nothing, got %d pois", got)
+	}
+}
+
+func TestImportPreviewErrors(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	testCases := map[string]string{
+		"not json":         `{"type":`,
+		"not a collection": `{"type":"Feature","geometry":{"type":"Point","coordinates":[1,1]},"properties":{}}`,
+		"no features":      `{"type":"FeatureCollection","features":[]}`,
+	}
+	for name, input := range testCases {
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/1/import", "spots.geojson", input, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: want status %d, got %d", name, http.StatusBadRequest, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/42/import", "spots.geojson", importGeoJSON, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("want status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestImportCommitCreatesAllPoisOrNone(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	server := newProvisionedServerWithStore(storage, t)
+
+	commit := func(names, latitudes []string) int {
+		form := url.Values{}
+		for i, name := range names {
+			form.Add("id", "")
+			form.Add("name", name)
+			form.Add("description", "")
+			form.Add("category", "food")
+			form.Add("latitude", latitudes[i])
+			form.Add("longitude", "-96.72")
+		}
+		req := httptest.NewRequest(http.MethodPost, "/guide/1/import/commit", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := commit([]string{"Mercado", "Tampered"}, []string{"17.05", "97"}); code != http.StatusBadRequest {
+		t.Errorf("want status %d on invalid poi, got %d", http.StatusBadRequest, code)
+	}
+	if got := len(storage.GetAllPois(1)); got != 3 {
+		t.Errorf("want no pois created on invalid commit, got %d pois", got)
+	}
+
+	if code := commit([]string{"Mercado", "Santo Domingo"}, []string{"17.05", "17.06"}); code != http.StatusSeeOther {
+		t.Errorf("want status %d, got %d", http.StatusSeeOther, code)
+	}
+	pois := storage.GetAllPois(1)
+	if len(pois) != 5 {
+		t.Fatalf("want 5 pois, got %d", len(pois))
+	}
+	if pois[3].Name != "Mercado" || pois[3].Category != "food" {
+		t.Errorf("want imported Mercado in food, got %+v", pois[3])
+	}
+}
+
+func TestImportRowErrorsInUILanguage(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	want := "la latitud tiene que estar entre -90° y 90°"
+
+	req := newImportRequest(t, "/guide/1/import", "spots.geojson", importGeoJSON, map[string]string{"name_key": "title"})
+	req.Header.Set("Accept-Language", "es")
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	if got := rr.Body.String(); !strings.Contains(got, want) {
+		t.Errorf("want preview row error %q\nGot:\n%s", want, got)
+	}
+
+	form := url.Values{"id": {""}, "name": {"Tampered"}, "description": {""}, "category": {""}, "latitude": {"97"}, "longitude": {"-96.72"}}
+	req = httptest.NewRequest(http.MethodPost, "/guide/1/import/commit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept-Language", "es")
+	rr = httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	if got := rr.Body.String(); !strings.Contains(got, want) {
+		t.Errorf("want commit row error %q\nGot:\n%s", want, got)
+	}
+}
+
+func TestSqliteStore_UpsertPois(t *testing.T) {
+	t.Parallel()
+	s := openTmpStorage(t)
+	g, err := guide.NewGuide("Oaxaca", guide.WithValidStringCoordinates("17", "-96"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CreateGuide(&g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := guide.NewPointOfInterest("A", g.Id, guide.PoiWithValidStringCoordinates("17", "-96"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := guide.NewPointOfInterest("B", g.Id, guide.PoiWithValidStringCoordinates("17", "-96"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pois := append(g.Pois, a, b)
+	err = s.UpsertPois(pois)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pois[0].Id == 0 || pois[1].Id == 0 {
+		t.Errorf("want ids set, got %d and %d", pois[0].Id, pois[1].Id)
+	}
+
+	invalid := append(pois[:0:0], a, b)
+	invalid[1].GuideID = 42
+	err = s.UpsertPois(invalid)
+	if err == nil {
+		t.Error("want error creating a poi of a missing guide")
+	}
+	if got := len(s.GetAllPois(g.Id)); got != 2 {
+		t.Errorf("want the failed batch to create nothing, got %d pois", got)
+	}
+	updated := append(pois[:0:0], pois[0], a)
+	updated[0].Name = "A2"
+	err = s.UpsertPois(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.GetAllPois(g.Id)
+	if len(got) != 3 || got[0].Name != "A2" {
+		t.Errorf("want A updated and one poi created, got %+v", got)
+	}
+
+	other := append(pois[:0:0], pois[1])
+	other[0].GuideID = 42
+	err = s.UpsertPois(other)
+	if err == nil {
+		t.Error("want error updating a poi of another guide")
+	}
+}
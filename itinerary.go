@@ -0,0 +1,150 @@
+package guide
+
+import (
+	"math"
+)
+
+// itinerary is an ordered route through some of the points of interest of a guide,
+// e.g. "day 1 walking tour". The order of Pois is the visiting order.
+type itinerary struct {
+	Id        int64
+	GuideID   int64
+	GuideName string
+	GuideSlug string
+	Name      string
+	Pois      []pointOfInterest
+}
+
+type itineraryOption func(*itinerary) error
+
+func ItineraryWithPois(pois ...pointOfInterest) itineraryOption {
+	return func(i *itinerary) error {
+		for _, poi := range pois {
+			if poi.GuideID != i.GuideID {
+				return newValidationError("poi", errItineraryPoiGuide)
+			}
+		}
+		i.Pois = pois
+		return nil
+	}
+}
+
+func NewItinerary(name string, guideID int64, opts ...itineraryOption) (itinerary, error) {
+	var errs validationErrors
+	if name == "" {
+		errs.collect(newValidationError("name", errItineraryNameEmpty))
+	}
+	if guideID <= 0 {
+		errs.collect(newValidationError("", errGuideIDEmpty))
+	}
+	i := itinerary{
+		Name:    name,
+		GuideID: guideID,
+		Pois:    []pointOfInterest{},
+	}
+
+	for _, opt := range opts {
+		err := opt(&i)
+		if !errs.collect(err) {
+			return itinerary{}, err
+		}
+	}
+	if err := errs.err(); err != nil {
+		return itinerary{}, err
+	}
+	return i, nil
+}
+
+// Distance is the total straight-line(great-circle) distance in kilometers of
+// walking the itinerary pois in order.
+func (i itinerary) Distance() float64 {
+	return routeDistance(i.Pois)
+}
+
+// PoiIDs returns the ids of the itinerary pois in visiting order.
+func (i itinerary) PoiIDs() []int64 {
+	ids := make([]int64, 0, len(i.Pois))
+	for _, poi := range i.Pois {
+		ids = append(ids, poi.Id)
+	}
+	return ids
+}
+
+const earthRadiusKm = 6371.0
+
+// distance returns the great-circle distance in kilometers between two coordinates
+// using the haversine formula.
+func distance(a, b coordinate) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func routeDistance(pois []pointOfInterest) float64 {
+	total := 0.0
+	for i := 1; i < len(pois); i++ {
+		total += distance(pois[i-1].Coordinate, pois[i].Coordinate)
+	}
+	return total
+}
+
+// suggestOrder returns a short visiting order of pois. It keeps the first poi as the
+// starting point, builds a route with the nearest-neighbour heuristic and then improves
+// it with 2-opt until no segment reversal makes it shorter. The route is open, there is
+// no need to come back to the start.
+func suggestOrder(pois []pointOfInterest) []pointOfInterest {
+	if len(pois) < 3 {
+		return append([]pointOfInterest{}, pois...)
+	}
+
+	remaining := append([]pointOfInterest{}, pois[1:]...)
+	route := []pointOfInterest{pois[0]}
+	for len(remaining) > 0 {
+		last := route[len(route)-1]
+		nearest := 0
+		for i := 1; i < len(remaining); i++ {
+			if distance(last.Coordinate, remaining[i].Coordinate) < distance(last.Coordinate, remaining[nearest].Coordinate) {
+				nearest = i
+			}
+		}
+		route = append(route, remaining[nearest])
+		remaining = append(remaining[:nearest], remaining[nearest+1:]...)
+	}
+
+	const epsilon = 1e-9
+	improved := true
+	for improved {
+		improved = false
+		for i := 1; i < len(route)-1; i++ {
+			for j := i + 1; j < len(route); j++ {
+				before := distance(route[i-1].Coordinate, route[i].Coordinate)
+				after := distance(route[i-1].Coordinate, route[j].Coordinate)
+				if j+1 < len(route) {
+					before += distance(route[j].Coordinate, route[j+1].Coordinate)
+					after += distance(route[i].Coordinate, route[j+1].Coordinate)
+				}
+				if after < before-epsilon {
+					for l, r := i, j; l < r; l, r = l+1, r-1 {
+						route[l], route[r] = route[r], route[l]
+					}
+					improved = true
+				}
+			}
+		}
+	}
+	return route
+}
+
+type itineraryForm struct {
+	GuideID   int64
+	GuideName string
+	GuideSlug string
+	Name      string
+	Pois      []pointOfInterest
+	Selected  map[int64]bool
+	formErrors
+}
@@ -0,0 +1,79 @@
+package guide_test
+
+import (
+	"guide"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestNewItineraryErrorOnEmptyName(t *testing.T) {
+	t.Parallel()
+	_, err := guide.NewItinerary("", 1)
+	if err == nil {
+		t.Error("want error if name is empty")
+	}
+}
+
+func TestNewItineraryErrorOnPoiFromAnotherGuide(t *testing.T) {
+	t.Parallel()
+	poi, err := guide.NewPointOfInterest("test", 2, guide.PoiWithValidStringCoordinates("10", "10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = guide.NewItinerary("day 1", 1, guide.ItineraryWithPois(poi))
+	if err == nil {
+		t.Error("want error if poi belongs to another guide")
+	}
+}
+
+func TestItineraryDistance(t *testing.T) {
+	t.Parallel()
+	a, err := guide.NewPointOfInterest("a", 1, guide.PoiWithValidStringCoordinates("0", "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := guide.NewPointOfInterest("b", 1, guide.PoiWithValidStringCoordinates("1", "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := guide.NewPointOfInterest("c", 1, guide.PoiWithValidStringCoordinates("1", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := guide.NewItinerary("day 1", 1, guide.ItineraryWithPois(a, b, c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one degree of latitude is ~111.19km, one degree of longitude at 1° latitude is ~111.18km
+	want := 222.37
+	got := i.Distance()
+	if math.Abs(want-got) > 0.01 {
+		t.Errorf("want distance %.2f km, got %.2f km", want, got)
+	}
+}
+
+func TestSuggestOrder(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name        string
+		coordinates [][2]float64
+		want        []int
+	}{
+		{"no pois", nil, []int{}},
+		{"one poi", [][2]float64{{0, 0}}, []int{0}},
+		{"fewer than 3 pois keep their order", [][2]float64{{0, 0.05}, {0, 0}}, []int{0, 1}},
+		{"line walked from its end", [][2]float64{{0, 0.03}, {0, 0}, {0, 0.01}, {0, 0.02}}, []int{0, 3, 2, 1}},
+		// the shortest route would start at an end, 0.00
+		{"first poi stays the start", [][2]float64{{0, 0.01}, {0, 0}, {0, 0.03}, {0, 0.04}}, []int{0, 1, 2, 3}},
+		// nearest neighbour goes 0, 4, 1, 2, 3, a route that crosses itself
+		{"crossing untangled", [][2]float64{{0.02, 0.02}, {0.04, 0.03}, {0.02, 0.04}, {0.03, 0}, {0.03, 0.03}}, []int{0, 2, 4, 1, 3}},
+	}
+	for _, tc := range testCases {
+		got := guide.SuggestOrder(tc.coordinates...)
+		if !slices.Equal(tc.want, got) {
+			t.Errorf("%s: want order %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package guide
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const kmlNamespace = "http://www.opengis.net/kml/2.2"
+
+// kml is a KML document as Google My Maps and Google Earth use them: a folder per layer, we map
+// folders to categories, with a placemark per point.
+type kml struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	Styles      []kmlStyle     `xml:"Style"`
+	Placemarks  []kmlPlacemark `xml:"Placemark"`
+	Folders     []kmlFolder    `xml:"Folder"`
+}
+
+type kmlStyle struct {
+	ID        string       `xml:"id,attr"`
+	IconStyle kmlIconStyle `xml:"IconStyle"`
+}
+
+type kmlIconStyle struct {
+	// Color is aabbggrr.
+	Color string `xml:"color"`
+	Icon  struct {
+		Href string `xml:"href"`
+	} `xml:"Icon"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string    `xml:"name"`
+	Description string    `xml:"description,omitempty"`
+	StyleURL    string    `xml:"styleUrl,omitempty"`
+	Point       *kmlPoint `xml:"Point"`
+}
+
+// kmlPoint coordinates are "longitude,latitude[,altitude]".
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+const kmlIcon = "https://maps.google.com/mapfiles/kml/paddle/wht-blank.png"
+
+// kmlColors tint the icon of each category, in KML aabbggrr order.
+var kmlColors = []string{"ff3643f4", "ff50af4c", "fff39621", "ff07c1ff", "ffb0279c", "ff8b7d60", "ff2257ff", "ff889600"}
+
+func newKMLPlacemark(p pointOfInterest, styleURL string) kmlPlacemark {
+	return kmlPlacemark{
+		Name:        p.Name,
+		Description: p.Description,
+		StyleURL:    styleURL,
+		Point:       &kmlPoint{Coordinates: fmt.Sprintf("%v,%v", p.Coordinate.Longitude, p.Coordinate.Latitude)},
+	}
+}
+
+// WriteGuideKML exports the guide pois as placemarks, with a folder and an icon color per category.
+// Pois without a category are placed in the document itself.
+func WriteGuideKML(w io.Writer, g guide) error {
+	doc := kmlDocument{
+		Name:        g.Name,
+		Description: g.Description,
+		Styles:      []kmlStyle{newKMLStyle("poi", kmlColors[0])},
+		Placemarks:  make([]kmlPlacemark, 0),
+		Folders:     make([]kmlFolder, 0),
+	}
+	folders := map[string]int{}
+	for _, poi := range g.Pois {
+		if poi.Category == "" {
+			doc.Placemarks = append(doc.Placemarks, newKMLPlacemark(poi, "#poi"))
+			continue
+		}
+		i, ok := folders[poi.Category]
+		if !ok {
+			i = len(doc.Folders)
+			folders[poi.Category] = i
+			doc.Folders = append(doc.Folders, kmlFolder{Name: poi.Category})
+			doc.Styles = append(doc.Styles, newKMLStyle(fmt.Sprintf("category-%d", i), kmlColors[(i+1)%len(kmlColors)]))
+		}
+		doc.Folders[i].Placemarks = append(doc.Folders[i].Placemarks, newKMLPlacemark(poi, fmt.Sprintf("#category-%d", i)))
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(kml{Xmlns: kmlNamespace, Document: doc})
+}
+
+func newKMLStyle(id, color string) kmlStyle {
+	style := kmlStyle{ID: id, IconStyle: kmlIconStyle{Color: color}}
+	style.IconStyle.Icon.Href = kmlIcon
+	return style
+}
+
+// readKMLImportRows reads one row per placemark, categorized by the innermost named folder it is
+// in. The document is decoded placemark by placemark like GPX files.
+func readKMLImportRows(r io.Reader, form importForm) ([]importRow, error) {
+	dec := xml.NewDecoder(r)
+	rows := make([]importRow, 0)
+	foundKML := false
+	// elements are the open elements, folders the names of the open folders
+	elements := make([]string, 0)
+	folders := make([]string, 0)
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not able to parse KML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			parent := ""
+			if len(elements) > 0 {
+				parent = elements[len(elements)-1]
+			}
+			switch {
+			case t.Name.Local == "kml":
+				foundKML = true
+			case t.Name.Local == "Folder":
+				folders = append(folders, "")
+			case t.Name.Local == "name" && parent == "Folder":
+				var name string
+				err = dec.DecodeElement(&name, &t)
+				if err != nil {
+					return nil, fmt.Errorf("not able to parse KML: %w", err)
+				}
+				folders[len(folders)-1] = strings.TrimSpace(name)
+				continue
+			case t.Name.Local == "Placemark":
+				var p kmlPlacemark
+				err = dec.DecodeElement(&p, &t)
+				if err != nil {
+					return nil, fmt.Errorf("not able to parse KML: %w", err)
+				}
+				rows = append(rows, newKMLImportRow(len(rows)+1, p, innermostFolder(folders)))
+				continue
+			}
+			elements = append(elements, t.Name.Local)
+		case xml.EndElement:
+			if len(elements) > 0 {
+				elements = elements[:len(elements)-1]
+			}
+			if t.Name.Local == "Folder" && len(folders) > 0 {
+				folders = folders[:len(folders)-1]
+			}
+		}
+	}
+	if !foundKML {
+		return nil, errors.New("not able to parse KML: kml element is missing")
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("KML has no placemarks")
+	}
+	validateImportRows(rows, form.GuideID, form.catalog)
+	return rows, nil
+}
+
+func innermostFolder(folders []string) string {
+	for i := len(folders) - 1; i >= 0; i-- {
+		if folders[i] != "" {
+			return folders[i]
+		}
+	}
+	return ""
+}
+
+func newKMLImportRow(number int, p kmlPlacemark, category string) importRow {
+	row := importRow{
+		Number:      number,
+		Name:        strings.TrimSpace(p.Name),
+		Description: strings.TrimSpace(p.Description),
+		Category:    category,
+	}
+	if p.Point == nil {
+		row.Error = "placemark has to be a Point"
+		return row
+	}
+	position := strings.Split(strings.TrimSpace(p.Point.Coordinates), ",")
+	if len(position) < 2 {
+		row.Error = "point has to have longitude and latitude"
+		return row
+	}
+	row.Longitude = strings.TrimSpace(position[0])
+	row.Latitude = strings.TrimSpace(position[1])
+	return row
+}
+
+// readKMZImportRows reads the KML document of a KMZ archive, doc.kml or else its first .kml file.
+func readKMZImportRows(r io.Reader, form importForm) ([]importRow, error) {
+	archive, err := io.ReadAll(io.LimitReader(r, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(archive) > maxImportSize {
+		return nil, errors.New("import file has to be at most 10MB")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("not able to parse KMZ: %w", err)
+	}
+
+	var doc *zip.File
+	for _, f := range zr.File {
+		if strings.EqualFold(path.Ext(f.Name), ".kml") && (doc == nil || f.Name == "doc.kml") {
+			doc = f
+		}
+	}
+	if doc == nil {
+		return nil, errors.New("KMZ has no KML document")
+	}
+	rc, err := doc.Open()
+	if err != nil {
+		return nil, fmt.Errorf("not able to parse KMZ: %w", err)
+	}
+	defer rc.Close()
+	// the uncompressed document is limited too, so small archives can't expand into huge ones
+	return readKMLImportRows(io.LimitReader(rc, maxImportSize), form)
+}
@@ -0,0 +1,154 @@
+package guide_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"guide"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type kmlDocument struct {
+	Name   string `xml:"Document>name"`
+	Styles []struct {
+		ID    string `xml:"id,attr"`
+		Color string `xml:"IconStyle>color"`
+	} `xml:"Document>Style"`
+	Placemarks []struct {
+		Name string `xml:"name"`
+	} `xml:"Document>Placemark"`
+	Folders []struct {
+		Name       string `xml:"name"`
+		Placemarks []struct {
+			Name        string `xml:"name"`
+			StyleURL    string `xml:"styleUrl"`
+			Coordinates string `xml:"Point>coordinates"`
+		} `xml:"Placemark"`
+	} `xml:"Document>Folder"`
+}
+
+func TestWriteGuideKMLHasFolderAndStylePerCategory(t *testing.T) {
+	t.Parallel()
+	g, err := guide.NewGuide("Oaxaca", guide.WithValidStringCoordinates("17", "-96"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Id = 1
+	for _, p := range []struct{ name, category string }{{"Mercado", "food"}, {"Santo Domingo", ""}, {"Tlayudas", "food"}, {"Monte Alban", "ruins"}} {
+		poi, err := guide.NewPointOfInterest(p.name, g.Id, guide.PoiWithValidStringCoordinates("17.06", "-96.72"), guide.PoiWithCategory(p.category))
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.Pois = append(g.Pois, poi)
+	}
+
+	var b bytes.Buffer
+	err = guide.WriteGuideKML(&b, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got kmlDocument
+	err = xml.Unmarshal(b.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Placemarks) != 1 || got.Placemarks[0].Name != "Santo Domingo" {
+		t.Errorf("want uncategorized Santo Domingo in the document, got %+v", got.Placemarks)
+	}
+	if len(got.Folders) != 2 || got.Folders[0].Name != "food" || len(got.Folders[0].Placemarks) != 2 || got.Folders[1].Name != "ruins" {
+		t.Fatalf("want food and ruins folders, got %+v", got.Folders)
+	}
+	if got.Folders[0].Placemarks[0].Coordinates != "-96.72,17.06" {
+		t.Errorf("want longitude,latitude coordinates, got %s", got.Folders[0].Placemarks[0].Coordinates)
+	}
+	styles := map[string]string{}
+	for _, s := range got.Styles {
+		styles["#"+s.ID] = s.Color
+	}
+	food, ruins := got.Folders[0].Placemarks[0].StyleURL, got.Folders[1].Placemarks[0].StyleURL
+	if styles[food] == "" || styles[ruins] == "" || styles[food] == styles[ruins] {
+		t.Errorf("want a different style per category, got %s and %s in %v", food, ruins, styles)
+	}
+}
+
+const importKML = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+  <Document>
+    <name>My Oaxaca</name>
+    <Placemark><name>Zocalo</name><Point><coordinates>-96.7253,17.0610,0</coordinates></Point></Placemark>
+    <Folder>
+      <name>Food</name>
+      <Placemark><name>Mercado</name><description><![CDATA[Smoke alley <b>tasajo</b>]]></description><Point><coordinates> -96.7266,17.0588 </coordinates></Point></Placemark>
+      <Folder>
+        <name>Mezcal</name>
+        <Placemark><name>Mezcaleria</name><Point><coordinates>-96.72,17.06</coordinates></Point></Placemark>
+      </Folder>
+      <Placemark><name>Walk</name><LineString><coordinates>-96.72,17.06 -96.73,17.07</coordinates></LineString></Placemark>
+    </Folder>
+  </Document>
+</kml>`
+
+func TestImportKMLPreviewMapsFoldersToCategories(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	req := newImportRequest(t, "/guide/1/import", "my-maps.kml", importKML, nil)
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{`value="Zocalo"`, `value="Food"`, `value="Mezcal"`, `value="Smoke alley &lt;b&gt;tasajo&lt;/b&gt;"`, `value="17.0588"`, "placemark has to be a Point", "Import 3 points of interest"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want preview to contain %q", want)
+		}
+	}
+}
+
+func TestImportKMZPreview(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, content := range map[string]string{"doc.kml": importKML, "images/icon.png": "not really a png"} {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newProvisionedServer(t)
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/1/import", "my-maps.kmz", b.String(), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "Import 3 points of interest") {
+		t.Error("want KMZ placemarks previewed")
+	}
+}
+
+func TestImportKMLErrors(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	testCases := []struct{ filename, content string }{
+		{"broken.kml", `<kml><Document>`},
+		{"gpx.kml", `<gpx></gpx>`},
+		{"empty.kml", `<kml><Document><Folder><name>Food</name></Folder></Document></kml>`},
+		{"not-a-zip.kmz", importKML},
+	}
+	for _, tc := range testCases {
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, newImportRequest(t, "/guide/1/import", tc.filename, tc.content, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: want status %d, got %d", tc.filename, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package guide
+
+import "errors"
+
+// list is a personal collection of points of interest from any guide, e.g. "Lisbon to-do".
+type list struct {
+	Id     int64
+	UserID int64
+	Name   string
+	Pois   []pointOfInterest
+}
+
+func newList(name string, userID int64) (list, error) {
+	if name == "" {
+		return list{}, errors.New("list name cannot be empty")
+	}
+	if userID <= 0 {
+		return list{}, errors.New("user ID cannot be empty")
+	}
+	return list{
+		Name:   name,
+		UserID: userID,
+		Pois:   []pointOfInterest{},
+	}, nil
+}
+
+// Contains reports whether the poi has been saved into the list.
+func (l list) Contains(poiID int64) bool {
+	for _, poi := range l.Pois {
+		if poi.Id == poiID {
+			return true
+		}
+	}
+	return false
+}
+
+// favorite is the starred state of a guide for a user along with how many users starred it.
+type favorite struct {
+	GuideID   int64
+	Favorited bool
+	Count     int
+}
+
+// poiLists is the data of the save-to-list button of a poi.
+type poiLists struct {
+	GuideID int64
+	PoiID   int64
+	Lists   []list
+}
+
+// myLists is the data of the "My lists" page.
+type myLists struct {
+	Username  string
+	Favorites []guide
+	Lists     []list
+	Errors    []string
+}
@@ -0,0 +1,78 @@
+package guide
+
+import (
+	"bytes"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"html/template"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// photoStorePath is the path our photos are served from. Markdown images pointing anywhere
+// else are rendered as their alt text.
+const photoStorePath = "/photos/"
+
+// markdown renders guide and poi descriptions. goldmark omits raw HTML and drops dangerous
+// link destinations(javascript:, data:, etc.) unless configured otherwise, which is what
+// keeps the output safe to embed as template.HTML.
+var markdown = goldmark.New(
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(photoStoreImages{}, 100)),
+	),
+)
+
+// renderMarkdown converts a description into sanitized HTML.
+func renderMarkdown(source string) template.HTML {
+	var b bytes.Buffer
+	err := markdown.Convert([]byte(source), &b)
+	if err != nil {
+		return template.HTML(template.HTMLEscapeString(source))
+	}
+	return template.HTML(b.String())
+}
+
+// photoStoreImages replaces images that aren't hosted in photoStorePath with their alt text.
+type photoStoreImages struct{}
+
+func (photoStoreImages) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	images := make([]*ast.Image, 0)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if image, ok := n.(*ast.Image); ok && entering && !isPhotoStoreURL(string(image.Destination)) {
+			images = append(images, image)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, image := range images {
+		parent := image.Parent()
+		for child := image.FirstChild(); child != nil; child = image.FirstChild() {
+			parent.InsertBefore(parent, image, child)
+		}
+		parent.RemoveChild(parent, image)
+	}
+}
+
+// isPhotoStoreURL reports whether destination stays in photoStorePath once browsers resolve its
+// dot segments, percent-encoded ones too, like /photos/%2e%2e/secret.png.
+func isPhotoStoreURL(destination string) bool {
+	u, err := url.Parse(destination)
+	if err != nil || u.Scheme != "" || u.Host != "" || strings.Contains(u.Path, `\`) {
+		return false
+	}
+	return strings.HasPrefix(path.Clean(u.Path), photoStorePath)
+}
+
+// DescriptionHTML renders the guide description as Markdown.
+func (g guide) DescriptionHTML() template.HTML {
+	return renderMarkdown(g.Description)
+}
+
+// DescriptionHTML renders the poi description as Markdown.
+func (p pointOfInterest) DescriptionHTML() template.HTML {
+	return renderMarkdown(p.Description)
+}
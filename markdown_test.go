@@ -0,0 +1,40 @@
+package guide_test
+
+import (
+	"guide"
+	"strings"
+	"testing"
+)
+
+func TestGuideDescriptionHTMLRendersSanitizedMarkdown(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name, description, want, notWant string
+	}{
+		{"emphasis", "*best* tacos", "<em>best</em> tacos", ""},
+		{"list", "- Tacos\n- Tortas", "<li>Tacos</li>\n<li>Tortas</li>", ""},
+		{"link", "[menu](https://example.com/menu)", `<a href="https://example.com/menu">menu</a>`, ""},
+		{"raw html", "<script>alert(1)</script>", "", "<script>"},
+		{"javascript link", "[click](javascript:alert(1))", `<a href="">click</a>`, "javascript:"},
+		{"photo store image", "![patio](/photos/patio.jpg)", `<img src="/photos/patio.jpg" alt="patio">`, ""},
+		{"external image", "![tracker](https://evil.example.com/pixel.gif)", "<p>tracker</p>", "<img"},
+		{"path traversal image", "![x](/photos/../secret.png)", "<p>x</p>", "<img"},
+		{"encoded path traversal image", "![x](/photos/%2e%2e/secret.png)", "<p>x</p>", "<img"},
+		{"encoded slash path traversal image", "![x](/photos/..%2F..%2Fsecret.png)", "<p>x</p>", "<img"},
+		{"backslash path traversal image", `![x](/photos/..\\secret.png)`, "<p>x</p>", "<img"},
+		{"protocol relative image", "![x](//evil.example.com/photos/pixel.gif)", "<p>x</p>", "<img"},
+	}
+	for _, tc := range testCases {
+		g, err := guide.NewGuide("test", guide.WithValidStringCoordinates("10", "10"), guide.WithDescription(tc.description))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(g.DescriptionHTML())
+		if !strings.Contains(got, tc.want) {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.want, got)
+		}
+		if tc.notWant != "" && strings.Contains(got, tc.notWant) {
+			t.Errorf("%s: want output to not contain %q, got %q", tc.name, tc.notWant, got)
+		}
+	}
+}
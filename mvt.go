@@ -0,0 +1,157 @@
+package guide
+
+import (
+	"math"
+)
+
+// Mapbox Vector Tiles are protocol buffers, see https://github.com/mapbox/vector-tile-spec. The tiles
+// here only have points with string and integer properties, small enough to encode by hand:
+//
+//	Tile    { repeated Layer layers = 3; }
+//	Layer   { uint32 version = 15; string name = 1; repeated Feature features = 2;
+//	          repeated string keys = 3; repeated Value values = 4; uint32 extent = 5; }
+//	Feature { uint64 id = 1; repeated uint32 tags = 2 [packed]; GeomType type = 3;
+//	          repeated uint32 geometry = 4 [packed]; }
+//	Value   { string string_value = 1; int64 int_value = 4; }
+const (
+	mvtVersion = 2
+	// mvtExtent is the size of a tile in its own coordinates.
+	mvtExtent = 4096
+	// mvtBuffer is how far outside its tile a point is still included, so markers on the edge of a
+	// tile aren't cut off.
+	mvtBuffer = 64
+	// maxMercatorLatitude is where the web mercator projection stops, its map is a square.
+	maxMercatorLatitude = 85.0511287798
+
+	mvtPointType     = 1
+	mvtMoveToCommand = 1
+
+	protoVarint = 0
+	protoBytes  = 2
+)
+
+// mvtFeature is a point of a tile, in tile coordinates from 0 to mvtExtent.
+type mvtFeature struct {
+	// ID is omitted when zero.
+	ID         uint64
+	X, Y       int
+	Properties []mvtProperty
+}
+
+// mvtProperty is a feature property, its value a string or an int64.
+type mvtProperty struct {
+	Key   string
+	Value any
+}
+
+// encodeMVT encodes a tile with one layer of features, an empty tile when there are none.
+func encodeMVT(layerName string, features []mvtFeature) []byte {
+	if len(features) == 0 {
+		return []byte{}
+	}
+	var keys []string
+	var values []any
+	keyIndex := map[string]int{}
+	valueIndex := map[any]int{}
+
+	var layer []byte
+	layer = appendProtoVarint(layer, 15, mvtVersion)
+	layer = appendProtoBytes(layer, 1, []byte(layerName))
+	for _, f := range features {
+		var tags []uint64
+		for _, p := range f.Properties {
+			k, ok := keyIndex[p.Key]
+			if !ok {
+				k = len(keys)
+				keyIndex[p.Key] = k
+				keys = append(keys, p.Key)
+			}
+			v, ok := valueIndex[p.Value]
+			if !ok {
+				v = len(values)
+				valueIndex[p.Value] = v
+				values = append(values, p.Value)
+			}
+			tags = append(tags, uint64(k), uint64(v))
+		}
+		geometry := []uint64{mvtMoveToCommand&0x7 | 1<<3, zigzag(f.X), zigzag(f.Y)}
+
+		var feature []byte
+		if f.ID != 0 {
+			feature = appendProtoVarint(feature, 1, f.ID)
+		}
+		if len(tags) > 0 {
+			feature = appendProtoBytes(feature, 2, appendPackedVarints(nil, tags))
+		}
+		feature = appendProtoVarint(feature, 3, mvtPointType)
+		feature = appendProtoBytes(feature, 4, appendPackedVarints(nil, geometry))
+		layer = appendProtoBytes(layer, 2, feature)
+	}
+	for _, k := range keys {
+		layer = appendProtoBytes(layer, 3, []byte(k))
+	}
+	for _, v := range values {
+		var value []byte
+		switch v := v.(type) {
+		case string:
+			value = appendProtoBytes(value, 1, []byte(v))
+		case int64:
+			value = appendProtoVarint(value, 4, uint64(v))
+		default:
+			panic("unsupported vector tile property value")
+		}
+		layer = appendProtoBytes(layer, 4, value)
+	}
+	layer = appendProtoVarint(layer, 5, mvtExtent)
+
+	return appendProtoBytes(nil, 3, layer)
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	b = appendVarint(b, uint64(field)<<3|protoVarint)
+	return appendVarint(b, v)
+}
+
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|protoBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendPackedVarints(b []byte, vs []uint64) []byte {
+	for _, v := range vs {
+		b = appendVarint(b, v)
+	}
+	return b
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func zigzag(n int) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
+
+// mercatorTile is where c is in web mercator tile coordinates at zoom z, the integer part is the
+// tile and the fraction the position in it.
+func mercatorTile(c coordinate, z int) (x, y float64) {
+	n := float64(int64(1) << z)
+	lat := math.Max(-maxMercatorLatitude, math.Min(maxMercatorLatitude, c.Latitude)) * math.Pi / 180
+	x = (c.Longitude + 180) / 360 * n
+	y = (1 - math.Asinh(math.Tan(lat))/math.Pi) / 2 * n
+	return x, y
+}
+
+// mercatorCoordinate is the coordinate of the web mercator tile coordinates x, y at zoom z.
+func mercatorCoordinate(x, y float64, z int) coordinate {
+	n := float64(int64(1) << z)
+	return coordinate{
+		Latitude:  math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi,
+		Longitude: x/n*360 - 180,
+	}
+}
@@ -0,0 +1,110 @@
+package guide
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	mediaTypeHTML    = "text/html"
+	mediaTypeJSON    = "application/json"
+	mediaTypeGeoJSON = "application/geo+json"
+)
+
+// negotiate picks the media type of the response from the Accept header of r among offered,
+// in the client preference order. A missing Accept header gets the first offered type, false
+// means none of offered is acceptable.
+func negotiate(r *http.Request, offered ...string) (string, bool) {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offered[0], true
+	}
+
+	type mediaRange struct {
+		mediaType string
+		quality   float64
+	}
+	ranges := make([]mediaRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, mediaRange{mediaType, quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+
+	for _, mr := range ranges {
+		for _, mediaType := range offered {
+			if mediaTypeMatches(mr.mediaType, mediaType) {
+				return mediaType, true
+			}
+		}
+	}
+	return "", false
+}
+
+// mediaTypeMatches reports if mediaType is in mediaRange, e.g. text/html is in text/* and */*.
+func mediaTypeMatches(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(mediaRange, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+// negotiateOrReject negotiates the response media type among the representations of guides
+// and pois, responding 406 when none is acceptable.
+func negotiateOrReject(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Add("Vary", "Accept")
+	mediaType, ok := negotiate(r, mediaTypeHTML, mediaTypeJSON, mediaTypeGeoJSON)
+	if !ok {
+		http.Error(w, "not acceptable, supported types are text/html, application/json and application/geo+json", http.StatusNotAcceptable)
+	}
+	return mediaType, ok
+}
+
+func writeGeoJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", mediaTypeGeoJSON)
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiGuideDetail is the JSON representation of the guide page: the guide with its pois and itineraries.
+type apiGuideDetail struct {
+	apiGuide
+	Pois        []apiPoi       `json:"pois"`
+	Itineraries []apiItinerary `json:"itineraries"`
+}
+
+type apiItinerary struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func newAPIGuideDetail(g guide) apiGuideDetail {
+	detail := apiGuideDetail{
+		apiGuide:    newAPIGuide(g),
+		Pois:        make([]apiPoi, 0, len(g.Pois)),
+		Itineraries: make([]apiItinerary, 0, len(g.Itineraries)),
+	}
+	for _, poi := range g.Pois {
+		detail.Pois = append(detail.Pois, newAPIPoi(poi))
+	}
+	for _, i := range g.Itineraries {
+		detail.Itineraries = append(detail.Itineraries, apiItinerary{Id: i.Id, Name: i.Name})
+	}
+	return detail
+}
@@ -0,0 +1,132 @@
+package guide_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentNegotiation(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		path                string
+		accept              string
+		expectedStatusCode  int
+		expectedContentType string
+	}{
+		{"/guides", "", http.StatusOK, "text/html"},
+		{"/guides", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", http.StatusOK, "text/html"},
+		{"/guides", "*/*", http.StatusOK, "text/html"},
+		{"/guides", "application/json", http.StatusOK, "application/json"},
+		{"/guides", "application/geo+json", http.StatusOK, "application/geo+json"},
+		{"/guides", "text/html;q=0.5, application/json", http.StatusOK, "application/json"},
+		{"/guides", "application/*", http.StatusOK, "application/json"},
+		{"/guides", "application/xml", http.StatusNotAcceptable, ""},
+		{"/guides", "application/json;q=0", http.StatusNotAcceptable, ""},
+		{"/guide/1", "application/json", http.StatusOK, "application/json"},
+		{"/guide/1", "application/geo+json", http.StatusOK, "application/geo+json"},
+		{"/guide/1", "text/html", http.StatusOK, "text/html"},
+		{"/guide/1", "image/png", http.StatusNotAcceptable, ""},
+		{"/guide/42", "application/json", http.StatusNotFound, ""},
+		{"/guide/1/poi/1", "application/json", http.StatusOK, "application/json"},
+		{"/guide/1/poi/1", "application/geo+json", http.StatusOK, "application/geo+json"},
+		{"/guide/1/poi/1", "text/csv", http.StatusNotAcceptable, ""},
+	}
+	server := newProvisionedServer(t)
+	ts := httptest.NewServer(server.Routes())
+	defer ts.Close()
+
+	client := ts.Client()
+	for _, tc := range testCases {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != tc.expectedStatusCode {
+			t.Errorf("for %s accepting %q want status %d, got %d", tc.path, tc.accept, tc.expectedStatusCode, res.StatusCode)
+		}
+		if tc.expectedContentType != "" && !strings.HasPrefix(res.Header.Get("Content-Type"), tc.expectedContentType) {
+			t.Errorf("for %s accepting %q want content type %s, got %s", tc.path, tc.accept, tc.expectedContentType, res.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestGuideJSONHasPoisAndItineraries(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/guide/1", nil)
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+
+	var got struct {
+		Id          int64 `json:"id"`
+		Name        string
+		Pois        []struct{ Id, GuideID int64 } `json:"pois"`
+		Itineraries []struct{ Id int64 }          `json:"itineraries"`
+	}
+	err := json.NewDecoder(rr.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != 1 || got.Name == "" {
+		t.Errorf("want guide 1 with a name, got %+v", got)
+	}
+	if len(got.Pois) != 3 {
+		t.Errorf("want 3 pois, got %d", len(got.Pois))
+	}
+	if len(got.Itineraries) != 1 {
+		t.Errorf("want 1 itinerary, got %d", len(got.Itineraries))
+	}
+}
+
+func TestGuideGeoJSONIsFeatureCollection(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/guide/1", nil)
+	req.Header.Set("Accept", "application/geo+json")
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+
+	var got struct {
+		Type     string
+		Features []struct {
+			Type     string
+			Geometry struct {
+				Type        string
+				Coordinates []float64
+			}
+			Properties map[string]any
+		}
+	}
+	err := json.NewDecoder(rr.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != "FeatureCollection" {
+		t.Errorf("want FeatureCollection, got %q", got.Type)
+	}
+	// the guide and its 3 pois
+	if len(got.Features) != 4 {
+		t.Fatalf("want 4 features, got %d", len(got.Features))
+	}
+	for _, f := range got.Features {
+		if f.Type != "Feature" || f.Geometry.Type != "Point" || len(f.Geometry.Coordinates) != 2 {
+			t.Errorf("want Point feature, got %+v", f)
+		}
+	}
+	if got.Features[0].Properties["kind"] != "guide" {
+		t.Errorf("want the guide as first feature, got %v", got.Features[0].Properties)
+	}
+}
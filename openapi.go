@@ -0,0 +1,271 @@
+package guide
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// openAPISpec describes the JSON API as an OpenAPI 3 document. Keep it in sync with apiRoutes,
+// TestOpenAPISpecDocumentsEveryAPIRoute fails when a route is missing.
+func openAPISpec() map[string]any {
+	guideID := pathParameter("id", "guide ID")
+	poiID := pathParameter("poiID", "point of interest ID")
+	nearby := []any{
+		queryParameter("latitude", true, map[string]any{"type": "number", "minimum": -90, "maximum": 90}),
+		queryParameter("longitude", true, map[string]any{"type": "number", "minimum": -180, "maximum": 180}),
+		queryParameter("radius", false, map[string]any{"type": "number", "exclusiveMinimum": 0, "default": defaultNearbyRadiusKm, "description": "kilometers"}),
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "CityGuide API",
+			"version":     "1",
+			"description": "Guides of cool spots in cities and their points of interest.",
+		},
+		"paths": map[string]any{
+			"/api/openapi.json": map[string]any{
+				"get": operation("getOpenAPISpec", "This OpenAPI document", nil, nil, response("OpenAPI document", map[string]any{"type": "object"})),
+			},
+			"/api/v1/guides": map[string]any{
+				"get": operation("listGuides", "List guides, optionally searching by name",
+					[]any{queryParameter("q", false, map[string]any{"type": "string"})}, nil,
+					response("Guides", arrayOf("Guide"))),
+				"post": operation("createGuide", "Create a guide", nil, requestBody("GuideInput"),
+					createdResponse("Guide"), errorResponses(http.StatusBadRequest, http.StatusUnprocessableEntity)),
+			},
+			"/api/v1/guides/count": map[string]any{
+				"get": operation("countGuides", "Count guides", nil, nil,
+					response("Guide count", map[string]any{
+						"type":       "object",
+						"required":   []string{"count"},
+						"properties": map[string]any{"count": map[string]any{"type": "integer", "minimum": 0}},
+					})),
+			},
+			"/api/v1/guides/nearby": map[string]any{
+				"get": operation("nearbyGuides", "List guides within radius of a coordinate, closest first", nearby, nil,
+					response("Guides with distance_km", arrayOf("Guide")), errorResponses(http.StatusUnprocessableEntity)),
+			},
+			"/api/v1/guides/{id}": map[string]any{
+				"parameters": []any{guideID},
+				"get": operation("getGuide", "Get a guide", nil, nil,
+					response("Guide", ref("Guide")), errorResponses(http.StatusBadRequest, http.StatusNotFound)),
+				"put": operation("updateGuide", "Update a guide", nil, requestBody("GuideInput"),
+					response("Guide", ref("Guide")), errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity)),
+				"delete": operation("deleteGuide", "Delete a guide without points of interest", nil, nil,
+					noContentResponse(), errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict)),
+			},
+			"/api/v1/guides/{id}/pois": map[string]any{
+				"parameters": []any{guideID},
+				"get": operation("listPois", "List the points of interest of a guide", nil, nil,
+					response("Points of interest", arrayOf("Poi")), errorResponses(http.StatusBadRequest, http.StatusNotFound)),
+				"post": operation("createPoi", "Create a point of interest", nil, requestBody("PoiInput"),
+					createdResponse("Poi"), errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity)),
+			},
+			"/api/v1/guides/{id}/pois/nearby": map[string]any{
+				"parameters": []any{guideID},
+				"get": operation("nearbyPois", "List points of interest of a guide within radius of a coordinate, closest first", nearby, nil,
+					response("Points of interest with distance_km", arrayOf("Poi")), errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity)),
+			},
+			"/api/v1/guides/{id}/pois/{poiID}": map[string]any{
+				"parameters": []any{guideID, poiID},
+				"get": operation("getPoi", "Get a point of interest", nil, nil,
+					response("Point of interest", ref("Poi")), errorResponses(http.StatusBadRequest, http.StatusNotFound)),
+				"put": operation("updatePoi", "Update a point of interest", nil, requestBody("PoiInput"),
+					response("Point of interest", ref("Poi")), errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity)),
+				"delete": operation("deletePoi", "Delete a point of interest", nil, nil,
+					noContentResponse(), errorResponses(http.StatusBadRequest, http.StatusNotFound)),
+			},
+		},
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"Guide": map[string]any{
+					"type":     "object",
+					"required": []string{"id", "name", "description", "latitude", "longitude"},
+					"properties": map[string]any{
+						"id":             map[string]any{"type": "integer", "format": "int64"},
+						"name":           nameSchema,
+						"description":    map[string]any{"type": "string"},
+						"latitude":       latitudeSchema,
+						"longitude":      longitudeSchema,
+						"forked_from_id": map[string]any{"type": "integer", "format": "int64"},
+						"distance_km":    distanceSchema,
+					},
+				},
+				"Poi": map[string]any{
+					"type":     "object",
+					"required": []string{"id", "guide_id", "name", "description", "latitude", "longitude"},
+					"properties": map[string]any{
+						"id":          map[string]any{"type": "integer", "format": "int64"},
+						"guide_id":    map[string]any{"type": "integer", "format": "int64"},
+						"name":        nameSchema,
+						"description": map[string]any{"type": "string"},
+						"latitude":    latitudeSchema,
+						"longitude":   longitudeSchema,
+						"category":    map[string]any{"type": "string"},
+						"distance_km": distanceSchema,
+					},
+				},
+				"GuideInput": inputSchema(nil),
+				"PoiInput":   inputSchema(map[string]any{"category": map[string]any{"type": "string"}}),
+				"Error": map[string]any{
+					"type":     "object",
+					"required": []string{"error"},
+					"properties": map[string]any{
+						"error": map[string]any{"type": "string"},
+						"fields": map[string]any{
+							"type":                 "object",
+							"description":          "validation error of each invalid input field",
+							"additionalProperties": map[string]any{"type": "string"},
+						},
+						"errors": map[string]any{
+							"type":        "array",
+							"description": "all the validation errors, with codes to show them in other languages",
+							"items": map[string]any{
+								"type":     "object",
+								"required": []string{"code", "message"},
+								"properties": map[string]any{
+									"field":   map[string]any{"type": "string"},
+									"code":    map[string]any{"type": "string"},
+									"message": map[string]any{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+var (
+	nameSchema      = map[string]any{"type": "string", "minLength": 1}
+	latitudeSchema  = map[string]any{"type": "number", "format": "double", "minimum": -90, "maximum": 90}
+	longitudeSchema = map[string]any{"type": "number", "format": "double", "minimum": -180, "maximum": 180}
+	distanceSchema  = map[string]any{"type": "number", "format": "double", "description": "only on nearby results"}
+)
+
+// inputSchema is the request body schema to create or update guides and pois, with the
+// extra properties of the resource. The read-only properties of the responses are accepted
+// and ignored, so a client can send back an object it received.
+func inputSchema(extra map[string]any) map[string]any {
+	id := map[string]any{"type": "integer", "format": "int64", "readOnly": true}
+	properties := map[string]any{
+		"name":           nameSchema,
+		"description":    map[string]any{"type": "string", "description": "Markdown"},
+		"latitude":       latitudeSchema,
+		"longitude":      longitudeSchema,
+		"id":             id,
+		"guide_id":       id,
+		"forked_from_id": id,
+		"distance_km":    map[string]any{"type": "number", "format": "double", "readOnly": true},
+	}
+	for name, schema := range extra {
+		properties[name] = schema
+	}
+	return map[string]any{
+		"type":                 "object",
+		"required":             []string{"name", "latitude", "longitude"},
+		"additionalProperties": false,
+		"properties":           properties,
+	}
+}
+
+func ref(schema string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + schema}
+}
+
+func arrayOf(schema string) map[string]any {
+	return map[string]any{"type": "array", "items": ref(schema)}
+}
+
+func pathParameter(name, description string) map[string]any {
+	return map[string]any{
+		"name":        name,
+		"in":          "path",
+		"required":    true,
+		"description": description,
+		"schema":      map[string]any{"type": "integer", "format": "int64"},
+	}
+}
+
+func queryParameter(name string, required bool, schema map[string]any) map[string]any {
+	return map[string]any{
+		"name":     name,
+		"in":       "query",
+		"required": required,
+		"schema":   schema,
+	}
+}
+
+func requestBody(schema string) map[string]any {
+	return map[string]any{
+		"required": true,
+		"content":  map[string]any{"application/json": map[string]any{"schema": ref(schema)}},
+	}
+}
+
+func response(description string, schema map[string]any) map[string]any {
+	return map[string]any{
+		"200": map[string]any{
+			"description": description,
+			"content":     map[string]any{"application/json": map[string]any{"schema": schema}},
+		},
+	}
+}
+
+func createdResponse(schema string) map[string]any {
+	return map[string]any{
+		"201": map[string]any{
+			"description": "Created",
+			"headers": map[string]any{
+				"Location": map[string]any{"description": "URL of the created resource", "schema": map[string]any{"type": "string"}},
+			},
+			"content": map[string]any{"application/json": map[string]any{"schema": ref(schema)}},
+		},
+	}
+}
+
+func noContentResponse() map[string]any {
+	return map[string]any{"204": map[string]any{"description": "Deleted"}}
+}
+
+func errorResponses(statusCodes ...int) map[string]any {
+	responses := map[string]any{}
+	for _, code := range statusCodes {
+		responses[strconv.Itoa(code)] = map[string]any{
+			"description": http.StatusText(code),
+			"content":     map[string]any{"application/json": map[string]any{"schema": ref("Error")}},
+		}
+	}
+	return responses
+}
+
+func operation(id, summary string, parameters []any, body map[string]any, responses ...map[string]any) map[string]any {
+	op := map[string]any{
+		"operationId": id,
+		"summary":     summary,
+	}
+	if parameters != nil {
+		op["parameters"] = parameters
+	}
+	if body != nil {
+		op["requestBody"] = body
+	}
+	merged := map[string]any{}
+	for _, r := range responses {
+		for code, response := range r {
+			merged[code] = response
+		}
+	}
+	op["responses"] = merged
+	return op
+}
+
+// HandleOpenAPISpec serves the OpenAPI document of the JSON API.
+func (s *Server) HandleOpenAPISpec() http.HandlerFunc {
+	spec := openAPISpec()
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, spec)
+	}
+}
@@ -0,0 +1,105 @@
+package guide_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+type openAPIDocument struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Required   []string `json:"required"`
+			Properties map[string]struct {
+				Minimum *float64 `json:"minimum"`
+				Maximum *float64 `json:"maximum"`
+			} `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func getOpenAPIDocument(t *testing.T, handler http.Handler) openAPIDocument {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var doc openAPIDocument
+	err := json.NewDecoder(rr.Body).Decode(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestOpenAPISpecDocumentsEveryAPIRoute(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	routes := server.Routes()
+	doc := getOpenAPIDocument(t, routes)
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("want OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+
+	router, ok := routes.(*mux.Router)
+	if !ok {
+		t.Fatalf("want *mux.Router, got %T", routes)
+	}
+	documented := 0
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, "/api/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("route %s %s is missing from the OpenAPI spec", method, path)
+				continue
+			}
+			documented++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if documented == 0 {
+		t.Error("want API routes to be registered, got none")
+	}
+}
+
+func TestOpenAPISpecSchemas(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	doc := getOpenAPIDocument(t, server.Routes())
+
+	for _, name := range []string{"Guide", "Poi", "GuideInput", "PoiInput"} {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("want schema %s", name)
+			continue
+		}
+		if !slices.Contains(schema.Required, "name") {
+			t.Errorf("want name required in schema %s, got %v", name, schema.Required)
+		}
+		for property, bound := range map[string]float64{"latitude": 90, "longitude": 180} {
+			p := schema.Properties[property]
+			if p.Minimum == nil || p.Maximum == nil || *p.Minimum != -bound || *p.Maximum != bound {
+				t.Errorf("want %s of schema %s in range [%v, %v]", property, name, -bound, bound)
+			}
+		}
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 )
 
 type Server struct {
@@ -18,9 +20,29 @@ type Server struct {
 	*http.Server
 	output           io.Writer
 	templateRegistry *templateRegistry
+	// mediaDir is the directory of uploaded media, included in backups when set.
+	mediaDir string
+	// tiles serves the map tiles on the tile route, when set, and tileLayer is the base map of the
+	// pages.
+	tiles     tileSource
+	tileLayer tileLayer
+	// poiTiles caches the vector tiles of the guide pois, the store invalidates them.
+	poiTiles *poiTileCache
+	// geocoder resolves the addresses of the forms, when set.
+	geocoder Geocoder
 }
 
-func NewServer(address string, store Storage, output io.Writer) (Server, error) {
+type serverOption func(*Server) error
+
+// WithMediaDir sets the directory of uploaded media.
+func WithMediaDir(dir string) serverOption {
+	return func(s *Server) error {
+		s.mediaDir = dir
+		return nil
+	}
+}
+
+func NewServer(address string, store Storage, output io.Writer, opts ...serverOption) (Server, error) {
 	if address == "" {
 		return Server{}, errors.New("server address cannot be empty")
 	}
@@ -33,10 +55,19 @@ func NewServer(address string, store Storage, output io.Writer) (Server, error)
 		Server: &http.Server{
 			Addr: address,
 		},
-		output: output,
+		output:    output,
+		tileLayer: osmTileLayer,
+	}
+	for _, opt := range opts {
+		err := opt(&server)
+		if err != nil {
+			return Server{}, err
+		}
 	}
 
-	server.templateRegistry = templateRoutes()
+	server.poiTiles = newPoiTileCache(poiTileCacheSize)
+	server.store = poiTileStore{Storage: store, tiles: server.poiTiles}
+	server.templateRegistry = templateRoutes(server.tileLayer, server.geocoder != nil)
 	server.Handler = server.Routes()
 	return server, nil
 }
@@ -49,22 +80,55 @@ func HandleIndex() http.HandlerFunc {
 
 func (s *Server) HandleGuides() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, ok := negotiateOrReject(w, r)
+		if !ok {
+			return
+		}
 		terms := r.URL.Query().Get("q")
 		guides, err := s.store.Search(terms)
 		if err != nil || (len(guides) == 0 && terms != "") {
 			http.Error(w, "no guide found", http.StatusNotFound)
 			return
 		}
+		translations, err := s.store.GetAllGuideTranslations()
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		preferred := preferredLocales(r)
+		for i := range guides {
+			if t, ok := translations[guides[i].Id]; ok {
+				t.localize(&guides[i], t.match(preferred))
+			}
+		}
+		addVary(w, "Accept-Language")
+
+		switch mediaType {
+		case mediaTypeJSON:
+			result := make([]apiGuide, 0, len(guides))
+			for _, g := range guides {
+				result = append(result, newAPIGuide(g))
+			}
+			writeJSON(w, http.StatusOK, result)
+			return
+		case mediaTypeGeoJSON:
+			features := make([]geoJSONFeature, 0, len(guides))
+			for _, g := range guides {
+				features = append(features, guideFeature(g))
+			}
+			writeGeoJSON(w, newGeoJSONFeatureCollection(features...))
+			return
+		}
 
 		if r.Header.Get("HX-Trigger") == "search" {
-			err = s.templateRegistry.renderPartial(w, guideRowsTemplate, guides)
+			err = s.templates(w, r).renderPartial(w, guideRowsTemplate, guides)
 			if err != nil {
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 			}
 			return
 		}
 
-		err = s.templateRegistry.renderPage(w, indexTemplate, guides)
+		err = s.templates(w, r).renderPage(w, indexTemplate, guides)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 		}
@@ -73,6 +137,10 @@ func (s *Server) HandleGuides() http.HandlerFunc {
 
 func (s *Server) HandleGuide() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, ok := negotiateOrReject(w, r)
+		if !ok {
+			return
+		}
 		guideID := mux.Vars(r)["id"]
 		if guideID == "" {
 			http.Error(w, "no guideid provided", http.StatusBadRequest)
@@ -84,19 +152,211 @@ func (s *Server) HandleGuide() http.HandlerFunc {
 			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
 			return
 		}
+		s.serveGuide(w, r, mediaType, id, nil)
+	}
+}
+
+// HandleGuidePermalink serves the guide by its slug, /g/{slug}, and by the slugs of the guide and
+// one of its pois, /g/{slug}/{poiSlug}, with the poi opened. The slugs a guide had before being
+// renamed redirect permanently to its current slug.
+func (s *Server) HandleGuidePermalink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, ok := negotiateOrReject(w, r)
+		if !ok {
+			return
+		}
+		vars := mux.Vars(r)
+		id, slug, err := s.store.ResolveGuideSlug(vars["slug"])
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if id == 0 {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+		poiSlug := vars["poiSlug"]
+		if slug != vars["slug"] {
+			http.Redirect(w, r, guidePermalink(slug, poiSlug), http.StatusMovedPermanently)
+			return
+		}
+
+		var focus *pointOfInterest
+		if poiSlug != "" {
+			focus, err = s.store.GetPoiBySlug(id, poiSlug)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			if focus == nil {
+				http.Error(w, "poi Not Found", http.StatusNotFound)
+				return
+			}
+		}
+		s.serveGuide(w, r, mediaType, id, focus)
+	}
+}
+
+// guidePermalink is the path of the guide with slug, or of its poi with poiSlug if not empty.
+func guidePermalink(slug, poiSlug string) string {
+	if poiSlug == "" {
+		return "/g/" + slug
+	}
+	return "/g/" + slug + "/" + poiSlug
+}
+
+// serveGuide writes the guide with its pois and itineraries as mediaType, in the locale the request
+// prefers, its page opening the focus poi if not nil.
+func (s *Server) serveGuide(w http.ResponseWriter, r *http.Request, mediaType string, id int64, focus *pointOfInterest) {
+	g, err := s.store.GetGuidebyID(id)
+	if err != nil {
+		http.Error(w, "guide Not Found", http.StatusInternalServerError)
+		return
+	}
+	if g == nil {
+		http.Error(w, "guide Not Found", http.StatusNotFound)
+		return
+
+	}
+	g.Pois = s.store.GetAllPois(id)
+	g.Itineraries = s.store.GetAllItineraries(id)
+	translations, err := s.store.GetTranslations(id)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	translations.localize(g, translations.match(preferredLocales(r)))
+	setContentLanguage(w, g.ContentLocale())
+
+	switch mediaType {
+	case mediaTypeJSON:
+		writeJSON(w, http.StatusOK, newAPIGuideDetail(*g))
+		return
+	case mediaTypeGeoJSON:
+		writeGeoJSON(w, guideFeatureCollection(*g))
+		return
+	}
+
+	err = s.templates(w, r).renderPage(w, guideTemplate, guidePage{guide: *g, Focus: focus})
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleGuideGeoJSON downloads the guide and its pois as GeoJSON, to open them in other map tools.
+func (s *Server) HandleGuideGeoJSON() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		g, err := s.store.GetGuidebyID(id)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+		g.Pois = s.store.GetAllPois(id)
+
+		w.Header().Set("Content-Type", mediaTypeGeoJSON)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="guide-%d.geojson"`, id))
+		err = WriteGuideGeoJSON(w, *g)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// HandleGuideGPX downloads the guide pois as GPX waypoints and its itineraries as routes.
+func (s *Server) HandleGuideGPX() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		g, err := s.store.GetGuidebyID(id)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+		g.Pois = s.store.GetAllPois(id)
+		for _, summary := range s.store.GetAllItineraries(id) {
+			i, err := s.store.GetItinerary(id, summary.Id)
+			if err != nil || i == nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			g.Itineraries = append(g.Itineraries, *i)
+		}
+
+		w.Header().Set("Content-Type", "application/gpx+xml")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="guide-%d.gpx"`, id))
+		err = WriteGuideGPX(w, *g)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// HandleGuideKML downloads the guide pois as KML, to open them in Google Earth.
+func (s *Server) HandleGuideKML() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
 		g, err := s.store.GetGuidebyID(id)
 		if err != nil {
-			http.Error(w, "guide Not Found", http.StatusInternalServerError)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
 		if g == nil {
 			http.Error(w, "guide Not Found", http.StatusNotFound)
 			return
+		}
+		g.Pois = s.store.GetAllPois(id)
+
+		w.Header().Set("Content-Type", "application/vnd.google-earth.kml+xml")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="guide-%d.kml"`, id))
+		err = WriteGuideKML(w, *g)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
 
+// HandleGuideCSV downloads the guide pois as CSV, to edit them in a spreadsheet.
+func (s *Server) HandleGuideCSV() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		g, err := s.store.GetGuidebyID(id)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
 		}
 		g.Pois = s.store.GetAllPois(id)
 
-		err = s.templateRegistry.renderPage(w, guideTemplate, g)
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="guide-%d.csv"`, id))
+		err = WriteGuideCSV(w, *g)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 		}
@@ -112,7 +372,8 @@ func (s *Server) HandleGuideCount() http.HandlerFunc {
 
 func (s *Server) HandleCreateGuideGet() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := s.templateRegistry.renderPage(w, createGuideFormTemplate, nil)
+		guideForm := guideForm{cityChoice: s.newCityChoice(cityAuto, "", "")}
+		err := s.templates(w, r).renderPage(w, createGuideFormTemplate, guideForm)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 		}
@@ -127,23 +388,48 @@ func (s *Server) HandleCreateGuidePost() http.HandlerFunc {
 			Description: r.PostFormValue("description"),
 			Latitude:    r.PostFormValue("latitude"),
 			Longitude:   r.PostFormValue("longitude"),
-			Errors:      []string{},
+			Language:    r.PostFormValue("language"),
+			Address:     r.PostFormValue("address"),
+		}
+		err := s.resolveAddress(guideForm.Address, &guideForm.Latitude, &guideForm.Longitude)
+		guideForm.cityChoice = s.newCityChoice(r.PostFormValue("city"), guideForm.Latitude, guideForm.Longitude)
+		if err != nil {
+			guideForm.addError(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			err := s.templates(w, r).renderPage(w, createGuideFormTemplate, guideForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		g, err := NewGuide(guideForm.Name, WithValidStringCoordinates(guideForm.Latitude, guideForm.Longitude), WithDescription(guideForm.Description), WithLanguage(guideForm.Language))
+		if err != nil {
+			guideForm.addError(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			err := s.templates(w, r).renderPage(w, createGuideFormTemplate, guideForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
 		}
-		g, err := NewGuide(guideForm.Name, WithValidStringCoordinates(guideForm.Latitude, guideForm.Longitude), WithDescription(guideForm.Description))
+		g.CityID, err = guideForm.cityID()
 		if err != nil {
-			guideForm.Errors = append(guideForm.Errors, err.Error())
+			guideForm.addError(r, err)
 			w.WriteHeader(http.StatusBadRequest)
-			err := s.templateRegistry.renderPage(w, createGuideFormTemplate, guideForm)
+			err := s.templates(w, r).renderPage(w, createGuideFormTemplate, guideForm)
 			if err != nil {
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 			}
 			return
 		}
+		if u := s.currentUser(r); u != nil {
+			g.OwnerID = u.Id
+		}
 		err = s.store.CreateGuide(&g)
 		if err != nil {
-			guideForm.Errors = append(guideForm.Errors, err.Error())
+			guideForm.addError(r, err)
 			w.WriteHeader(http.StatusBadRequest)
-			err := s.templateRegistry.renderPage(w, createGuideFormTemplate, guideForm)
+			err := s.templates(w, r).renderPage(w, createGuideFormTemplate, guideForm)
 			if err != nil {
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 			}
@@ -184,9 +470,14 @@ func (s *Server) HandleEditGuideGet() http.HandlerFunc {
 			Description: g.Description,
 			Latitude:    fmt.Sprintf("%f", g.Coordinate.Latitude),
 			Longitude:   fmt.Sprintf("%f", g.Coordinate.Longitude),
-			Errors:      []string{},
+			Language:    g.Language,
+		}
+		city := ""
+		if g.CityID != 0 {
+			city = strconv.FormatInt(g.CityID, 10)
 		}
-		err = s.templateRegistry.renderPage(w, editGuideFormTemplate, guideForm)
+		guideForm.cityChoice = s.newCityChoice(city, guideForm.Latitude, guideForm.Longitude)
+		err = s.templates(w, r).renderPage(w, editGuideFormTemplate, guideForm)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 		}
@@ -217,33 +508,48 @@ func (s *Server) HandleEditGuidePost() http.HandlerFunc {
 		}
 
 		guideForm := guideForm{
+			GuideId:     g.Id,
 			Name:        r.PostFormValue("name"),
 			Description: r.PostFormValue("description"),
 			Latitude:    r.PostFormValue("latitude"),
 			Longitude:   r.PostFormValue("longitude"),
-			Errors:      []string{},
+			Language:    r.PostFormValue("language"),
+		}
+		guideForm.cityChoice = s.newCityChoice(r.PostFormValue("city"), guideForm.Latitude, guideForm.Longitude)
+
+		updated, err := NewGuide(guideForm.Name, WithValidStringCoordinates(guideForm.Latitude, guideForm.Longitude), WithDescription(guideForm.Description), WithLanguage(guideForm.Language))
+		if err != nil {
+			guideForm.addError(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			err := s.templates(w, r).renderPage(w, editGuideFormTemplate, guideForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
 		}
 
-		coordinates, err := parseCoordinates(guideForm.Latitude, guideForm.Longitude)
+		cityID, err := guideForm.cityID()
 		if err != nil {
-			guideForm.Errors = append(guideForm.Errors, err.Error())
+			guideForm.addError(r, err)
 			w.WriteHeader(http.StatusBadRequest)
-			err := s.templateRegistry.renderPage(w, createGuideFormTemplate, guideForm)
+			err := s.templates(w, r).renderPage(w, editGuideFormTemplate, guideForm)
 			if err != nil {
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 			}
 			return
 		}
 
-		g.Name = guideForm.Name
-		g.Description = guideForm.Description
-		g.Coordinate = coordinates
+		g.Name = updated.Name
+		g.Description = updated.Description
+		g.Coordinate = updated.Coordinate
+		g.Language = updated.Language
+		g.CityID = cityID
 
 		err = s.store.UpdateGuide(g)
 		if err != nil {
-			guideForm.Errors = append(guideForm.Errors, err.Error())
+			guideForm.addError(r, err)
 			w.WriteHeader(http.StatusBadRequest)
-			err := s.templateRegistry.renderPage(w, createGuideFormTemplate, guideForm)
+			err := s.templates(w, r).renderPage(w, editGuideFormTemplate, guideForm)
 			if err != nil {
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 			}
@@ -268,6 +574,10 @@ func (s *Server) HandleDeleteGuide() http.HandlerFunc {
 			return
 		}
 		err = s.store.DeleteGuide(id)
+		if errors.Is(err, errConflict) {
+			http.Error(w, "the guide still has points of interest, delete them before deleting the guide", http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
@@ -280,145 +590,1252 @@ func (s *Server) HandleDeleteGuide() http.HandlerFunc {
 	}
 }
 
-func (s *Server) HandlePoi() http.HandlerFunc {
+// HandleForkGuide copies the guide with all its child data into the account of the current user.
+func (s *Server) HandleForkGuide() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		guideIDString := mux.Vars(r)["guideID"]
-		if guideIDString == "" {
-			http.Error(w, "no guide ID provided", http.StatusBadRequest)
-			return
-		}
-		poiIDString := mux.Vars(r)["poiID"]
-		if poiIDString == "" {
-			http.Error(w, "no poi ID provided", http.StatusBadRequest)
+		guideID := mux.Vars(r)["id"]
+		if guideID == "" {
+			http.Error(w, "no guideid provided", http.StatusBadRequest)
 			return
 		}
-		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+		id, err := strconv.ParseInt(guideID, 10, 64)
 		if err != nil {
 			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
 			return
 		}
-		poiID, err := strconv.ParseInt(poiIDString, 10, 64)
-		if err != nil {
-			http.Error(w, "not able to parse poi ID", http.StatusBadRequest)
+		u := s.currentUser(r)
+		if u == nil {
+			http.Error(w, "please log in to fork guides", http.StatusUnauthorized)
 			return
 		}
 
-		poi, err := s.store.GetPoi(guideID, poiID)
+		fork, err := s.store.ForkGuide(id, u.Id)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
-		if poi == nil {
-			http.Error(w, "point of interest not found", http.StatusNotFound)
+		if fork == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
 			return
 		}
+		gURL := fmt.Sprintf("/guide/%d", fork.Id)
+		http.Redirect(w, r, gURL, http.StatusSeeOther)
+	}
+}
 
-		err = s.templateRegistry.renderPartial(w, poiViewTemplate, poi)
+// HandleCities lists the cities with the count of their guides, on a map.
+func (s *Server) HandleCities() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.templates(w, r).renderPage(w, citiesTemplate, newCityIndex(s.store.GetAllCities()))
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 		}
 	}
 }
 
-// todo implement HandlePois() to map poiRows(clean #table-and-form): cancel button, and search
-func (s *Server) HandleCreatePoiGet() http.HandlerFunc {
+// HandleCity shows the guides of a city on a map.
+func (s *Server) HandleCity() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		guideID := mux.Vars(r)["id"]
-		if guideID == "" {
-			http.Error(w, "no guideid provided", http.StatusBadRequest)
-			return
-		}
-
-		gid, err := strconv.ParseInt(guideID, 10, 64)
-		if err != nil {
-			http.Error(w, "please provide valid guide PoiID", http.StatusBadRequest)
-		}
-
-		g, err := s.store.GetGuidebyID(gid)
+		c, err := s.store.GetCityBySlug(mux.Vars(r)["slug"])
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
-		if g == nil {
-			http.Error(w, "guide Not Found", http.StatusNotFound)
+		if c == nil {
+			http.Error(w, "city Not Found", http.StatusNotFound)
 			return
 		}
-		poiForm := poiForm{
-			GuideID:     gid,
-			GuideName:   g.Name,
-			Name:        r.PostFormValue("name"),
-			Description: r.PostFormValue("description"),
-			Latitude:    r.PostFormValue("latitude"),
-			Longitude:   r.PostFormValue("longitude"),
-		}
-
-		err = s.templateRegistry.renderPartial(w, createPoiFormTemplate, poiForm)
+		c.Guides = s.store.GetCityGuides(c.Id)
+		err = s.templates(w, r).renderPage(w, cityTemplate, c)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 		}
-		return
 	}
 }
 
-func (s *Server) HandleCreatePoiPost() http.HandlerFunc {
+func (s *Server) HandleCreateCityGet() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		guideIDString := mux.Vars(r)["id"]
-		if guideIDString == "" {
-			http.Error(w, "no guideid provided", http.StatusBadRequest)
+		if !s.allowCityAdmin(w, r) {
 			return
 		}
-
-		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
-		if err != nil {
-			http.Error(w, "please provide valid guide id", http.StatusBadRequest)
-		}
-
-		g, err := s.store.GetGuidebyID(guideID)
+		err := s.templates(w, r).renderPage(w, createCityFormTemplate, cityForm{})
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
-			return
 		}
-		if g == nil {
-			http.Error(w, "guide Not Found", http.StatusNotFound)
+	}
+}
+
+// HandleCreateCityPost adds a city. Cities are shared by all the guides, so only admins create them.
+func (s *Server) HandleCreateCityPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowCityAdmin(w, r) {
 			return
 		}
-		poiForm := poiForm{
-			GuideID:     guideID,
-			GuideName:   g.Name,
-			Name:        r.PostFormValue("name"),
-			Description: r.PostFormValue("description"),
-			Latitude:    r.PostFormValue("latitude"),
-			Longitude:   r.PostFormValue("longitude"),
+		cityForm := cityForm{
+			Name:      r.PostFormValue("name"),
+			Country:   r.PostFormValue("country"),
+			Timezone:  r.PostFormValue("timezone"),
+			Latitude:  r.PostFormValue("latitude"),
+			Longitude: r.PostFormValue("longitude"),
+			South:     r.PostFormValue("south"),
+			West:      r.PostFormValue("west"),
+			North:     r.PostFormValue("north"),
+			East:      r.PostFormValue("east"),
+		}
+		c, err := NewCity(cityForm.Name, cityForm.Country, cityForm.Timezone, CityWithValidStringCenter(cityForm.Latitude, cityForm.Longitude), CityWithBounds(cityForm.South, cityForm.West, cityForm.North, cityForm.East))
+		if err == nil {
+			err = s.store.CreateCity(&c)
 		}
-		poi, err := NewPointOfInterest(poiForm.Name, guideID, PoiWithValidStringCoordinates(poiForm.Latitude, poiForm.Longitude), PoiWithDescription(poiForm.Description))
 		if err != nil {
-			poiForm.Errors = append(poiForm.Errors, err.Error())
-			w.WriteHeader(http.StatusBadRequest)
-			err = s.templateRegistry.renderPartial(w, createPoiFormTemplate, poiForm)
-			if err != nil {
-				http.Error(w, "internal server error", http.StatusInternalServerError)
+			cityForm.addError(r, err)
+			status := http.StatusBadRequest
+			if errors.Is(err, errConflict) {
+				status = http.StatusConflict
 			}
-			return
-		}
-		err = s.store.CreatePoi(&poi)
-		if err != nil {
-			poiForm.Errors = append(poiForm.Errors, err.Error())
-			w.WriteHeader(http.StatusBadRequest)
-			err := s.templateRegistry.renderPartial(w, createPoiFormTemplate, poiForm)
+			w.WriteHeader(status)
+			err := s.templates(w, r).renderPage(w, createCityFormTemplate, cityForm)
 			if err != nil {
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 			}
 			return
 		}
+		http.Redirect(w, r, "/city/"+c.Slug, http.StatusSeeOther)
+	}
+}
 
-		pois := s.store.GetAllPois(guideID)
-		err = s.templateRegistry.renderPartial(w, poiRowsTemplate, pois)
+// allowCityAdmin writes the error and returns false unless the current user is an admin.
+func (s *Server) allowCityAdmin(w http.ResponseWriter, r *http.Request) bool {
+	u := s.currentUser(r)
+	if u == nil {
+		http.Error(w, "please log in to create cities", http.StatusUnauthorized)
+		return false
+	}
+	if !u.Admin {
+		http.Error(w, "only admins can create cities", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// HandleSuggestCity renders the city field of the guide forms, suggesting the city of the
+// coordinates as they are typed.
+func (s *Server) HandleSuggestCity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		choice := s.newCityChoice(query.Get("city"), query.Get("latitude"), query.Get("longitude"))
+		err := s.templates(w, r).renderPartial(w, cityFieldTemplate, choice)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// newCityChoice is the city field of the guide forms with the chosen value, suggesting the city of
+// the coordinates when they are valid.
+func (s *Server) newCityChoice(chosen, latitude, longitude string) cityChoice {
+	choice := cityChoice{City: chosen, Cities: s.store.GetAllCities()}
+	c, err := parseCoordinates(latitude, longitude)
+	if err != nil {
+		return choice
+	}
+	choice.Suggested, err = s.store.SuggestCity(c)
+	if err != nil {
+		fmt.Fprintln(s.output, err)
+	}
+	return choice
+}
+
+// HandleMarkdownPreview renders the posted description as it will be shown in guide and poi pages.
+func (s *Server) HandleMarkdownPreview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		preview := renderMarkdown(r.PostFormValue("description"))
+		err := s.templates(w, r).renderPartial(w, markdownPreviewTemplate, preview)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) HandleImportGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		g, err := s.store.GetGuidebyID(guideID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+
+		err = s.templates(w, r).renderPage(w, importFormTemplate, newImportForm(*g))
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// HandleImportPreviewPost reads an uploaded file and previews the pois it would import, with
+// the errors of the ones that will be skipped. Nothing is stored until the preview is committed.
+func (s *Server) HandleImportPreviewPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		g, err := s.store.GetGuidebyID(guideID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+
+		form := newImportForm(*g)
+		form.catalog = catalogs[uiLocale(r)]
+		renderFormError := func(err error) {
+			form.Errors = append(form.Errors, localizeError(r, err))
+			w.WriteHeader(http.StatusBadRequest)
+			err = s.templates(w, r).renderPage(w, importFormTemplate, form)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		err = r.ParseMultipartForm(maxImportSize)
+		if err != nil {
+			renderFormError(errors.New("import file has to be at most 10MB"))
+			return
+		}
+		if key := r.PostFormValue("name_key"); key != "" {
+			form.NameKey = key
+		}
+		if key := r.PostFormValue("description_key"); key != "" {
+			form.DescriptionKey = key
+		}
+		if key := r.PostFormValue("category_key"); key != "" {
+			form.CategoryKey = key
+		}
+		form.Upsert = r.PostFormValue("upsert") == "on"
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			renderFormError(errors.New("please choose a file to import"))
+			return
+		}
+		defer file.Close()
+
+		form.Rows, err = readImportRows(file, header.Filename, form)
+		if err != nil {
+			renderFormError(err)
+			return
+		}
+		if form.Upsert {
+			validateImportIDs(form.Rows, s.store.GetAllPois(guideID), form.catalog)
+		}
+		err = s.templates(w, r).renderPage(w, importFormTemplate, form)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// HandleImportCommitPost creates the valid pois of a preview, all of them or none.
+func (s *Server) HandleImportCommitPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		g, err := s.store.GetGuidebyID(guideID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+
+		err = r.ParseForm()
+		if err != nil {
+			http.Error(w, "not able to parse form", http.StatusBadRequest)
+			return
+		}
+		names := r.PostForm["name"]
+		fields := [][]string{r.PostForm["id"], r.PostForm["description"], r.PostForm["category"], r.PostForm["latitude"], r.PostForm["longitude"], r.PostForm["itinerary"]}
+		if len(fields[5]) == 0 {
+			// imports without itineraries
+			fields[5] = make([]string, len(names))
+		}
+		for _, field := range fields {
+			if len(field) != len(names) {
+				http.Error(w, "not able to parse form", http.StatusBadRequest)
+				return
+			}
+		}
+
+		form := newImportForm(*g)
+		form.Upsert = r.PostFormValue("upsert") == "on"
+		pois := make([]pointOfInterest, 0, len(names))
+		for i, name := range names {
+			row := importRow{Number: i + 1, Name: name, Description: fields[1][i], Category: fields[2][i], Latitude: fields[3][i], Longitude: fields[4][i], Itinerary: fields[5][i]}
+			if form.Upsert {
+				row.ID = fields[0][i]
+			}
+			poi, err := row.poi(guideID)
+			if err != nil {
+				row.Error = localizeError(r, err)
+			}
+			form.Rows = append(form.Rows, row)
+			pois = append(pois, poi)
+		}
+		if len(pois) == 0 {
+			form.Errors = append(form.Errors, localize(r, "there are no points of interest to import"))
+		}
+		if form.InvalidCount() > 0 {
+			form.Errors = append(form.Errors, localize(r, "some points of interest are not valid, nothing was imported"))
+		}
+		if len(form.Errors) == 0 {
+			err = s.store.UpsertPois(pois)
+			if err != nil {
+				form.Errors = append(form.Errors, localizeError(r, err))
+			}
+		}
+		if len(form.Errors) == 0 {
+			err = s.createImportedItineraries(form.Rows, pois, guideID)
+			if err != nil {
+				form.Errors = append(form.Errors, localizeError(r, err))
+			}
+		}
+		if len(form.Errors) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			err = s.templates(w, r).renderPage(w, importFormTemplate, form)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/guide/%d", guideID), http.StatusSeeOther)
+	}
+}
+
+// createImportedItineraries creates the itineraries of the imported rows, once their pois are.
+func (s *Server) createImportedItineraries(rows []importRow, pois []pointOfInterest, guideID int64) error {
+	itineraries, err := importItineraries(rows, pois, guideID)
+	if err != nil {
+		return err
+	}
+	for _, i := range itineraries {
+		err = s.store.CreateItinerary(&i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) HandlePoi() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, ok := negotiateOrReject(w, r)
+		if !ok {
+			return
+		}
+		guideIDString := mux.Vars(r)["guideID"]
+		if guideIDString == "" {
+			http.Error(w, "no guide ID provided", http.StatusBadRequest)
+			return
+		}
+		poiIDString := mux.Vars(r)["poiID"]
+		if poiIDString == "" {
+			http.Error(w, "no poi ID provided", http.StatusBadRequest)
+			return
+		}
+		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		poiID, err := strconv.ParseInt(poiIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse poi ID", http.StatusBadRequest)
+			return
+		}
+
+		poi, err := s.store.GetPoi(guideID, poiID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if poi == nil {
+			http.Error(w, "point of interest not found", http.StatusNotFound)
+			return
+		}
+		translations, err := s.store.GetTranslations(guideID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		locale := translations.match(preferredLocales(r))
+		translations.localizePoi(poi, locale)
+		if locale == "" {
+			locale = translations.Language
+		}
+		setContentLanguage(w, locale)
+
+		switch mediaType {
+		case mediaTypeJSON:
+			writeJSON(w, http.StatusOK, newAPIPoi(*poi))
+			return
+		case mediaTypeGeoJSON:
+			writeGeoJSON(w, poiFeature(*poi))
+			return
+		}
+
+		view := poiView{pointOfInterest: *poi}
+		if s.geocoder != nil {
+			view.Place, err = s.geocoder.ReverseGeocode(poi.Coordinate)
+			if err != nil {
+				// the poi is still worth showing without its address
+				fmt.Fprintln(s.output, err)
+			}
+		}
+		err = s.templates(w, r).renderPartial(w, poiViewTemplate, view)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// todo implement HandlePois() to map poiRows(clean #table-and-form): cancel button, and search
+func (s *Server) HandleCreatePoiGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideID := mux.Vars(r)["id"]
+		if guideID == "" {
+			http.Error(w, "no guideid provided", http.StatusBadRequest)
+			return
+		}
+
+		gid, err := strconv.ParseInt(guideID, 10, 64)
+		if err != nil {
+			http.Error(w, "please provide valid guide PoiID", http.StatusBadRequest)
+		}
+
+		g, err := s.store.GetGuidebyID(gid)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+		poiForm := poiForm{
+			GuideID:     gid,
+			GuideName:   g.Name,
+			GuideSlug:   g.Slug,
+			Name:        r.PostFormValue("name"),
+			Description: r.PostFormValue("description"),
+			Latitude:    r.PostFormValue("latitude"),
+			Longitude:   r.PostFormValue("longitude"),
+		}
+
+		err = s.templates(w, r).renderPartial(w, createPoiFormTemplate, poiForm)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+}
+
+func (s *Server) HandleCreatePoiPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideIDString := mux.Vars(r)["id"]
+		if guideIDString == "" {
+			http.Error(w, "no guideid provided", http.StatusBadRequest)
+			return
+		}
+
+		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "please provide valid guide id", http.StatusBadRequest)
+		}
+
+		g, err := s.store.GetGuidebyID(guideID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+		poiForm := poiForm{
+			GuideID:     guideID,
+			GuideName:   g.Name,
+			GuideSlug:   g.Slug,
+			Name:        r.PostFormValue("name"),
+			Description: r.PostFormValue("description"),
+			Latitude:    r.PostFormValue("latitude"),
+			Longitude:   r.PostFormValue("longitude"),
+			Category:    r.PostFormValue("category"),
+			Address:     r.PostFormValue("address"),
+		}
+		err = s.resolveAddress(poiForm.Address, &poiForm.Latitude, &poiForm.Longitude)
+		if err != nil {
+			poiForm.addError(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			err = s.templates(w, r).renderPartial(w, createPoiFormTemplate, poiForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		poi, err := NewPointOfInterest(poiForm.Name, guideID, PoiWithValidStringCoordinates(poiForm.Latitude, poiForm.Longitude), PoiWithDescription(poiForm.Description), PoiWithCategory(poiForm.Category))
+		if err != nil {
+			poiForm.addError(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			err = s.templates(w, r).renderPartial(w, createPoiFormTemplate, poiForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		err = s.store.CreatePoi(&poi)
+		if err != nil {
+			poiForm.addError(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			err := s.templates(w, r).renderPartial(w, createPoiFormTemplate, poiForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		pois := s.store.GetAllPois(guideID)
+		err = s.templates(w, r).renderPartial(w, poiRowsTemplate, pois)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+func (s *Server) HandleEditPoiGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideIDString := mux.Vars(r)["guideID"]
+		if guideIDString == "" {
+			http.Error(w, "no guide ID provided", http.StatusBadRequest)
+			return
+		}
+		poiIDString := mux.Vars(r)["poiID"]
+		if poiIDString == "" {
+			http.Error(w, "no poi ID provided", http.StatusBadRequest)
+			return
+		}
+
+		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		poiID, err := strconv.ParseInt(poiIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse poi ID", http.StatusBadRequest)
+			return
+		}
+
+		g, err := s.store.GetGuidebyID(guideID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+
+		poi, err := s.store.GetPoi(guideID, poiID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if poi == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+
+		poiForm := poiForm{
+			PoiID:       poiID,
+			GuideID:     g.Id,
+			GuideName:   g.Name,
+			GuideSlug:   g.Slug,
+			Name:        poi.Name,
+			Description: poi.Description,
+			Latitude:    fmt.Sprintf("%f", poi.Coordinate.Latitude),
+			Longitude:   fmt.Sprintf("%f", poi.Coordinate.Longitude),
+			Category:    poi.Category,
+		}
+
+		err = s.templates(w, r).renderPartial(w, editPoiFormTemplate, poiForm)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+}
+func (s *Server) HandleEditPoiPatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideIDString := mux.Vars(r)["guideID"]
+		if guideIDString == "" {
+			http.Error(w, "no guide ID provided", http.StatusBadRequest)
+			return
+		}
+		poiIDString := mux.Vars(r)["poiID"]
+		if poiIDString == "" {
+			http.Error(w, "no poi ID provided", http.StatusBadRequest)
+			return
+		}
+
+		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		poiID, err := strconv.ParseInt(poiIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse poi ID", http.StatusBadRequest)
+			return
+		}
+
+		g, err := s.store.GetGuidebyID(guideID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+
+		poi, err := s.store.GetPoi(guideID, poiID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if poi == nil {
+			http.Error(w, "poi Not Found", http.StatusNotFound)
+			return
+		}
+		poiForm := poiForm{
+			PoiID:       poiID,
+			GuideID:     guideID,
+			GuideName:   g.Name,
+			GuideSlug:   g.Slug,
+			Name:        r.PostFormValue("name"),
+			Description: r.PostFormValue("description"),
+			Latitude:    r.PostFormValue("latitude"),
+			Longitude:   r.PostFormValue("longitude"),
+			Category:    r.PostFormValue("category"),
+		}
+		updated, err := NewPointOfInterest(poiForm.Name, guideID, PoiWithValidStringCoordinates(poiForm.Latitude, poiForm.Longitude), PoiWithDescription(poiForm.Description), PoiWithCategory(poiForm.Category))
+		if err == nil {
+			poi.Name = updated.Name
+			poi.Description = updated.Description
+			poi.Category = updated.Category
+			poi.Coordinate = updated.Coordinate
+			err = s.store.UpdatePoi(poi)
+		}
+		if err != nil {
+			poiForm.addError(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			err := s.templates(w, r).renderPartial(w, editPoiFormTemplate, poiForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		pois := s.store.GetAllPois(guideID)
+		err = s.templates(w, r).renderPartial(w, poiRowsTemplate, pois)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) HandleDeletePoi() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideIDString := mux.Vars(r)["guideID"]
+		if guideIDString == "" {
+			http.Error(w, "no guide ID provided", http.StatusBadRequest)
+			return
+		}
+		poiIDString := mux.Vars(r)["poiID"]
+		if poiIDString == "" {
+			http.Error(w, "no poi ID provided", http.StatusBadRequest)
+			return
+		}
+		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		poiID, err := strconv.ParseInt(poiIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse poi ID", http.StatusBadRequest)
+			return
+		}
+
+		err = s.store.DeletePoi(guideID, poiID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if mux.Vars(r)["HX-Trigger"] == "delete-btn" {
+			http.Redirect(w, r, "/guides", http.StatusSeeOther)
+		}
+		w.WriteHeader(http.StatusSeeOther)
+	}
+}
+
+func (s *Server) HandleItinerary() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideIDString := mux.Vars(r)["guideID"]
+		if guideIDString == "" {
+			http.Error(w, "no guide ID provided", http.StatusBadRequest)
+			return
+		}
+		itineraryIDString := mux.Vars(r)["itineraryID"]
+		if itineraryIDString == "" {
+			http.Error(w, "no itinerary ID provided", http.StatusBadRequest)
+			return
+		}
+		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		itineraryID, err := strconv.ParseInt(itineraryIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse itinerary ID", http.StatusBadRequest)
+			return
+		}
+
+		i, err := s.store.GetItinerary(guideID, itineraryID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if i == nil {
+			http.Error(w, "itinerary not found", http.StatusNotFound)
+			return
+		}
+
+		err = s.templates(w, r).renderPage(w, itineraryTemplate, i)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) HandleCreateItineraryGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideID := mux.Vars(r)["id"]
+		if guideID == "" {
+			http.Error(w, "no guideid provided", http.StatusBadRequest)
+			return
+		}
+		gid, err := strconv.ParseInt(guideID, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+
+		g, err := s.store.GetGuidebyID(gid)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+		itineraryForm := itineraryForm{
+			GuideID:   gid,
+			GuideName: g.Name,
+			GuideSlug: g.Slug,
+			Pois:      s.store.GetAllPois(gid),
+			Selected:  map[int64]bool{},
+		}
+
+		err = s.templates(w, r).renderPage(w, createItineraryFormTemplate, itineraryForm)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) HandleCreateItineraryPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideIDString := mux.Vars(r)["id"]
+		if guideIDString == "" {
+			http.Error(w, "no guideid provided", http.StatusBadRequest)
+			return
+		}
+		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+
+		g, err := s.store.GetGuidebyID(guideID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+
+		err = r.ParseForm()
+		if err != nil {
+			http.Error(w, "not able to parse form", http.StatusBadRequest)
+			return
+		}
+		itineraryForm := itineraryForm{
+			GuideID:   guideID,
+			GuideName: g.Name,
+			GuideSlug: g.Slug,
+			Name:      r.PostFormValue("name"),
+			Pois:      s.store.GetAllPois(guideID),
+			Selected:  map[int64]bool{},
+		}
+
+		renderFormError := func(err error) {
+			itineraryForm.addError(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			err = s.templates(w, r).renderPage(w, createItineraryFormTemplate, itineraryForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+		}
+
+		pois, err := selectPois(itineraryForm.Pois, r.PostForm["poi"])
+		if err != nil {
+			renderFormError(err)
+			return
+		}
+		for _, poi := range pois {
+			itineraryForm.Selected[poi.Id] = true
+		}
+		i, err := NewItinerary(itineraryForm.Name, guideID, ItineraryWithPois(pois...))
+		if err != nil {
+			renderFormError(err)
+			return
+		}
+		err = s.store.CreateItinerary(&i)
+		if err != nil {
+			renderFormError(err)
+			return
+		}
+		iURL := fmt.Sprintf("/guide/%d/itinerary/%d", guideID, i.Id)
+		http.Redirect(w, r, iURL, http.StatusSeeOther)
+	}
+}
+
+// HandleItineraryOrderPost saves the visiting order posted by the drag-to-reorder list as repeated poi values.
+func (s *Server) HandleItineraryOrderPost() http.HandlerFunc {
+	return s.handleItineraryReorder(func(r *http.Request, i *itinerary) error {
+		err := r.ParseForm()
+		if err != nil {
+			return err
+		}
+		pois, err := selectPois(i.Pois, r.PostForm["poi"])
+		if err != nil {
+			return err
+		}
+		if len(pois) != len(i.Pois) {
+			return errors.New("new order has to contain every itinerary poi")
+		}
+		i.Pois = pois
+		return nil
+	})
+}
+
+// HandleSuggestItineraryOrder reorders the itinerary following suggestOrder.
+func (s *Server) HandleSuggestItineraryOrder() http.HandlerFunc {
+	return s.handleItineraryReorder(func(r *http.Request, i *itinerary) error {
+		i.Pois = suggestOrder(i.Pois)
+		return nil
+	})
+}
+
+func (s *Server) handleItineraryReorder(reorder func(*http.Request, *itinerary) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideIDString := mux.Vars(r)["guideID"]
+		if guideIDString == "" {
+			http.Error(w, "no guide ID provided", http.StatusBadRequest)
+			return
+		}
+		itineraryIDString := mux.Vars(r)["itineraryID"]
+		if itineraryIDString == "" {
+			http.Error(w, "no itinerary ID provided", http.StatusBadRequest)
+			return
+		}
+		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		itineraryID, err := strconv.ParseInt(itineraryIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse itinerary ID", http.StatusBadRequest)
+			return
+		}
+
+		i, err := s.store.GetItinerary(guideID, itineraryID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if i == nil {
+			http.Error(w, "itinerary not found", http.StatusNotFound)
+			return
+		}
+
+		err = reorder(r, i)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = s.store.UpdateItineraryPois(i)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		err = s.templates(w, r).renderPartial(w, itineraryPoisTemplate, i)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) HandleDeleteItinerary() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideIDString := mux.Vars(r)["guideID"]
+		if guideIDString == "" {
+			http.Error(w, "no guide ID provided", http.StatusBadRequest)
+			return
+		}
+		itineraryIDString := mux.Vars(r)["itineraryID"]
+		if itineraryIDString == "" {
+			http.Error(w, "no itinerary ID provided", http.StatusBadRequest)
+			return
+		}
+		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		itineraryID, err := strconv.ParseInt(itineraryIDString, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse itinerary ID", http.StatusBadRequest)
+			return
+		}
+
+		err = s.store.DeleteItinerary(guideID, itineraryID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("HX-Redirect", fmt.Sprintf("/guide/%d", guideID))
+		w.WriteHeader(http.StatusSeeOther)
+	}
+}
+
+// selectPois returns the pois matching the ids in the given order. It errors if an id
+// is not a number or doesn't belong to pois.
+func selectPois(pois []pointOfInterest, ids []string) ([]pointOfInterest, error) {
+	byID := map[int64]pointOfInterest{}
+	for _, poi := range pois {
+		byID[poi.Id] = poi
+	}
+
+	selected := make([]pointOfInterest, 0, len(ids))
+	seen := map[int64]bool{}
+	for _, idString := range ids {
+		id, err := strconv.ParseInt(idString, 10, 64)
+		if err != nil {
+			return nil, errors.New("not able to parse poi ID")
+		}
+		poi, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("poi %d not found", id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("poi %d is repeated", id)
+		}
+		seen[id] = true
+		selected = append(selected, poi)
+	}
+	return selected, nil
+}
+
+func (s *Server) HandleSignupGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.templates(w, r).renderPage(w, createUserFormTemplate, userForm{})
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) HandleSignupPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userForm := userForm{
+			Username: r.PostFormValue("username"),
+			Email:    r.PostFormValue("email"),
+		}
+		u, err := newUser(userForm.Username, r.PostFormValue("password"), r.PostFormValue("confirm-password"), userForm.Email)
+		if err != nil {
+			userForm.addError(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			err = s.templates(w, r).renderPage(w, createUserFormTemplate, userForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		existing, err := s.store.GetUserByUsername(u.Username)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			userForm.addError(r, newValidationError("username", errUsernameTaken))
+			w.WriteHeader(http.StatusBadRequest)
+			err = s.templates(w, r).renderPage(w, createUserFormTemplate, userForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		err = s.store.CreateUser(&u)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		err = s.startSession(w, u.Id)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/guides", http.StatusSeeOther)
+	}
+}
+
+func (s *Server) HandleLoginGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.templates(w, r).renderPage(w, loginFormTemplate, userForm{})
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) HandleLoginPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userForm := userForm{
+			Username: r.PostFormValue("username"),
+		}
+		u, err := s.store.GetUserByUsername(userForm.Username)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if u == nil || !verifyPassword(u.Password, r.PostFormValue("password")) {
+			userForm.Errors = append(userForm.Errors, localize(r, "invalid username or password"))
+			w.WriteHeader(http.StatusUnauthorized)
+			err = s.templates(w, r).renderPage(w, loginFormTemplate, userForm)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		err = s.startSession(w, u.Id)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/guides", http.StatusSeeOther)
+	}
+}
+
+func (s *Server) HandleLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookieName)
+		if err == nil {
+			err = s.store.DeleteSession(cookie.Value)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/", MaxAge: -1})
+		http.Redirect(w, r, "/guides", http.StatusSeeOther)
+	}
+}
+
+// HandleUserNav renders the navigation links of the current user. base.html loads it with htmx.
+func (s *Server) HandleUserNav() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.templates(w, r).renderPartial(w, userNavTemplate, s.currentUser(r))
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) startSession(w http.ResponseWriter, userID int64) error {
+	token, err := newSessionToken()
+	if err != nil {
+		return err
+	}
+	err = s.store.CreateSession(token, userID)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// currentUser returns the logged-in user of the request or nil for anonymous users.
+func (s *Server) currentUser(r *http.Request) *user {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil
+	}
+	u, err := s.store.GetSessionUser(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// HandleAdminBackup downloads a consistent snapshot of the database, taken while the server keeps
+// running. With media=true and a media directory it downloads a tar.gz archive including the media.
+func (s *Server) HandleAdminBackup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := s.currentUser(r)
+		if u == nil {
+			http.Error(w, "please log in to download backups", http.StatusUnauthorized)
+			return
+		}
+		if !u.Admin {
+			http.Error(w, "only admins can download backups", http.StatusForbidden)
+			return
+		}
+
+		tmpDir, err := os.MkdirTemp("", "cityguide-backup")
+		if err != nil {
+			fmt.Fprintln(s.output, err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		defer os.RemoveAll(tmpDir)
+		filename := "city_guide-" + time.Now().UTC().Format("20060102-150405")
+		mediaDir := ""
+		if r.URL.Query().Get("media") == "true" {
+			mediaDir = s.mediaDir
+		}
+		if mediaDir == "" {
+			filename += ".db"
+		} else {
+			filename += ".tar.gz"
+		}
+		backup := filepath.Join(tmpDir, filename)
+		err = createBackup(s.store, backup, mediaDir)
 		if err != nil {
+			fmt.Fprintln(s.output, err)
 			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if mediaDir == "" {
+			w.Header().Set("Content-Type", "application/vnd.sqlite3")
+		} else {
+			w.Header().Set("Content-Type", "application/gzip")
 		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		http.ServeFile(w, r, backup)
 	}
 }
-func (s *Server) HandleEditPoiGet() http.HandlerFunc {
+
+// HandleFavorite renders the favorite button of a guide with its favorite count. On POST it toggles the
+// favorite of the current user first.
+func (s *Server) HandleFavorite() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideID := mux.Vars(r)["id"]
+		if guideID == "" {
+			http.Error(w, "no guideid provided", http.StatusBadRequest)
+			return
+		}
+		id, err := strconv.ParseInt(guideID, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+
+		var userID int64
+		u := s.currentUser(r)
+		if u != nil {
+			userID = u.Id
+		}
+		if r.Method == http.MethodPost {
+			if u == nil {
+				http.Error(w, "please log in to favorite guides", http.StatusUnauthorized)
+				return
+			}
+			err = s.store.ToggleFavorite(userID, id)
+			if err != nil {
+				http.Error(w, "guide not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		f, err := s.store.GetFavorite(userID, id)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		err = s.templates(w, r).renderPartial(w, favoriteButtonTemplate, f)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// HandlePoiLists renders the save-to-list buttons of a poi for the current user. On POST it toggles the poi
+// in the list given by listID first.
+func (s *Server) HandlePoiLists() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		guideIDString := mux.Vars(r)["guideID"]
 		if guideIDString == "" {
@@ -430,7 +1847,6 @@ func (s *Server) HandleEditPoiGet() http.HandlerFunc {
 			http.Error(w, "no poi ID provided", http.StatusBadRequest)
 			return
 		}
-
 		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
 		if err != nil {
 			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
@@ -442,69 +1858,158 @@ func (s *Server) HandleEditPoiGet() http.HandlerFunc {
 			return
 		}
 
-		g, err := s.store.GetGuidebyID(guideID)
-		if err != nil {
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+		u := s.currentUser(r)
+		if u == nil {
+			if r.Method == http.MethodPost {
+				http.Error(w, "please log in to save points of interest", http.StatusUnauthorized)
+			}
 			return
 		}
-		if g == nil {
-			http.Error(w, "guide Not Found", http.StatusNotFound)
-			return
+
+		if r.Method == http.MethodPost {
+			listID, err := strconv.ParseInt(mux.Vars(r)["listID"], 10, 64)
+			if err != nil {
+				http.Error(w, "not able to parse list ID", http.StatusBadRequest)
+				return
+			}
+			poi, err := s.store.GetPoi(guideID, poiID)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			if poi == nil {
+				http.Error(w, "point of interest not found", http.StatusNotFound)
+				return
+			}
+			err = s.store.ToggleListPoi(u.Id, listID, poiID)
+			if err != nil {
+				http.Error(w, "list not found", http.StatusNotFound)
+				return
+			}
 		}
 
-		poi, err := s.store.GetPoi(guideID, poiID)
+		poiLists := poiLists{
+			GuideID: guideID,
+			PoiID:   poiID,
+			Lists:   s.store.GetAllLists(u.Id),
+		}
+		err = s.templates(w, r).renderPartial(w, poiListsTemplate, poiLists)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
-			return
 		}
-		if poi == nil {
-			http.Error(w, "guide Not Found", http.StatusNotFound)
+	}
+}
+
+func (s *Server) HandleLists() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := s.currentUser(r)
+		if u == nil {
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
 
-		poiForm := poiForm{
-			PoiID:       poiID,
-			GuideID:     g.Id,
-			GuideName:   g.Name,
-			Name:        poi.Name,
-			Description: poi.Description,
-			Latitude:    fmt.Sprintf("%f", poi.Coordinate.Latitude),
-			Longitude:   fmt.Sprintf("%f", poi.Coordinate.Longitude),
-			Errors:      []string{},
+		myLists := myLists{
+			Username:  u.Username,
+			Favorites: s.store.GetFavoriteGuides(u.Id),
+			Lists:     s.store.GetAllLists(u.Id),
+			Errors:    []string{},
 		}
 
-		err = s.templateRegistry.renderPartial(w, editPoiFormTemplate, poiForm)
+		err := s.templates(w, r).renderPage(w, listsTemplate, myLists)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 		}
-		return
 	}
 }
-func (s *Server) HandleEditPoiPatch() http.HandlerFunc {
+
+func (s *Server) HandleCreateListPost() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		guideIDString := mux.Vars(r)["guideID"]
-		if guideIDString == "" {
-			http.Error(w, "no guide ID provided", http.StatusBadRequest)
+		u := s.currentUser(r)
+		if u == nil {
+			http.Error(w, "please log in to create lists", http.StatusUnauthorized)
 			return
 		}
-		poiIDString := mux.Vars(r)["poiID"]
-		if poiIDString == "" {
-			http.Error(w, "no poi ID provided", http.StatusBadRequest)
+
+		l, err := newList(r.PostFormValue("name"), u.Id)
+		if err == nil {
+			err = s.store.CreateList(&l)
+		}
+		if err != nil {
+			myLists := myLists{
+				Username:  u.Username,
+				Favorites: s.store.GetFavoriteGuides(u.Id),
+				Lists:     s.store.GetAllLists(u.Id),
+				Errors:    []string{err.Error()},
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			err = s.templates(w, r).renderPage(w, listsTemplate, myLists)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
 			return
 		}
+		http.Redirect(w, r, "/lists", http.StatusSeeOther)
+	}
+}
 
-		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
+func (s *Server) HandleDeleteList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := s.currentUser(r)
+		if u == nil {
+			http.Error(w, "please log in to delete lists", http.StatusUnauthorized)
+			return
+		}
+		listID, err := strconv.ParseInt(mux.Vars(r)["listID"], 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse list ID", http.StatusBadRequest)
+			return
+		}
+		err = s.store.DeleteList(u.Id, listID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// HandleComments renders the discussion of a guide. guide.html loads it with htmx.
+func (s *Server) HandleComments() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideID := mux.Vars(r)["id"]
+		if guideID == "" {
+			http.Error(w, "no guideid provided", http.StatusBadRequest)
+			return
+		}
+		id, err := strconv.ParseInt(guideID, 10, 64)
 		if err != nil {
 			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
 			return
 		}
-		poiID, err := strconv.ParseInt(poiIDString, 10, 64)
+		g, err := s.store.GetGuidebyID(id)
 		if err != nil {
-			http.Error(w, "not able to parse poi ID", http.StatusBadRequest)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
 			return
 		}
+		s.renderComments(w, r, g)
+	}
+}
 
-		g, err := s.store.GetGuidebyID(guideID)
+func (s *Server) HandleCreateCommentPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guideID := mux.Vars(r)["id"]
+		if guideID == "" {
+			http.Error(w, "no guideid provided", http.StatusBadRequest)
+			return
+		}
+		id, err := strconv.ParseInt(guideID, 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		g, err := s.store.GetGuidebyID(id)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
@@ -513,61 +2018,123 @@ func (s *Server) HandleEditPoiPatch() http.HandlerFunc {
 			http.Error(w, "guide Not Found", http.StatusNotFound)
 			return
 		}
+		u := s.currentUser(r)
+		if u == nil {
+			http.Error(w, "please log in to comment", http.StatusUnauthorized)
+			return
+		}
 
-		poi, err := s.store.GetPoi(guideID, poiID)
+		var parentID int64
+		if parent := r.PostFormValue("parent"); parent != "" {
+			parentID, err = strconv.ParseInt(parent, 10, 64)
+			if err != nil {
+				http.Error(w, "not able to parse parent comment ID", http.StatusBadRequest)
+				return
+			}
+			p, err := s.store.GetComment(id, parentID)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			if p == nil {
+				http.Error(w, "parent comment not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		c, err := NewComment(r.PostFormValue("body"), id, u.Id, CommentReplyTo(parentID))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			s.renderComments(w, r, g, err.Error())
+			return
+		}
+		err = s.store.CreateComment(&c)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
-		if poi == nil {
-			http.Error(w, "poi Not Found", http.StatusNotFound)
+		s.renderComments(w, r, g)
+	}
+}
+
+func (s *Server) HandleEditCommentGet() http.HandlerFunc {
+	return s.handleComment(func(w http.ResponseWriter, r *http.Request, g *guide, c *comment) {
+		if !c.CanEdit {
+			http.Error(w, "only the author can edit a comment", http.StatusForbidden)
 			return
 		}
-		coordinates, err := parseCoordinates(r.PostFormValue("latitude"), r.PostFormValue("longitude"))
+		err := s.templates(w, r).renderPartial(w, editCommentFormTemplate, c)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+func (s *Server) HandleEditCommentPatch() http.HandlerFunc {
+	return s.handleComment(func(w http.ResponseWriter, r *http.Request, g *guide, c *comment) {
+		if !c.CanEdit {
+			http.Error(w, "only the author can edit a comment", http.StatusForbidden)
 			return
 		}
-		poi.Name = r.PostFormValue("name")
-		poi.Description = r.PostFormValue("description")
-		poi.Coordinate = coordinates
-		err = s.store.UpdatePoi(poi)
+		edited, err := NewComment(r.PostFormValue("body"), c.GuideID, c.UserID)
 		if err != nil {
-			poiForm := poiForm{
-				PoiID:       poiID,
-				GuideID:     guideID,
-				GuideName:   g.Name,
-				Name:        poi.Name,
-				Description: poi.Description,
-				Latitude:    r.PostFormValue("latitude"),
-				Longitude:   r.PostFormValue("longitude"),
-			}
-			poiForm.Errors = append(poiForm.Errors, err.Error())
 			w.WriteHeader(http.StatusBadRequest)
-			err := s.templateRegistry.renderPage(w, editPoiFormTemplate, poiForm)
-			if err != nil {
-				http.Error(w, "internal server error", http.StatusInternalServerError)
-			}
+			s.renderComments(w, r, g, err.Error())
 			return
 		}
-		pois := s.store.GetAllPois(guideID)
-		err = s.templateRegistry.renderPartial(w, poiRowsTemplate, pois)
+		c.Body = edited.Body
+		err = s.store.UpdateComment(c)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
 		}
-	}
+		s.renderComments(w, r, g)
+	})
 }
 
-func (s *Server) HandleDeletePoi() http.HandlerFunc {
+// HandleHideComment toggles the visibility of a comment. Only the guide owner can moderate comments.
+func (s *Server) HandleHideComment() http.HandlerFunc {
+	return s.handleComment(func(w http.ResponseWriter, r *http.Request, g *guide, c *comment) {
+		if !c.CanModerate {
+			http.Error(w, "only the guide owner can hide comments", http.StatusForbidden)
+			return
+		}
+		c.Hidden = !c.Hidden
+		err := s.store.UpdateComment(c)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		s.renderComments(w, r, g)
+	})
+}
+
+func (s *Server) HandleDeleteComment() http.HandlerFunc {
+	return s.handleComment(func(w http.ResponseWriter, r *http.Request, g *guide, c *comment) {
+		if !c.CanEdit && !c.CanModerate {
+			http.Error(w, "only the author or the guide owner can delete a comment", http.StatusForbidden)
+			return
+		}
+		err := s.store.DeleteComment(c.GuideID, c.Id)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		s.renderComments(w, r, g)
+	})
+}
+
+// handleComment loads the guide and comment of the request for the current user, who has to be logged in.
+func (s *Server) handleComment(handle func(http.ResponseWriter, *http.Request, *guide, *comment)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		guideIDString := mux.Vars(r)["guideID"]
 		if guideIDString == "" {
 			http.Error(w, "no guide ID provided", http.StatusBadRequest)
 			return
 		}
-		poiIDString := mux.Vars(r)["poiID"]
-		if poiIDString == "" {
-			http.Error(w, "no poi ID provided", http.StatusBadRequest)
+		commentIDString := mux.Vars(r)["commentID"]
+		if commentIDString == "" {
+			http.Error(w, "no comment ID provided", http.StatusBadRequest)
 			return
 		}
 		guideID, err := strconv.ParseInt(guideIDString, 10, 64)
@@ -575,22 +2142,60 @@ func (s *Server) HandleDeletePoi() http.HandlerFunc {
 			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
 			return
 		}
-		poiID, err := strconv.ParseInt(poiIDString, 10, 64)
+		commentID, err := strconv.ParseInt(commentIDString, 10, 64)
 		if err != nil {
-			http.Error(w, "not able to parse poi ID", http.StatusBadRequest)
+			http.Error(w, "not able to parse comment ID", http.StatusBadRequest)
+			return
+		}
+		u := s.currentUser(r)
+		if u == nil {
+			http.Error(w, "please log in to manage comments", http.StatusUnauthorized)
 			return
 		}
 
-		err = s.store.DeletePoi(guideID, poiID)
+		g, err := s.store.GetGuidebyID(guideID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "guide Not Found", http.StatusNotFound)
+			return
+		}
+		c, err := s.store.GetComment(guideID, commentID)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
+		if c == nil || c.Deleted {
+			http.Error(w, "comment not found", http.StatusNotFound)
+			return
+		}
+		c.CanEdit = c.UserID == u.Id
+		c.CanModerate = g.OwnerID != 0 && g.OwnerID == u.Id
+		handle(w, r, g, c)
+	}
+}
 
-		if mux.Vars(r)["HX-Trigger"] == "delete-btn" {
-			http.Redirect(w, r, "/guides", http.StatusSeeOther)
+func (s *Server) renderComments(w http.ResponseWriter, r *http.Request, g *guide, formErrors ...string) {
+	section := commentSection{
+		GuideID: g.Id,
+		Errors:  formErrors,
+	}
+	comments := s.store.GetAllComments(g.Id)
+	if u := s.currentUser(r); u != nil {
+		section.LoggedIn = true
+		for i := range comments {
+			comments[i].CanReply = true
+			comments[i].CanEdit = comments[i].UserID == u.Id
+			comments[i].CanModerate = g.OwnerID != 0 && g.OwnerID == u.Id
 		}
-		w.WriteHeader(http.StatusSeeOther)
+	}
+	section.Comments = threadComments(comments)
+
+	err := s.templates(w, r).renderPartial(w, commentsTemplate, section)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
 	}
 }
 
@@ -609,73 +2214,213 @@ func RunServer(output io.Writer) {
 		fmt.Fprintln(output, "no address provided, defaulting to :8080")
 		address = ":8080"
 	}
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		homeDir, err := homedir.Dir()
-		if err != nil {
-			fmt.Fprintln(output, err)
-			return
-		}
-		dbPath = homeDir
+	err := checkAssetsVendored()
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return
+	}
+	dbPath, err := databasePath()
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return
+	}
+	storage, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return
+	}
+	opts := []serverOption{
+		WithMediaDir(os.Getenv("MEDIA_PATH")),
+	}
+	tiles, err := tileSourceFromEnv(filepath.Dir(dbPath))
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return
+	}
+	if tiles != nil {
+		opts = append(opts, WithTileSource(tiles))
 	}
-	storage, err := OpenSQLiteStorage(dbPath + "/city_guide.db")
+	geocoder, err := geocoderFromEnv(dbPath)
 	if err != nil {
 		fmt.Fprintln(output, err)
 		return
 	}
-	s, err := NewServer(address, storage, output)
+	if geocoder != nil {
+		opts = append(opts, WithGeocoder(geocoder))
+	}
+	s, err := NewServer(address, storage, output, opts...)
 	if err != nil {
 		fmt.Fprintln(output, err)
 		return
 	}
 	s.Run()
 }
+
+// databasePath is the database file in DB_PATH, the home directory by default.
+func databasePath() (string, error) {
+	dir := os.Getenv("DB_PATH")
+	if dir == "" {
+		homeDir, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		dir = homeDir
+	}
+	return filepath.Join(dir, databaseFile), nil
+}
+
 func (s *Server) Routes() http.Handler {
 	router := mux.NewRouter()
+	router.PathPrefix("/static/").Handler(HandleStatic()).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/tiles/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}.png", s.HandleTile()).Methods(http.MethodGet, http.MethodHead)
 	router.HandleFunc("/guides", s.HandleGuides())
+	router.HandleFunc("/cities", s.HandleCities()).Methods(http.MethodGet)
+	router.HandleFunc("/city/create", s.HandleCreateCityGet()).Methods(http.MethodGet)
+	router.HandleFunc("/city/create", s.HandleCreateCityPost()).Methods(http.MethodPost)
+	router.HandleFunc("/city/suggest", s.HandleSuggestCity()).Methods(http.MethodGet)
+	router.HandleFunc("/city/{slug}", s.HandleCity()).Methods(http.MethodGet)
+	router.HandleFunc("/admin/backup", s.HandleAdminBackup()).Methods(http.MethodGet)
+	router.HandleFunc("/g/{slug}", s.HandleGuidePermalink()).Methods(http.MethodGet)
+	router.HandleFunc("/g/{slug}/{poiSlug}", s.HandleGuidePermalink()).Methods(http.MethodGet)
 	router.HandleFunc("/guide/create", s.HandleCreateGuideGet()).Methods(http.MethodGet)
 	router.HandleFunc("/guide/create", s.HandleCreateGuidePost()).Methods(http.MethodPost)
 	router.HandleFunc("/guide/count", s.HandleGuideCount()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{id:[0-9]+}.geojson", s.HandleGuideGeoJSON()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{id:[0-9]+}.gpx", s.HandleGuideGPX()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{id:[0-9]+}.kml", s.HandleGuideKML()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{id:[0-9]+}.csv", s.HandleGuideCSV()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{id:[0-9]+}/tiles/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}.pbf", s.HandlePoiTile()).Methods(http.MethodGet)
 	router.HandleFunc("/guide/{id}", s.HandleDeleteGuide()).Methods(http.MethodDelete)
 	router.HandleFunc("/guide/{id}", s.HandleGuide())
 	router.HandleFunc("/guide/{id}/edit", s.HandleEditGuideGet()).Methods(http.MethodGet)
 	router.HandleFunc("/guide/{id}/edit", s.HandleEditGuidePost()).Methods(http.MethodPost)
+	router.HandleFunc("/guide/{id}/fork", s.HandleForkGuide()).Methods(http.MethodPost)
 
 	//POI *-> guide
 	router.HandleFunc("/guide/{id}/poi/create", s.HandleCreatePoiGet()).Methods(http.MethodGet)
 	router.HandleFunc("/guide/{id}/poi/create", s.HandleCreatePoiPost()).Methods(http.MethodPost)
+	router.HandleFunc("/guide/{id}/translations", s.HandleTranslationsGet()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{id}/translations", s.HandleTranslationsPost()).Methods(http.MethodPost)
+	router.HandleFunc("/guide/{id}/translations/{locale}", s.HandleDeleteTranslations()).Methods(http.MethodDelete)
+	router.HandleFunc("/guide/{id}/import", s.HandleImportGet()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{id}/import", s.HandleImportPreviewPost()).Methods(http.MethodPost)
+	router.HandleFunc("/guide/{id}/import/commit", s.HandleImportCommitPost()).Methods(http.MethodPost)
 	router.HandleFunc("/guide/{guideID}/poi/{poiID}", s.HandlePoi()).Methods(http.MethodGet)
 	router.HandleFunc("/guide/{guideID}/poi/{poiID}/edit", s.HandleEditPoiGet()).Methods(http.MethodGet)
 	router.HandleFunc("/guide/{guideID}/poi/{poiID}", s.HandleEditPoiPatch()).Methods(http.MethodPatch)
 	router.HandleFunc("/guide/{guideID}/poi/{poiID}", s.HandleDeletePoi()).Methods(http.MethodDelete)
+
+	//itinerary *-> guide
+	router.HandleFunc("/guide/{id}/itinerary/create", s.HandleCreateItineraryGet()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{id}/itinerary/create", s.HandleCreateItineraryPost()).Methods(http.MethodPost)
+	router.HandleFunc("/guide/{guideID}/itinerary/{itineraryID}", s.HandleItinerary()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{guideID}/itinerary/{itineraryID}", s.HandleDeleteItinerary()).Methods(http.MethodDelete)
+	router.HandleFunc("/guide/{guideID}/itinerary/{itineraryID}/order", s.HandleItineraryOrderPost()).Methods(http.MethodPost)
+	router.HandleFunc("/guide/{guideID}/itinerary/{itineraryID}/suggest", s.HandleSuggestItineraryOrder()).Methods(http.MethodPost)
+	router.HandleFunc("/markdown/preview", s.HandleMarkdownPreview()).Methods(http.MethodPost)
+	router.HandleFunc("/geocode", s.HandleGeocode()).Methods(http.MethodGet)
+
+	//comment *-> guide
+	router.HandleFunc("/guide/{id}/comments", s.HandleComments()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{id}/comments", s.HandleCreateCommentPost()).Methods(http.MethodPost)
+	router.HandleFunc("/guide/{guideID}/comment/{commentID}/edit", s.HandleEditCommentGet()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{guideID}/comment/{commentID}", s.HandleEditCommentPatch()).Methods(http.MethodPatch)
+	router.HandleFunc("/guide/{guideID}/comment/{commentID}", s.HandleDeleteComment()).Methods(http.MethodDelete)
+	router.HandleFunc("/guide/{guideID}/comment/{commentID}/hide", s.HandleHideComment()).Methods(http.MethodPost)
+
+	//user
+	router.HandleFunc("/user/signup", s.HandleSignupGet()).Methods(http.MethodGet)
+	router.HandleFunc("/user/signup", s.HandleSignupPost()).Methods(http.MethodPost)
+	router.HandleFunc("/user/login", s.HandleLoginGet()).Methods(http.MethodGet)
+	router.HandleFunc("/user/login", s.HandleLoginPost()).Methods(http.MethodPost)
+	router.HandleFunc("/user/logout", s.HandleLogout()).Methods(http.MethodPost)
+	router.HandleFunc("/user/nav", s.HandleUserNav()).Methods(http.MethodGet)
+
+	//favorites and lists
+	router.HandleFunc("/guide/{id}/favorite", s.HandleFavorite()).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/guide/{guideID}/poi/{poiID}/lists", s.HandlePoiLists()).Methods(http.MethodGet)
+	router.HandleFunc("/guide/{guideID}/poi/{poiID}/lists/{listID}", s.HandlePoiLists()).Methods(http.MethodPost)
+	router.HandleFunc("/lists", s.HandleLists()).Methods(http.MethodGet)
+	router.HandleFunc("/lists", s.HandleCreateListPost()).Methods(http.MethodPost)
+	router.HandleFunc("/list/{listID}", s.HandleDeleteList()).Methods(http.MethodDelete)
+	s.apiRoutes(router)
 	router.HandleFunc("/", HandleIndex())
 	return router
 }
 
-func templateRoutes() *templateRegistry {
+func templateRoutes(tiles tileLayer, geocoding bool) *templateRegistry {
+	funcs := templateFuncs(tiles, geocoding)
 	pageTemplates := map[string]*template.Template{}
 	partialTemplates := map[string]*template.Template{}
 
-	for _, templateName := range []string{indexTemplate, guideTemplate, createGuideFormTemplate, editGuideFormTemplate} {
-		pageTemplates[templateName] = template.Must(template.ParseFS(fs, templatesDir+templateName, templatesDir+baseTemplate, templatesDir+guideRowsTemplate, templatesDir+poiRowsTemplate, templatesDir+mapScriptTemplate))
+	for _, templateName := range []string{indexTemplate, guideTemplate, createGuideFormTemplate, editGuideFormTemplate, itineraryTemplate, createItineraryFormTemplate, createUserFormTemplate, loginFormTemplate, listsTemplate, importFormTemplate, citiesTemplate, cityTemplate, createCityFormTemplate, translationsTemplate} {
+		pageTemplates[templateName] = template.Must(template.New(templateName).Funcs(funcs).ParseFS(fs, templatesDir+templateName, templatesDir+baseTemplate, templatesDir+guideRowsTemplate, templatesDir+poiRowsTemplate, templatesDir+mapScriptTemplate, templatesDir+itineraryPoisTemplate, templatesDir+routeScriptTemplate, templatesDir+markdownPreviewTemplate, templatesDir+cityFieldTemplate, templatesDir+markersScriptTemplate))
 	}
-	for _, templateName := range []string{guideRowsTemplate, poiRowsTemplate, poiViewTemplate, editPoiFormTemplate, createPoiFormTemplate} {
-		partialTemplates[templateName] = template.Must(template.ParseFS(fs, templatesDir+templateName))
+	for _, templateName := range []string{guideRowsTemplate, poiRowsTemplate, poiViewTemplate, editPoiFormTemplate, createPoiFormTemplate, itineraryPoisTemplate, userNavTemplate, favoriteButtonTemplate, poiListsTemplate, commentsTemplate, editCommentFormTemplate, markdownPreviewTemplate, placeOptionsTemplate, cityFieldTemplate} {
+		partialTemplates[templateName] = template.Must(template.New(templateName).Funcs(funcs).ParseFS(fs, templatesDir+templateName))
 	}
 
-	return &templateRegistry{
+	registry := &templateRegistry{
 		pageTemplates:    pageTemplates,
 		partialTemplates: partialTemplates,
+		translated:       map[string]*templateRegistry{},
 	}
-
+	for _, locale := range uiLocales[1:] {
+		registry.translated[locale] = registry.clone(localeFuncs(locale))
+	}
+	return registry
 }
 
 //go:embed templates
 var fs embed.FS
 
+// templateFuncs are the functions of the templates, tiles is the base map of the map scripts and
+// geocoding whether the forms have an address field.
+func templateFuncs(tiles tileLayer, geocoding bool) template.FuncMap {
+	return template.FuncMap{
+		"asset":      assetURL,
+		"tileLayer":  func() tileLayer { return tiles },
+		"geocoding":  func() bool { return geocoding },
+		"alternates": alternates,
+		"t":          catalog(nil).translate,
+		"uiLocale":   func() string { return defaultUILocale },
+	}
+}
+
 type templateRegistry struct {
 	pageTemplates    map[string]*template.Template
 	partialTemplates map[string]*template.Template
+	// translated are the registries of the other uiLocales, by locale.
+	translated map[string]*templateRegistry
+}
+
+// clone is a copy of the templates of t with funcs replaced, like the ones of another locale.
+func (t *templateRegistry) clone(funcs template.FuncMap) *templateRegistry {
+	clone := func(templates map[string]*template.Template) map[string]*template.Template {
+		clones := make(map[string]*template.Template, len(templates))
+		for name, tmpl := range templates {
+			clones[name] = template.Must(tmpl.Clone()).Funcs(funcs)
+		}
+		return clones
+	}
+	return &templateRegistry{
+		pageTemplates:    clone(t.pageTemplates),
+		partialTemplates: clone(t.partialTemplates),
+	}
+}
+
+// in is the registry of the templates translated to locale, t itself for the default locale.
+func (t *templateRegistry) in(locale string) *templateRegistry {
+	if translated, ok := t.translated[locale]; ok {
+		return translated
+	}
+	return t
+}
+
+// templates are the templates in the locale of the interface for r, the response varies by it.
+func (s *Server) templates(w http.ResponseWriter, r *http.Request) *templateRegistry {
+	addVary(w, "Accept-Language")
+	return s.templateRegistry.in(uiLocale(r))
 }
 
 // w can be io.Writer or http.ResponseWriter. Keep it io to make sure we don't do http things here
@@ -697,16 +2442,37 @@ func (t *templateRegistry) renderPartial(w io.Writer, templateFile string, data
 }
 
 const (
-	templatesDir            = "templates/"
-	baseTemplate            = "base.html"
-	indexTemplate           = "index.html"
-	guideRowsTemplate       = "guideRows.html"
-	poiRowsTemplate         = "poiRows.html"
-	guideTemplate           = "guide.html"
-	mapScriptTemplate       = "scripts/mapScript.html"
-	createGuideFormTemplate = "createGuideForm.html"
-	editGuideFormTemplate   = "editGuideForm.html"
-	createPoiFormTemplate   = "createPoiForm.html"
-	editPoiFormTemplate     = "editPoiForm.html"
-	poiViewTemplate         = "poiView.html"
+	templatesDir                = "templates/"
+	baseTemplate                = "base.html"
+	indexTemplate               = "index.html"
+	guideRowsTemplate           = "guideRows.html"
+	poiRowsTemplate             = "poiRows.html"
+	guideTemplate               = "guide.html"
+	translationsTemplate        = "translations.html"
+	mapScriptTemplate           = "scripts/mapScript.html"
+	createGuideFormTemplate     = "createGuideForm.html"
+	editGuideFormTemplate       = "editGuideForm.html"
+	createPoiFormTemplate       = "createPoiForm.html"
+	editPoiFormTemplate         = "editPoiForm.html"
+	poiViewTemplate             = "poiView.html"
+	placeOptionsTemplate        = "placeOptions.html"
+	itineraryTemplate           = "itinerary.html"
+	itineraryPoisTemplate       = "itineraryPois.html"
+	createItineraryFormTemplate = "createItineraryForm.html"
+	routeScriptTemplate         = "scripts/routeScript.html"
+	createUserFormTemplate      = "createUserForm.html"
+	loginFormTemplate           = "loginForm.html"
+	userNavTemplate             = "userNav.html"
+	favoriteButtonTemplate      = "favoriteButton.html"
+	poiListsTemplate            = "poiLists.html"
+	listsTemplate               = "lists.html"
+	commentsTemplate            = "comments.html"
+	editCommentFormTemplate     = "editCommentForm.html"
+	markdownPreviewTemplate     = "markdownPreview.html"
+	importFormTemplate          = "importForm.html"
+	citiesTemplate              = "cities.html"
+	cityTemplate                = "city.html"
+	createCityFormTemplate      = "createCityForm.html"
+	cityFieldTemplate           = "cityField.html"
+	markersScriptTemplate       = "scripts/markersScript.html"
 )
@@ -110,6 +110,14 @@ func TestRoutes(t *testing.T) {
 		{"/guides", http.MethodGet, http.StatusOK},
 		{"/unknownroute", http.MethodGet, http.StatusNotFound},
 		{"/guide/1", http.MethodGet, http.StatusOK},
+		{"/g/test-1", http.MethodGet, http.StatusOK},
+		{"/g/test-1/guide-1", http.MethodGet, http.StatusOK},
+		{"/g/unknown", http.MethodGet, http.StatusNotFound},
+		{"/g/test-1/unknown", http.MethodGet, http.StatusNotFound},
+		{"/guide/1/translations", http.MethodGet, http.StatusOK},
+		{"/guide/1/translations?locale=es", http.MethodGet, http.StatusOK},
+		{"/guide/1/translations?locale=spanish", http.MethodGet, http.StatusBadRequest},
+		{"/guide/42/translations", http.MethodGet, http.StatusNotFound},
 		{"/guide/42", http.MethodGet, http.StatusNotFound},
 		{"/guide/", http.MethodGet, http.StatusNotFound},
 		{"/guide/", http.MethodGet, http.StatusNotFound},
@@ -132,6 +140,39 @@ func TestRoutes(t *testing.T) {
 		{"/guide/1/poi/1/edit", http.MethodGet, http.StatusOK},
 		{"/guide/42/poi/1/edit", http.MethodGet, http.StatusNotFound},
 		{"/guide/1/poi/42/edit", http.MethodPatch, http.StatusMethodNotAllowed},
+		{"/guide/1/itinerary/create", http.MethodGet, http.StatusOK},
+		{"/guide/42/itinerary/create", http.MethodGet, http.StatusNotFound},
+		{"/guide/1/itinerary/1", http.MethodGet, http.StatusOK},
+		{"/guide/1/itinerary/42", http.MethodGet, http.StatusNotFound},
+		{"/guide/42/itinerary/1", http.MethodGet, http.StatusNotFound},
+		{"/guide/1/itinerary/one", http.MethodGet, http.StatusBadRequest},
+		{"/user/signup", http.MethodGet, http.StatusOK},
+		{"/user/login", http.MethodGet, http.StatusOK},
+		{"/user/nav", http.MethodGet, http.StatusOK},
+		{"/lists", http.MethodGet, http.StatusOK}, //redirects to login
+		{"/guide/1/favorite", http.MethodGet, http.StatusOK},
+		{"/guide/1/favorite", http.MethodPost, http.StatusUnauthorized},
+		{"/guide/1/poi/1/lists/1", http.MethodPost, http.StatusUnauthorized},
+		{"/guide/1/fork", http.MethodPost, http.StatusUnauthorized},
+		{"/guide/1.geojson", http.MethodGet, http.StatusOK},
+		{"/guide/42.geojson", http.MethodGet, http.StatusNotFound},
+		{"/guide/1.gpx", http.MethodGet, http.StatusOK},
+		{"/guide/42.gpx", http.MethodGet, http.StatusNotFound},
+		{"/guide/1.kml", http.MethodGet, http.StatusOK},
+		{"/guide/42.kml", http.MethodGet, http.StatusNotFound},
+		{"/guide/1.csv", http.MethodGet, http.StatusOK},
+		{"/guide/42.csv", http.MethodGet, http.StatusNotFound},
+		{"/guide/1/import", http.MethodGet, http.StatusOK},
+		{"/guide/42/import", http.MethodGet, http.StatusNotFound},
+		{"/admin/backup", http.MethodGet, http.StatusUnauthorized},
+		{"/guide/1/tiles/0/0/0.pbf", http.MethodGet, http.StatusOK},
+		{"/guide/42/tiles/0/0/0.pbf", http.MethodGet, http.StatusNotFound},
+		{"/tiles/0/0/0.png", http.MethodGet, http.StatusNotFound},
+		{"/geocode?address=oaxaca", http.MethodGet, http.StatusNotFound},
+		{"/cities", http.MethodGet, http.StatusOK},
+		{"/city/atlantis", http.MethodGet, http.StatusNotFound},
+		{"/city/create", http.MethodGet, http.StatusUnauthorized},
+		{"/city/suggest?latitude=10&longitude=10", http.MethodGet, http.StatusOK},
 	}
 	server := newProvisionedServer(t)
 	ts := httptest.NewServer(server.Routes())
@@ -386,6 +427,176 @@ func TestDeleteGuideHandlerDeletesGuide(t *testing.T) {
 	}
 }
 
+func TestDeleteGuideHandlerRefusesGuideWithPois(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "3"}) //has pois
+	server.HandleDeleteGuide()(rec, req)
+
+	res := rec.Result()
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("want status %d, got %d", http.StatusConflict, res.StatusCode)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "delete them") {
+		t.Errorf("want a message telling to delete the points of interest, got %q", body)
+	}
+}
+
+func TestForkGuideHandlerForksIntoUserAccount(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	cookie := newSessionCookie(t, server, "traveller")
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(cookie)
+	req = mux.SetURLVars(req, map[string]string{"id": "2"})
+	rec := httptest.NewRecorder()
+	server.HandleForkGuide()(rec, req)
+
+	res := rec.Result()
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected status 303 SeeOther, got %d", res.StatusCode)
+	}
+	location := res.Header.Get("Location")
+	if location != "/guide/4" {
+		t.Errorf("want redirect to forked guide /guide/4, got %s", location)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "4"})
+	rec = httptest.NewRecorder()
+	server.HandleGuide()(rec, req)
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Forked from <a href="/g/guide-1">guide 1</a>`
+	got := string(body)
+	if !strings.Contains(got, want) {
+		t.Errorf("want forked guide to contain %s\nGot:\n%s", want, got)
+	}
+}
+
+func TestCommentHandlersThreadedDiscussion(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	owner := newSessionCookie(t, server, "owner")
+	traveller := newSessionCookie(t, server, "traveller")
+
+	req := httptest.NewRequest(http.MethodPost, "/guide/create", strings.NewReader("name=Lisbon&latitude=38.7&longitude=-9.1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(owner)
+	rec := httptest.NewRecorder()
+	server.HandleCreateGuidePost()(rec, req)
+	if rec.Result().Header.Get("Location") != "/guide/4" {
+		t.Fatalf("want guide 4 to be created, got %s", rec.Result().Header.Get("Location"))
+	}
+
+	post := func(cookie *http.Cookie, form string) string {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		req = mux.SetURLVars(req, map[string]string{"id": "4"})
+		rec := httptest.NewRecorder()
+		server.HandleCreateCommentPost()(rec, req)
+		if rec.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200 OK, got %d", rec.Result().StatusCode)
+		}
+		body, err := io.ReadAll(rec.Result().Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+	post(traveller, "body=Where to eat **pastéis**?")
+	got := post(owner, "body=<b>Belém</b>&parent=1")
+
+	for _, want := range []string{"Where to eat <strong>pastéis</strong>?", "&lt;b&gt;Belém&lt;/b&gt;", `<li id="comment-2">`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want comments to contain %s\nGot:\n%s", want, got)
+		}
+	}
+	reply := strings.Index(got, `<li id="comment-2">`)
+	if strings.Count(got[:reply], "<ul>") != 2 {
+		t.Error("want reply to be nested under its parent comment")
+	}
+
+	testCases := []struct {
+		name       string
+		handler    http.HandlerFunc
+		cookie     *http.Cookie
+		commentID  string
+		form       string
+		statusCode int
+	}{
+		{"owner cannot edit another user's comment", server.HandleEditCommentPatch(), owner, "1", "body=edited", http.StatusForbidden},
+		{"author edits comment", server.HandleEditCommentPatch(), traveller, "1", "body=edited", http.StatusOK},
+		{"author cannot hide comments", server.HandleHideComment(), traveller, "1", "", http.StatusForbidden},
+		{"owner hides comment", server.HandleHideComment(), owner, "1", "", http.StatusOK},
+		{"traveller cannot delete owner's comment", server.HandleDeleteComment(), traveller, "2", "", http.StatusForbidden},
+		{"owner deletes comment", server.HandleDeleteComment(), owner, "1", "", http.StatusOK},
+		{"deleted comment is gone", server.HandleEditCommentPatch(), traveller, "1", "body=edited", http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(tc.cookie)
+		req = mux.SetURLVars(req, map[string]string{"guideID": "4", "commentID": tc.commentID})
+		rec := httptest.NewRecorder()
+		tc.handler(rec, req)
+		if rec.Result().StatusCode != tc.statusCode {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.statusCode, rec.Result().StatusCode)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "4"})
+	rec = httptest.NewRecorder()
+	server.HandleComments()(rec, req)
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = string(body)
+	for _, want := range []string{"[deleted]", "Belém"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want comments to contain %s\nGot:\n%s", want, got)
+		}
+	}
+}
+
+func TestMarkdownPreviewHandlerRendersDescription(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/markdown/preview", strings.NewReader("description=**open** late<img src=x>"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	server.HandleMarkdownPreview()(rec, req)
+
+	res := rec.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 OK, got %d", res.StatusCode)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(body)
+	if !strings.Contains(got, "<strong>open</strong> late") {
+		t.Errorf("want preview to contain rendered markdown\nGot:\n%s", got)
+	}
+	if strings.Contains(got, "<img src=x>") {
+		t.Errorf("want preview to omit raw html\nGot:\n%s", got)
+	}
+}
+
 func TestPoiHandlerRendersView(t *testing.T) {
 	t.Parallel()
 	server := newProvisionedServer(t)
@@ -747,6 +958,341 @@ func TestEditPoiHandlerPatchEditsPoi(t *testing.T) {
 
 }
 
+func TestCreateItineraryHandlerPostCreatesItinerary(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	server := newProvisionedServerWithStore(storage, t)
+
+	form := strings.NewReader("name=day 1&poi=3&poi=1")
+	req := httptest.NewRequest(http.MethodPost, "/", form)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rec := httptest.NewRecorder()
+	handler := server.HandleCreateItineraryPost()
+	handler(rec, req)
+
+	res := rec.Result()
+	if res.StatusCode != http.StatusSeeOther {
+		t.Errorf("expected status 303 SeeOther, got %d", res.StatusCode)
+	}
+
+	location := res.Header.Get("Location")
+	itineraryID, err := strconv.ParseInt(location[strings.LastIndex(location, "/")+1:], 10, 64)
+	if err != nil {
+		t.Fatalf("want redirect to new itinerary, got %q", location)
+	}
+	i, err := storage.GetItinerary(1, itineraryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i == nil {
+		t.Fatal("want itinerary to be created")
+	}
+	if len(i.Pois) != 2 || i.Pois[0].Id != 3 || i.Pois[1].Id != 1 {
+		t.Errorf("want itinerary stops to be [3 1], got %v", i.PoiIDs())
+	}
+}
+
+func TestCreateItineraryHandlerPostFormErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		form string
+		want string
+	}{
+		{"name=&poi=1", "name cannot be empty"},
+		{"name=test&poi=one", "not able to parse poi ID"},
+		{"name=test&poi=4", "poi 4 not found"},
+		{"name=test&poi=1&poi=1", "poi 1 is repeated"},
+	}
+
+	server := newProvisionedServer(t)
+	handler := server.HandleCreateItineraryPost()
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		handler(rec, req)
+
+		res := rec.Result()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 Bad Request, got %d", res.StatusCode)
+		}
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(body)
+		if !strings.Contains(got, tc.want) {
+			t.Errorf("want form to contain %s\nGot:\n%s", tc.want, got)
+		}
+	}
+}
+
+func TestItineraryOrderHandlerPostReordersStops(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	server := newProvisionedServerWithStore(storage, t)
+
+	form := strings.NewReader("poi=2&poi=3&poi=1")
+	req := httptest.NewRequest(http.MethodPost, "/", form)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, map[string]string{"guideID": "1", "itineraryID": "1"})
+	rec := httptest.NewRecorder()
+	handler := server.HandleItineraryOrderPost()
+	handler(rec, req)
+
+	res := rec.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 OK, got %d", res.StatusCode)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Total distance"
+	if !strings.Contains(string(body), want) {
+		t.Errorf("want body to contain %s\nGot:\n%s", want, string(body))
+	}
+
+	i, err := storage.GetItinerary(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(i.PoiIDs())
+	if got != "[2 3 1]" {
+		t.Errorf("want itinerary stops to be [2 3 1], got %s", got)
+	}
+}
+
+func TestItineraryOrderHandlerPostErrorsOnMissingStops(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+
+	form := strings.NewReader("poi=2")
+	req := httptest.NewRequest(http.MethodPost, "/", form)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, map[string]string{"guideID": "1", "itineraryID": "1"})
+	rec := httptest.NewRecorder()
+	handler := server.HandleItineraryOrderPost()
+	handler(rec, req)
+
+	res := rec.Result()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 Bad Request, got %d", res.StatusCode)
+	}
+}
+
+func TestSuggestItineraryOrderHandlerFindsShorterRoute(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	g, err := guide.NewGuide("walk", guide.WithValidStringCoordinates("0", "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.CreateGuide(&g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// points on a line visited back and forth
+	for _, longitude := range []string{"0", "0.03", "0.01", "0.04", "0.02"} {
+		p, err := guide.NewPointOfInterest("poi "+longitude, g.Id, guide.PoiWithValidStringCoordinates("0", longitude))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.CreatePoi(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	i, err := guide.NewItinerary("day 1", g.Id, guide.ItineraryWithPois(storage.GetAllPois(g.Id)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.CreateItinerary(&i)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := guide.NewServer("localhost:8080", storage, os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"guideID":     strconv.FormatInt(g.Id, 10),
+		"itineraryID": strconv.FormatInt(i.Id, 10),
+	})
+	rec := httptest.NewRecorder()
+	handler := server.HandleSuggestItineraryOrder()
+	handler(rec, req)
+
+	res := rec.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 OK, got %d", res.StatusCode)
+	}
+	got, err := storage.GetItinerary(g.Id, i.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Distance() >= i.Distance() {
+		t.Errorf("want suggested route to be shorter than %.2f km, got %.2f km", i.Distance(), got.Distance())
+	}
+	want := "[1 3 5 2 4]"
+	if fmt.Sprint(got.PoiIDs()) != want {
+		t.Errorf("want suggested order %s, got %v", want, got.PoiIDs())
+	}
+}
+
+func TestSignupHandlerPostLogsUserIn(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	cookie := newSessionCookie(t, server, "traveller")
+
+	req := httptest.NewRequest(http.MethodGet, "/user/nav", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler := server.HandleUserNav()
+	handler(rec, req)
+
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Log out"
+	got := string(body)
+	if !strings.Contains(got, want) {
+		t.Errorf("want nav to contain %s\nGot:\n%s", want, got)
+	}
+}
+
+func TestSignupHandlerPostFormErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		form string
+		want string
+	}{
+		{"username=&password=password1&confirm-password=password1&email=a@b.com", "username cannot be empty"},
+		{"username=test&password=short&confirm-password=short&email=a@b.com", "at least 8 characters"},
+		{"username=test&password=password1&confirm-password=password2&email=a@b.com", "passwords do not match"},
+		{"username=test&password=password1&confirm-password=password1&email=ab.com", "valid address"},
+	}
+	server := newProvisionedServer(t)
+	handler := server.HandleSignupPost()
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/user/signup", strings.NewReader(tc.form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		handler(rec, req)
+
+		res := rec.Result()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 Bad Request, got %d", res.StatusCode)
+		}
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(body)
+		if !strings.Contains(got, tc.want) {
+			t.Errorf("want form to contain %s\nGot:\n%s", tc.want, got)
+		}
+	}
+}
+
+func TestLoginHandlerPost(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	newSessionCookie(t, server, "traveller")
+	testCases := []struct {
+		form       string
+		statusCode int
+	}{
+		{"username=traveller&password=password1", http.StatusSeeOther},
+		{"username=traveller&password=password2", http.StatusUnauthorized},
+		{"username=nobody&password=password1", http.StatusUnauthorized},
+	}
+	handler := server.HandleLoginPost()
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(tc.form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		handler(rec, req)
+
+		res := rec.Result()
+		if res.StatusCode != tc.statusCode {
+			t.Errorf("for %s expected status %d, got %d", tc.form, tc.statusCode, res.StatusCode)
+		}
+	}
+}
+
+func TestFavoriteHandlerPostTogglesFavorite(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	cookie := newSessionCookie(t, server, "traveller")
+	handler := server.HandleFavorite()
+
+	for _, want := range []string{"&#9733; 1", "&#9734; 0"} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.AddCookie(cookie)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		res := rec.Result()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200 OK, got %d", res.StatusCode)
+		}
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(body)
+		if !strings.Contains(got, want) {
+			t.Errorf("want favorite button to contain %s\nGot:\n%s", want, got)
+		}
+	}
+}
+
+func TestPoiListsHandlerPostSavesPoiIntoList(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	cookie := newSessionCookie(t, server, "traveller")
+
+	req := httptest.NewRequest(http.MethodPost, "/lists", strings.NewReader("name=Lisbon to-do"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	server.HandleCreateListPost()(rec, req)
+	if rec.Result().StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected status 303 SeeOther on list creation, got %d", rec.Result().StatusCode)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(cookie)
+	req = mux.SetURLVars(req, map[string]string{"guideID": "2", "poiID": "5", "listID": "1"})
+	rec = httptest.NewRecorder()
+	server.HandlePoiLists()(rec, req)
+	if rec.Result().StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 OK, got %d", rec.Result().StatusCode)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/lists", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	server.HandleLists()(rec, req)
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(body)
+	for _, want := range []string{"Lisbon to-do", `href="/g/guide-1/guide-1">guide 1</a>`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want lists page to contain %s\nGot:\n%s", want, got)
+		}
+	}
+}
+
 // test helpers
 func openTmpStorage(t *testing.T) guide.Storage {
 	tempDB := t.TempDir() + t.Name() + ".store"
@@ -782,6 +1328,14 @@ func newProvisionedServer(t *testing.T) *guide.Server {
 				t.Fatal(err)
 			}
 		}
+		i, err := guide.NewItinerary("itinerary 1", g.Id, guide.ItineraryWithPois(storage.GetAllPois(g.Id)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.CreateItinerary(&i)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 
 	freePort, err := freeport.GetFreePort()
@@ -817,6 +1371,14 @@ func newProvisionedServerWithStore(storage guide.Storage, t *testing.T) *guide.S
 				t.Fatal(err)
 			}
 		}
+		i, err := guide.NewItinerary("itinerary 1", g.Id, guide.ItineraryWithPois(storage.GetAllPois(g.Id)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.CreateItinerary(&i)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 
 	freePort, err := freeport.GetFreePort()
@@ -830,3 +1392,25 @@ func newProvisionedServerWithStore(storage guide.Storage, t *testing.T) *guide.S
 	}
 	return &server
 }
+
+// newSessionCookie signs up username with password password1 and returns its session cookie.
+func newSessionCookie(t *testing.T, server *guide.Server, username string) *http.Cookie {
+	form := strings.NewReader("username=" + username + "&password=password1&confirm-password=password1&email=" + username + "@example.com")
+	req := httptest.NewRequest(http.MethodPost, "/user/signup", form)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler := server.HandleSignupPost()
+	handler(rec, req)
+
+	res := rec.Result()
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected status 303 SeeOther on signup, got %d", res.StatusCode)
+	}
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "session" {
+			return cookie
+		}
+	}
+	t.Fatal("want signup to set a session cookie")
+	return nil
+}
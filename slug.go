@@ -0,0 +1,140 @@
+package guide
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxSlugLength keeps the URLs of guides with long names readable.
+const maxSlugLength = 80
+
+// slugify lowercases s, spells it in ASCII and joins its words with dashes, for URLs. It is empty
+// when s has nothing it can spell, like names in scripts without a transliteration.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	write := func(part string) {
+		if dash && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		b.WriteString(part)
+		dash = false
+	}
+	for _, r := range strings.ToLower(s) {
+		switch t, ok := transliterations[r]; {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			write(string(r))
+		case ok:
+			// signs like the Cyrillic soft sign are spelled as nothing, without splitting the word
+			if t != "" {
+				write(t)
+			}
+		default:
+			dash = true
+		}
+		if b.Len() >= maxSlugLength {
+			break
+		}
+	}
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+	}
+	return strings.TrimRight(slug, "-")
+}
+
+// slugOr is the slug of name, or fallback when name has none.
+func slugOr(name, fallback string) string {
+	if slug := slugify(name); slug != "" {
+		return slug
+	}
+	return fallback
+}
+
+// transliterations spell the lowercase letters of the Latin, Greek and Cyrillic alphabets that
+// aren't ASCII.
+var transliterations = func() map[rune]string {
+	spellings := map[string]string{
+		"a":    "àáâãäåāăąαά" + "а",
+		"ae":   "æ",
+		"b":    "б",
+		"c":    "çćĉċč",
+		"ch":   "χ" + "ч",
+		"d":    "ďđðδ" + "д",
+		"e":    "èéêëēĕėęěεέ" + "еэ",
+		"f":    "φ" + "ф",
+		"g":    "ĝğġģγ" + "гґ",
+		"h":    "ĥħ",
+		"i":    "ìíîïĩīĭįıιίϊΐηή" + "иі",
+		"ij":   "ĳ",
+		"j":    "ĵ",
+		"k":    "ķκ" + "к",
+		"kh":   "х",
+		"l":    "ĺļľŀłλ" + "л",
+		"m":    "μ" + "м",
+		"n":    "ñńņňŉν" + "н",
+		"o":    "òóôõöøōŏőοόωώ" + "о",
+		"oe":   "œ",
+		"p":    "π" + "п",
+		"ps":   "ψ",
+		"r":    "ŕŗřρ" + "р",
+		"s":    "śŝşšșσς" + "с",
+		"sh":   "ш",
+		"shch": "щ",
+		"ss":   "ß",
+		"t":    "ţťŧțτ" + "т",
+		"th":   "þθ",
+		"ts":   "ц",
+		"u":    "ùúûüũūŭůűų" + "у",
+		"v":    "β" + "в",
+		"w":    "ŵ",
+		"x":    "ξ",
+		"y":    "ýÿŷυύϋΰ" + "йы",
+		"ya":   "я",
+		"ye":   "є",
+		"yi":   "ї",
+		"yo":   "ё",
+		"yu":   "ю",
+		"z":    "źżžζ" + "з",
+		"zh":   "ж",
+		"":     "ъь",
+	}
+	m := map[rune]string{}
+	for spelling, letters := range spellings {
+		for _, r := range letters {
+			m[r] = spelling
+		}
+	}
+	return m
+}()
+
+// uniqueSlug is base, or base numbered from 2 when taken.
+func uniqueSlug(base string, taken func(slug string) (bool, error)) (string, error) {
+	slug := base
+	for n := 2; ; n++ {
+		t, err := taken(slug)
+		if err != nil {
+			return "", err
+		}
+		if !t {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// fitsSlug reports whether slug is base, or base numbered by uniqueSlug, so renames that don't
+// change the slug of a name keep their URLs.
+func fitsSlug(slug, base string) bool {
+	if slug == base {
+		return true
+	}
+	n, ok := strings.CutPrefix(slug, base+"-")
+	if !ok {
+		return false
+	}
+	i, err := strconv.Atoi(n)
+	return err == nil && i >= 2 && strconv.Itoa(i) == n
+}
@@ -0,0 +1,142 @@
+package guide_test
+
+import (
+	"github.com/gorilla/mux"
+	"guide"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestStoreGivesGuidesAndPoisUniqueSlugs(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	testCases := []struct{ name, want string }{
+		{"Café Zürich", "cafe-zurich"},
+		{"café  zürich!", "cafe-zurich-2"},
+		{"Москва за день", "moskva-za-den"},
+		{"Αθήνα", "athina"},
+		{"Straße & Ærø", "strasse-aero"},
+		{"東京", "guide"},
+		{"京都", "guide-2"},
+		{strings.Repeat("long name ", 20), "long-name-long-name-long-name-long-name-long-name-long-name-long-name-long-name"},
+	}
+	for _, tc := range testCases {
+		g, err := guide.NewGuide(tc.name, guide.WithValidStringCoordinates("10", "10"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.CreateGuide(&g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.Slug != tc.want {
+			t.Errorf("%q: want slug %q, got %q", tc.name, tc.want, g.Slug)
+		}
+	}
+
+	for _, want := range []string{"nandu", "nandu-2"} {
+		p, err := guide.NewPointOfInterest("Ñandú", 1, guide.PoiWithValidStringCoordinates("10", "10"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.CreatePoi(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Slug != want {
+			t.Errorf("want poi slug %q, got %q", want, p.Slug)
+		}
+	}
+	// poi slugs are unique within their guide only
+	p, err := guide.NewPointOfInterest("Ñandú", 2, guide.PoiWithValidStringCoordinates("10", "10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.CreatePoi(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Slug != "nandu" {
+		t.Errorf("want poi slug nandu in another guide, got %q", p.Slug)
+	}
+}
+
+func TestGuidePermalinkRedirectsOldSlugsOfRenamedGuides(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+
+	rename := func(name string) {
+		t.Helper()
+		form := url.Values{"name": {name}, "latitude": {"10"}, "longitude": {"10"}}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rec := httptest.NewRecorder()
+		server.HandleEditGuidePost()(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("want guide renamed, got status %d", rec.Code)
+		}
+	}
+	permalink := func(vars map[string]string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = mux.SetURLVars(req, vars)
+		rec := httptest.NewRecorder()
+		server.HandleGuidePermalink()(rec, req)
+		return rec.Result()
+	}
+
+	// renaming without changing the slug keeps it
+	rename("Test 1!")
+	res := permalink(map[string]string{"slug": "test-1"})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("want slug kept after renaming to the same slug, got status %d", res.StatusCode)
+	}
+
+	rename("Lisboa à noite")
+	testCases := map[string]struct {
+		vars     map[string]string
+		location string
+	}{
+		"guide": {map[string]string{"slug": "test-1"}, "/g/lisboa-a-noite"},
+		"poi":   {map[string]string{"slug": "test-1", "poiSlug": "guide-1"}, "/g/lisboa-a-noite/guide-1"},
+	}
+	for name, tc := range testCases {
+		res := permalink(tc.vars)
+		if res.StatusCode != http.StatusMovedPermanently {
+			t.Errorf("%s: want status 301 for the old slug, got %d", name, res.StatusCode)
+		}
+		if location := res.Header.Get("Location"); location != tc.location {
+			t.Errorf("%s: want redirect to %s, got %s", name, tc.location, location)
+		}
+	}
+
+	res = permalink(map[string]string{"slug": "lisboa-a-noite", "poiSlug": "guide-1"})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("want status 200 for the new slug, got %d", res.StatusCode)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Lisboa à noite", `hx-get="/guide/1/poi/2" hx-trigger="load"`, `href="/g/lisboa-a-noite/test-2"`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("want poi permalink page to contain %s", want)
+		}
+	}
+
+	// renaming back takes the old slug back
+	rename("test 1")
+	res = permalink(map[string]string{"slug": "test-1"})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want status 200 for the slug taken back, got %d", res.StatusCode)
+	}
+	res = permalink(map[string]string{"slug": "lisboa-a-noite"})
+	if location := res.Header.Get("Location"); res.StatusCode != http.StatusMovedPermanently || location != "/g/test-1" {
+		t.Errorf("want the second slug redirected to /g/test-1, got status %d to %s", res.StatusCode, location)
+	}
+}
@@ -0,0 +1,299 @@
+package guide
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A static site is the guides rendered with the same templates as the server, without what needs
+// the server: htmx requests, forms, and links to pages that aren't exported. The pages link to each
+// other with relative paths so the site works from any directory, served by Caddy or opened as
+// files:
+//
+//	index.html                      all guides
+//	guide/{id}.html                 a guide, with its pois rendered inline
+//	guide/{id}.geojson              a guide and its pois as GeoJSON
+//	guide/{id}/itinerary/{id}.html  an itinerary
+//	static/                         the vendored frontend assets
+const staticGuideDir = "guide"
+
+type staticSite struct {
+	store            Storage
+	templateRegistry *templateRegistry
+	// permalinks are the files of the guide permalinks, /g/{slug}.
+	permalinks map[string]string
+}
+
+// staticRoutes are the server paths that have a static page, rewritten to their file.
+var staticRoutes = []struct {
+	route *regexp.Regexp
+	file  string
+}{
+	{regexp.MustCompile(`^/(guides)?$`), "index.html"},
+	{regexp.MustCompile(`^/guide/([0-9]+)$`), "guide/$1.html"},
+	{regexp.MustCompile(`^/guide/([0-9]+)\.geojson$`), "guide/$1.geojson"},
+	{regexp.MustCompile(`^/guide/([0-9]+)/itinerary/([0-9]+)$`), "guide/$1/itinerary/$2.html"},
+}
+
+var rxPoiRoute = regexp.MustCompile(`^/guide/[0-9]+/poi/([0-9]+)$`)
+
+// ExportStaticSite renders every guide of store into dir as a static site and returns the number of
+// guides. Other files in dir are left alone, except a previous export which is replaced.
+func ExportStaticSite(store Storage, dir string) (int, error) {
+	s := staticSite{store: store, templateRegistry: templateRoutes(osmTileLayer, false), permalinks: map[string]string{}}
+	guides := s.store.GetAllGuides()
+	for _, g := range guides {
+		s.permalinks[guidePermalink(g.Slug, "")] = fmt.Sprintf("%s/%d.html", staticGuideDir, g.Id)
+	}
+	for _, exported := range []string{staticGuideDir, staticDir} {
+		err := os.RemoveAll(filepath.Join(dir, exported))
+		if err != nil {
+			return 0, err
+		}
+	}
+	err := os.MkdirAll(filepath.Join(dir, staticGuideDir), 0o755)
+	if err != nil {
+		return 0, err
+	}
+	err = copyVendoredAssets(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.writeStaticPage(dir, "index.html", indexTemplate, guides, nil)
+	if err != nil {
+		return 0, err
+	}
+	for _, g := range guides {
+		g.Pois = s.store.GetAllPois(g.Id)
+		g.Itineraries = s.store.GetAllItineraries(g.Id)
+		// the fork upstream name isn't listed with all guides
+		detail, err := s.store.GetGuidebyID(g.Id)
+		if err != nil {
+			return 0, err
+		}
+		if detail != nil {
+			g.ForkedFromID, g.ForkedFromName, g.ForkedFromSlug = detail.ForkedFromID, detail.ForkedFromName, detail.ForkedFromSlug
+		}
+
+		poiViews, err := s.renderStaticPoiViews(g.Pois)
+		if err != nil {
+			return 0, err
+		}
+		page := fmt.Sprintf("%s/%d.html", staticGuideDir, g.Id)
+		err = s.writeStaticPage(dir, page, guideTemplate, guidePage{guide: g}, poiViews)
+		if err != nil {
+			return 0, err
+		}
+		err = writeStaticFile(dir, fmt.Sprintf("%s/%d.geojson", staticGuideDir, g.Id), func(w io.Writer) error {
+			return WriteGuideGeoJSON(w, g)
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for _, it := range g.Itineraries {
+			i, err := s.store.GetItinerary(g.Id, it.Id)
+			if err != nil {
+				return 0, err
+			}
+			if i == nil {
+				continue
+			}
+			page := fmt.Sprintf("%s/%d/itinerary/%d.html", staticGuideDir, g.Id, i.Id)
+			err = s.writeStaticPage(dir, page, itineraryTemplate, i, nil)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(guides), nil
+}
+
+// renderStaticPoiViews renders the view of each poi, which the server loads with htmx when a poi
+// is clicked, as an article to link to.
+func (s staticSite) renderStaticPoiViews(pois []pointOfInterest) ([]*html.Node, error) {
+	var b bytes.Buffer
+	for _, poi := range pois {
+		fmt.Fprintf(&b, `<article id="poi-%d" class="box">`, poi.Id)
+		err := s.templateRegistry.renderPartial(&b, poiViewTemplate, poiView{pointOfInterest: poi})
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(`</article>`)
+	}
+	return html.ParseFragment(&b, &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+}
+
+// writeStaticPage renders the page template with data to the page path under dir, made static by
+// staticPage.
+func (s staticSite) writeStaticPage(dir, page, templateFile string, data any, poiViews []*html.Node) error {
+	var b bytes.Buffer
+	err := s.templateRegistry.renderPage(&b, templateFile, data)
+	if err != nil {
+		return err
+	}
+	doc, err := html.Parse(&b)
+	if err != nil {
+		return err
+	}
+	staticPage(doc, strings.Repeat("../", strings.Count(page, "/")), poiViews, s.permalinks)
+	return writeStaticFile(dir, page, func(w io.Writer) error {
+		return html.Render(w, doc)
+	})
+}
+
+func writeStaticFile(dir, name string, write func(io.Writer) error) error {
+	filename := filepath.Join(dir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(filename), 0o755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// staticPage removes the server-only parts of a rendered page and rewrites its links to the static
+// files, relative to root, the path from the page to the site root. The poi views are placed in the
+// poi-focus column, which the server fills with htmx.
+func staticPage(n *html.Node, root string, poiViews []*html.Node, permalinks map[string]string) {
+	removed := map[string]bool{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode && isServerOnly(c, root, permalinks) {
+				if id := attr(c, "id"); id != "" {
+					removed[id] = true
+				}
+				n.RemoveChild(c)
+			} else {
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(n)
+
+	var finish func(*html.Node)
+	finish = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.DataAtom == atom.Label && removed[attr(c, "for")] {
+				n.RemoveChild(c)
+			} else {
+				finish(c)
+			}
+			c = next
+		}
+		if n.Type != html.ElementNode {
+			return
+		}
+		if attr(n, "id") == "poi-focus" {
+			for _, view := range poiViews {
+				n.AppendChild(view)
+			}
+		}
+		attrs := n.Attr[:0]
+		for _, a := range n.Attr {
+			if strings.HasPrefix(a.Key, "hx-") {
+				continue
+			}
+			if (a.Key == "src" || a.Key == "href") && strings.HasPrefix(a.Val, "/static/") {
+				a.Val = root + strings.TrimPrefix(a.Val, "/")
+			}
+			attrs = append(attrs, a)
+		}
+		n.Attr = attrs
+	}
+	finish(n)
+}
+
+// isServerOnly reports whether n needs the server, rewriting the links that have a static file.
+func isServerOnly(n *html.Node, root string, permalinks map[string]string) bool {
+	switch {
+	case hasAttr(n, "hx-delete") || hasAttr(n, "hx-post") || hasAttr(n, "hx-put") || hasAttr(n, "hx-patch"):
+		return n.DataAtom == atom.A || n.DataAtom == atom.Button
+	case strings.Contains(attr(n, "hx-trigger"), "load"):
+		// content loaded from the server after the page, like comments and favorites
+		return true
+	case n.DataAtom == atom.Form:
+		return hasAttr(n, "method")
+	case n.DataAtom == atom.A && hasAttr(n, "hx-get"):
+		if m := rxPoiRoute.FindStringSubmatch(attr(n, "hx-get")); m != nil {
+			setAttr(n, "href", "#poi-"+m[1])
+			return false
+		}
+		return true
+	case hasAttr(n, "hx-get"):
+		return true
+	case n.DataAtom == atom.A:
+		href := attr(n, "href")
+		if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") || strings.HasPrefix(href, "#") {
+			return false
+		}
+		file, ok := staticFile(href, permalinks)
+		if !ok {
+			return true
+		}
+		setAttr(n, "href", root+file)
+		return false
+	}
+	return false
+}
+
+// staticFile is the file of the static page of a server path.
+func staticFile(path string, permalinks map[string]string) (string, bool) {
+	if file, ok := permalinks[path]; ok {
+		return file, true
+	}
+	for _, r := range staticRoutes {
+		if r.route.MatchString(path) {
+			return r.route.ReplaceAllString(path, r.file), true
+		}
+	}
+	return "", false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func setAttr(n *html.Node, key, value string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
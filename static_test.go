@@ -0,0 +1,121 @@
+package guide_test
+
+import (
+	"guide"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestExportStaticSite(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	newProvisionedServerWithStore(storage, t)
+	_, err := storage.ForkGuide(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, content := range map[string]string{"guide/99.html": "deleted guide", "robots.txt": "User-agent: *"} {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := guide.ExportStaticSite(storage, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("want 4 guides exported, got %d", count)
+	}
+	testCases := map[string]struct{ want, notWant []string }{
+		"index.html": {
+			want:    []string{`href="guide/1.html"`, `href="guide/4.html"`, "test 1"},
+			notWant: []string{"hx-", "/guide/1/edit", "Delete", `id="search"`, "Search Guides"},
+		},
+		"guide/1.html": {
+			want:    []string{`href="#poi-1"`, `id="poi-1"`, `href="../index.html"`, `href="../guide/1.geojson"`, `href="../guide/1/itinerary/1.html"`, "Export GeoJSON"},
+			notWant: []string{"hx-", "Edit", "Delete", "Fork into my account", "Add Poi", "Export GPX", "/guide/1/import", `id="comments"`},
+		},
+		"guide/4.html": {
+			want: []string{`Forked from <a href="../guide/1.html">test 1</a>`},
+		},
+		"guide/1/itinerary/1.html": {
+			want:    []string{`href="../../../guide/1.html"`, "drawRoute("},
+			notWant: []string{"hx-", "Delete Itinerary", "Suggest Visiting Order"},
+		},
+	}
+	for page, tc := range testCases {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(page)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s: want page to contain %q", page, want)
+			}
+		}
+		for _, notWant := range tc.notWant {
+			if strings.Contains(string(content), notWant) {
+				t.Errorf("%s: want page not to contain %q", page, notWant)
+			}
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, "guide", "1.geojson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := guide.ReadGuideGeoJSON(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Name != "test 1" || len(g.Pois) != 3 {
+		t.Errorf("want guide 1 with 3 pois as GeoJSON, got %s with %d pois", g.Name, len(g.Pois))
+	}
+
+	// the scripts and styles vendored are loaded from the export
+	rxAssetRef := regexp.MustCompile(`<(?:script[^>]* src|link[^>]* href)="([^"]+)"`)
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".html" {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, match := range rxAssetRef.FindAllStringSubmatch(string(content), -1) {
+			ref := match[1]
+			if strings.Contains(ref, "//") {
+				// not vendored yet, exporting from the command line refuses to run until it is
+				continue
+			}
+			_, err := os.Stat(filepath.Join(filepath.Dir(path), filepath.FromSlash(ref)))
+			if err != nil {
+				t.Errorf("%s: want %s in the export, got %v", path, ref, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "guide", "99.html"))
+	if !os.IsNotExist(err) {
+		t.Error("want previous export of the guides replaced")
+	}
+	_, err = os.Stat(filepath.Join(dir, "robots.txt"))
+	if err != nil {
+		t.Error("want other files of the site kept")
+	}
+}
@@ -3,25 +3,105 @@ package guide
 import (
 	"database/sql"
 	"errors"
-	_ "modernc.org/sqlite"
+	"fmt"
+	"io"
+	"modernc.org/sqlite"
+	"strings"
+	"time"
 )
 
 type Storage interface {
 	CreateGuide(*guide) error
 	GetGuidebyID(int64) (*guide, error)
+	// ResolveGuideSlug returns the ID and current slug of the guide with slug, or that had it
+	// before being renamed, and 0 if there is none.
+	ResolveGuideSlug(slug string) (int64, string, error)
 	UpdateGuide(*guide) error
 	DeleteGuide(int64) error
+	ForkGuide(int64, int64) (*guide, error)
 	GetAllGuides() []guide
 	Search(string) ([]guide, error)
 	CountGuides() int
+	// Backup writes a consistent snapshot of the database to a new file at path.
+	Backup(path string) error
+	// Dump passes every entity, except sessions, to emit in the order of dumpKinds.
+	Dump(emit func(dumpEntity) error) error
+	// Load inserts the entities returned by next, keeping their IDs, until next returns io.EOF.
+	// verify is passed the count of the entities of each dump kind once they are inserted, and its
+	// error rolls them back. Either all entities are loaded or none are.
+	Load(next func() (dumpEntity, error), verify func(loaded map[string]int) error) error
+	// CountEntities counts the entities of each dump kind.
+	CountEntities() (map[string]int, error)
 
 	GetPoi(int64, int64) (*pointOfInterest, error)
+	GetPoiBySlug(guideID int64, slug string) (*pointOfInterest, error)
+	// GetTranslations returns the translations of the guide and its pois.
+	GetTranslations(guideID int64) (guideTranslations, error)
+	// GetAllGuideTranslations returns the translations of every guide without those of their pois, by
+	// guide ID, for lists of guides.
+	GetAllGuideTranslations() (map[int64]guideTranslations, error)
+	// SaveTranslations replaces the translations to locale of the guide and its pois with guide, nil
+	// if the guide isn't translated, and pois, by poi ID.
+	SaveTranslations(guideID int64, locale string, guide *translation, pois map[int64]translation) error
+	DeleteTranslations(guideID int64, locale string) error
 	CreatePoi(*pointOfInterest) error
+	UpsertPois([]pointOfInterest) error
 	UpdatePoi(*pointOfInterest) error
 	DeletePoi(int64, int64) error
 	GetAllPois(int64) []pointOfInterest
+	// GetPoisInBounds returns the pois of a guide within the south, west, north and east bounds.
+	GetPoisInBounds(guideID int64, south, west, north, east float64) ([]pointOfInterest, error)
+
+	CreateCity(*city) error
+	GetCityBySlug(string) (*city, error)
+	// GetAllCities returns the cities by name, with the count of their guides.
+	GetAllCities() []city
+	GetCityGuides(int64) []guide
+	// SuggestCity returns the city whose bounds contain c with the nearest center, nil if none does.
+	SuggestCity(c coordinate) (*city, error)
+
+	GetItinerary(int64, int64) (*itinerary, error)
+	CreateItinerary(*itinerary) error
+	UpdateItineraryPois(*itinerary) error
+	DeleteItinerary(int64, int64) error
+	GetAllItineraries(int64) []itinerary
+
+	CreateUser(*user) error
+	GetUserByUsername(string) (*user, error)
+	CreateSession(string, int64) error
+	GetSessionUser(string) (*user, error)
+	DeleteSession(string) error
+	// SetUserAdmin grants or revokes the admin rights of an existing user.
+	SetUserAdmin(username string, admin bool) error
+
+	ToggleFavorite(int64, int64) error
+	GetFavorite(int64, int64) (favorite, error)
+	GetFavoriteGuides(int64) []guide
+
+	CreateList(*list) error
+	DeleteList(int64, int64) error
+	GetAllLists(int64) []list
+	ToggleListPoi(int64, int64, int64) error
+
+	GetComment(int64, int64) (*comment, error)
+	CreateComment(*comment) error
+	UpdateComment(*comment) error
+	DeleteComment(int64, int64) error
+	GetAllComments(int64) []comment
+}
+
+// errConflict is returned when a change conflicts with existing data, e.g. deleting a guide that
+// still has points of interest.
+var errConflict = errors.New("conflict with existing data")
+
+// isConstraintError reports whether err is a sqlite constraint violation(foreign key, unique, check...).
+func isConstraintError(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqliteConstraint
 }
 
+const sqliteConstraint = 19
+
 type sqliteStore struct {
 	db *sql.DB
 }
@@ -30,16 +110,20 @@ func OpenSQLiteStorage(dbPath string) (Storage, error) {
 	if dbPath == "" {
 		return &sqliteStore{}, errors.New("db source cannot be empty")
 	}
-	db, err := sql.Open("sqlite", dbPath)
+	// the busy timeout and foreign keys are settings of each connection, so every connection the
+	// pool opens sets them from the DSN
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("sqlite", dbPath+sep+connectionPragmas)
 	if err != nil {
 		return &sqliteStore{}, err
 	}
 
-	for _, stmt := range []string{pragmaWALEnabled, pragma500BusyTimeout, pragmaForeignKeysON} {
-		_, err = db.Exec(stmt, nil)
-		if err != nil {
-			return &sqliteStore{}, err
-		}
+	_, err = db.Exec(pragmaWALEnabled, nil)
+	if err != nil {
+		return &sqliteStore{}, err
 	}
 
 	_, err = db.Exec(createGuideTable)
@@ -52,198 +136,994 @@ func OpenSQLiteStorage(dbPath string) (Storage, error) {
 		return &sqliteStore{}, err
 	}
 
+	for _, stmt := range []string{createCityTable, createGuideSlugRedirectTable, createGuideTranslationTable, createPoiTranslationTable, createItineraryTable, createItineraryPoiTable, createUserTable, createSessionTable, createFavoriteTable, createListTable, createListPoiTable, createCommentTable} {
+		_, err = db.Exec(stmt)
+		if err != nil {
+			return &sqliteStore{}, err
+		}
+	}
+
+	err = migrate(db)
+	if err != nil {
+		return &sqliteStore{}, err
+	}
+	err = backfillSlugs(db)
+	if err != nil {
+		return &sqliteStore{}, err
+	}
+
 	store := sqliteStore{
 		db: db,
 	}
 	return &store, nil
 }
 
-func (s *sqliteStore) CreateGuide(guide *guide) error {
-	stmt, err := s.db.Prepare(insertGuide)
+// migrations upgrade the tables of databases created by older versions. A database has applied the
+// migrations up to its schema version, stored as PRAGMA user_version. Only append to this list.
+var migrations = []string{
+	`ALTER TABLE guide ADD COLUMN ownerId INTEGER REFERENCES user(Id) ON DELETE SET NULL;`,
+	`ALTER TABLE guide ADD COLUMN forkedFromId INTEGER REFERENCES guide(Id) ON DELETE SET NULL;`,
+	`ALTER TABLE poi ADD COLUMN category TEXT NOT NULL DEFAULT '';`,
+	`CREATE INDEX poi_guide_location ON poi(guideId, latitude, longitude);`,
+	`ALTER TABLE guide ADD COLUMN cityId INTEGER REFERENCES city(Id) ON DELETE SET NULL;`,
+	`CREATE INDEX guide_city ON guide(cityId);`,
+	`ALTER TABLE guide ADD COLUMN slug TEXT;`,
+	`CREATE UNIQUE INDEX guide_slug ON guide(slug);`,
+	`ALTER TABLE poi ADD COLUMN slug TEXT;`,
+	`CREATE UNIQUE INDEX poi_guide_slug ON poi(guideId, slug);`,
+	`ALTER TABLE guide ADD COLUMN language TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE user ADD COLUMN admin INTEGER NOT NULL DEFAULT 0;`,
+}
+
+func (s *sqliteStore) Backup(path string) error {
+	_, err := s.db.Exec(vacuumInto, path)
+	return err
+}
+
+func (s *sqliteStore) Dump(emit func(dumpEntity) error) error {
+	// a read transaction sees a consistent snapshot while the server keeps writing
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	rs, err := stmt.Exec(guide.Name, guide.Description, guide.Coordinate.Latitude, guide.Coordinate.Longitude)
+	itineraryPois, err := queryPoiIDs(tx, dumpItineraryPois)
 	if err != nil {
 		return err
 	}
-	lastInsertID, err := rs.LastInsertId()
+	listPois, err := queryPoiIDs(tx, dumpListPois)
 	if err != nil {
 		return err
 	}
-	guide.Id = lastInsertID
-	return nil
-}
-
-func (s *sqliteStore) GetGuidebyID(id int64) (*guide, error) {
-	var (
-		name        string
-		description string
-		latitude    float64
-		longitude   float64
-	)
-	err := s.db.QueryRow(getGuide, id).Scan(&name, &description, &latitude, &longitude)
-	switch {
-	case err == sql.ErrNoRows:
-		return nil, nil
-	case err != nil:
-		return nil, err
-	default:
-		g := guide{
-			Id:          id,
-			Name:        name,
-			Description: description,
-			Coordinate: coordinate{
-				Latitude:  latitude,
-				Longitude: longitude,
-			},
-			Pois: nil,
-		}
-		return &g, nil
+	oldSlugs, err := queryOldSlugs(tx)
+	if err != nil {
+		return err
 	}
-}
-
-func (s *sqliteStore) UpdateGuide(g *guide) error {
-	stmt, err := s.db.Prepare(updateGuide)
+	guideTranslations, err := queryDumpTranslations(tx, dumpGuideTranslations)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-	_, err = stmt.Exec(g.Name, g.Description, g.Coordinate.Latitude, g.Coordinate.Longitude, g.Id)
+	poiTranslations, err := queryDumpTranslations(tx, dumpPoiTranslations)
 	if err != nil {
 		return err
 	}
+	scans := []struct {
+		query string
+		scan  func(*sql.Rows) (dumpEntity, error)
+	}{
+		{dumpUsers, func(rows *sql.Rows) (dumpEntity, error) {
+			var u dumpUser
+			return &u, rows.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Email, &u.Admin)
+		}},
+		{dumpCities, func(rows *sql.Rows) (dumpEntity, error) {
+			var c dumpCity
+			return &c, rows.Scan(&c.ID, &c.Name, &c.Country, &c.Timezone, &c.Slug, &c.Latitude, &c.Longitude, &c.South, &c.West, &c.North, &c.East)
+		}},
+		{dumpGuides, func(rows *sql.Rows) (dumpEntity, error) {
+			var (
+				g                             dumpGuide
+				ownerID, forkedFromID, cityID sql.NullInt64
+			)
+			err := rows.Scan(&g.ID, &g.Name, &g.Slug, &g.Description, &g.Latitude, &g.Longitude, &ownerID, &forkedFromID, &cityID, &g.Language)
+			g.OwnerID, g.ForkedFromID, g.CityID = ownerID.Int64, forkedFromID.Int64, cityID.Int64
+			g.OldSlugs = oldSlugs[g.ID]
+			g.Translations = guideTranslations[g.ID]
+			return &g, err
+		}},
+		{dumpPois, func(rows *sql.Rows) (dumpEntity, error) {
+			var p dumpPoi
+			err := rows.Scan(&p.ID, &p.GuideID, &p.Name, &p.Slug, &p.Description, &p.Latitude, &p.Longitude, &p.Category)
+			p.Translations = poiTranslations[p.ID]
+			return &p, err
+		}},
+		{dumpItineraries, func(rows *sql.Rows) (dumpEntity, error) {
+			var i dumpItinerary
+			err := rows.Scan(&i.ID, &i.GuideID, &i.Name)
+			i.PoiIDs = itineraryPois[i.ID]
+			return &i, err
+		}},
+		{dumpFavorites, func(rows *sql.Rows) (dumpEntity, error) {
+			var f dumpFavorite
+			return &f, rows.Scan(&f.UserID, &f.GuideID)
+		}},
+		{dumpLists, func(rows *sql.Rows) (dumpEntity, error) {
+			var l dumpList
+			err := rows.Scan(&l.ID, &l.UserID, &l.Name)
+			l.PoiIDs = listPois[l.ID]
+			return &l, err
+		}},
+		{dumpComments, func(rows *sql.Rows) (dumpEntity, error) {
+			var (
+				c         dumpComment
+				parentID  sql.NullInt64
+				createdAt string
+			)
+			err := rows.Scan(&c.ID, &c.GuideID, &c.UserID, &parentID, &c.Body, &c.Hidden, &c.Deleted, &createdAt)
+			if err != nil {
+				return nil, err
+			}
+			c.ParentID = parentID.Int64
+			c.CreatedAt, err = time.Parse(sqliteTimestamp, createdAt)
+			return &c, err
+		}},
+	}
+	for _, kind := range scans {
+		err = dumpRows(tx, kind.query, kind.scan, emit)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (s *sqliteStore) DeleteGuide(id int64) error {
-	stmt, err := s.db.Prepare(deleteGuide)
+func dumpRows(tx *sql.Tx, query string, scan func(*sql.Rows) (dumpEntity, error), emit func(dumpEntity) error) error {
+	rows, err := tx.Query(query)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-	_, err = stmt.Exec(id)
-	if err != nil {
-		return err
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		err = emit(e)
+		if err != nil {
+			return err
+		}
 	}
-	return nil
+	return rows.Err()
 }
 
-func (s *sqliteStore) GetAllGuides() []guide {
-	rows, err := s.db.Query(getAllGuides)
+// queryOldSlugs maps the guides to the slugs they had before being renamed.
+func queryOldSlugs(tx *sql.Tx) (map[int64][]string, error) {
+	rows, err := tx.Query(dumpGuideSlugRedirects)
 	if err != nil {
-		return []guide{}
+		return nil, err
 	}
+	defer rows.Close()
+	slugs := map[int64][]string{}
+	for rows.Next() {
+		var (
+			guideID int64
+			slug    string
+		)
+		err = rows.Scan(&guideID, &slug)
+		if err != nil {
+			return nil, err
+		}
+		slugs[guideID] = append(slugs[guideID], slug)
+	}
+	return slugs, rows.Err()
+}
 
-	guides := make([]guide, 0)
-
+// queryDumpTranslations maps the guides or pois to their translations by locale.
+func queryDumpTranslations(tx *sql.Tx, query string) (map[int64]map[string]dumpTranslation, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	translations := map[int64]map[string]dumpTranslation{}
 	for rows.Next() {
 		var (
-			id          int64
-			name        string
-			description string
-			latitude    float64
-			longitude   float64
+			id     int64
+			locale string
+			t      dumpTranslation
 		)
-		err = rows.Scan(&id, &name, &description, &latitude, &longitude)
+		err = rows.Scan(&id, &locale, &t.Name, &t.Description)
 		if err != nil {
-			return []guide{}
+			return nil, err
 		}
-		g := guide{
-			Id:          id,
-			Name:        name,
-			Description: description,
-			Coordinate:  coordinate{Latitude: latitude, Longitude: longitude},
+		if translations[id] == nil {
+			translations[id] = map[string]dumpTranslation{}
 		}
-		guides = append(guides, g)
+		translations[id][locale] = t
+	}
+	return translations, rows.Err()
+}
+
+// queryPoiIDs maps the itineraries or lists of query to their ordered poi IDs.
+func queryPoiIDs(tx *sql.Tx, query string) (map[int64][]int64, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	poiIDs := map[int64][]int64{}
+	for rows.Next() {
+		var id, poiID int64
+		err = rows.Scan(&id, &poiID)
+		if err != nil {
+			return nil, err
+		}
+		poiIDs[id] = append(poiIDs[id], poiID)
 	}
+	return poiIDs, rows.Err()
+}
 
-	if err = rows.Err(); err != nil {
-		return []guide{}
+func (s *sqliteStore) Load(next func() (dumpEntity, error), verify func(loaded map[string]int) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	return guides
+	for {
+		e, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = loadEntity(tx, e)
+		if err != nil {
+			return fmt.Errorf("not able to load %s: %w", e.dumpKind(), err)
+		}
+	}
+	// dumps made before slugs don't have them
+	err = backfillSlugsTx(tx)
+	if err != nil {
+		return err
+	}
+	loaded, err := countDumpEntities(tx)
+	if err != nil {
+		return err
+	}
+	err = verify(loaded)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (s *sqliteStore) CreatePoi(poi *pointOfInterest) error {
-	stmt, err := s.db.Prepare(insertPoi)
+func loadEntity(tx *sql.Tx, e dumpEntity) error {
+	switch e := e.(type) {
+	case *dumpUser:
+		_, err := tx.Exec(loadUser, e.ID, e.Username, e.PasswordHash, e.Email, e.Admin)
+		return err
+	case *dumpCity:
+		_, err := tx.Exec(loadCity, e.ID, e.Name, e.Country, e.Timezone, e.Slug, e.Latitude, e.Longitude, e.South, e.West, e.North, e.East)
+		return err
+	case *dumpGuide:
+		_, err := tx.Exec(loadGuide, e.ID, e.Name, nullableSlug(e.Slug), e.Description, e.Latitude, e.Longitude, nullableID(e.OwnerID), nullableID(e.ForkedFromID), nullableID(e.CityID), e.Language)
+		if err != nil {
+			return err
+		}
+		for _, slug := range e.OldSlugs {
+			_, err = tx.Exec(insertGuideSlugRedirect, slug, e.ID)
+			if err != nil {
+				return err
+			}
+		}
+		for locale, t := range e.Translations {
+			_, err = tx.Exec(insertGuideTranslation, e.ID, locale, t.Name, t.Description)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *dumpPoi:
+		_, err := tx.Exec(loadPoi, e.ID, e.GuideID, e.Name, nullableSlug(e.Slug), e.Description, e.Latitude, e.Longitude, e.Category)
+		if err != nil {
+			return err
+		}
+		for locale, t := range e.Translations {
+			_, err = tx.Exec(loadPoiTranslation, e.ID, locale, t.Name, t.Description)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *dumpItinerary:
+		_, err := tx.Exec(loadItinerary, e.ID, e.GuideID, e.Name)
+		if err != nil {
+			return err
+		}
+		for position, poiID := range e.PoiIDs {
+			_, err = tx.Exec(insertItineraryPoi, e.ID, poiID, position)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *dumpFavorite:
+		_, err := tx.Exec(insertFavorite, e.UserID, e.GuideID)
+		return err
+	case *dumpList:
+		_, err := tx.Exec(loadList, e.ID, e.UserID, e.Name)
+		if err != nil {
+			return err
+		}
+		for _, poiID := range e.PoiIDs {
+			_, err = tx.Exec(insertListPoi, e.ID, poiID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *dumpComment:
+		_, err := tx.Exec(loadComment, e.ID, e.GuideID, e.UserID, nullableID(e.ParentID), e.Body, e.Hidden, e.Deleted, e.CreatedAt.UTC().Format(sqliteTimestamp))
+		return err
+	}
+	return fmt.Errorf("unexpected entity %T", e)
+}
+
+func (s *sqliteStore) CountEntities() (map[string]int, error) {
+	return countDumpEntities(s.db)
+}
+
+func countDumpEntities(q queryRower) (map[string]int, error) {
+	var users, cities, guides, pois, itineraries, favorites, lists, comments int
+	err := q.QueryRow(countEntities).Scan(&users, &cities, &guides, &pois, &itineraries, &favorites, &lists, &comments)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{
+		dumpKindUser:      users,
+		dumpKindCity:      cities,
+		dumpKindGuide:     guides,
+		dumpKindPoi:       pois,
+		dumpKindItinerary: itineraries,
+		dumpKindFavorite:  favorites,
+		dumpKindList:      lists,
+		dumpKindComment:   comments,
+	}, nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	err := db.QueryRow(pragmaUserVersion).Scan(&version)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(migrations[version])
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		_, err = tx.Exec(fmt.Sprintf(pragmaSetUserVersion, version+1))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nullableID maps the zero ID to NULL for optional foreign keys.
+func nullableID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// nullableSlug maps the empty slug to NULL, for the slugs to backfill.
+func nullableSlug(slug string) sql.NullString {
+	return sql.NullString{String: slug, Valid: slug != ""}
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// newGuideSlug is the slug of the guide named name: current while it fits the name, or one that no
+// other guide has or had.
+func newGuideSlug(q queryRower, guideID int64, name, current string) (string, error) {
+	base := slugOr(name, "guide")
+	if current != "" && fitsSlug(current, base) {
+		return current, nil
+	}
+	return uniqueSlug(base, func(slug string) (bool, error) {
+		var taken bool
+		err := q.QueryRow(guideSlugTaken, slug, guideID, slug, guideID).Scan(&taken)
+		return taken, err
+	})
+}
+
+// newPoiSlug is the slug of the poi named name: current while it fits the name, or one that no
+// other poi of the guide has.
+func newPoiSlug(q queryRower, guideID, poiID int64, name, current string) (string, error) {
+	base := slugOr(name, "poi")
+	if current != "" && fitsSlug(current, base) {
+		return current, nil
+	}
+	return uniqueSlug(base, func(slug string) (bool, error) {
+		var taken bool
+		err := q.QueryRow(poiSlugTaken, guideID, slug, poiID).Scan(&taken)
+		return taken, err
+	})
+}
 
-	rs, err := stmt.Exec(poi.Name, poi.Description, poi.Coordinate.Latitude, poi.Coordinate.Longitude, poi.GuideID)
+// backfillSlugs gives slugs to the guides and pois created before slugs.
+func backfillSlugs(db *sql.DB) error {
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	lastInsertID, err := rs.LastInsertId()
+	defer tx.Rollback()
+	err = backfillSlugsTx(tx)
 	if err != nil {
 		return err
 	}
-	poi.Id = lastInsertID
+	return tx.Commit()
+}
+
+func backfillSlugsTx(tx *sql.Tx) error {
+	type unslugged struct {
+		id, guideID int64
+		name        string
+	}
+	for _, kind := range []struct {
+		query, update string
+		slug          func(u unslugged) (string, error)
+	}{
+		{getGuidesWithoutSlug, setGuideSlug, func(u unslugged) (string, error) { return newGuideSlug(tx, u.id, u.name, "") }},
+		{getPoisWithoutSlug, setPoiSlug, func(u unslugged) (string, error) { return newPoiSlug(tx, u.guideID, u.id, u.name, "") }},
+	} {
+		rows, err := tx.Query(kind.query)
+		if err != nil {
+			return err
+		}
+		var pending []unslugged
+		for rows.Next() {
+			var u unslugged
+			err = rows.Scan(&u.id, &u.guideID, &u.name)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			pending = append(pending, u)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		// each slug is saved before the next is chosen, so two rows don't get the same one
+		for _, u := range pending {
+			slug, err := kind.slug(u)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(kind.update, slug, u.id)
+			if err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
-func (s *sqliteStore) UpdatePoi(poi *pointOfInterest) error {
-	stmt, err := s.db.Prepare(updatePoi)
+func (s *sqliteStore) CreateGuide(guide *guide) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	_, err = stmt.Exec(poi.Name, poi.Description, poi.Coordinate.Latitude, poi.Coordinate.Longitude, poi.Id)
+	slug, err := newGuideSlug(tx, 0, guide.Name, "")
+	if err != nil {
+		return err
+	}
+	rs, err := tx.Exec(insertGuide, guide.Name, slug, guide.Description, guide.Coordinate.Latitude, guide.Coordinate.Longitude, nullableID(guide.OwnerID), nullableID(guide.CityID), guide.Language)
+	if err != nil {
+		return err
+	}
+	lastInsertID, err := rs.LastInsertId()
 	if err != nil {
 		return err
 	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	guide.Id = lastInsertID
+	guide.Slug = slug
 	return nil
 }
 
-func (s *sqliteStore) GetPoi(guideID, poiID int64) (*pointOfInterest, error) {
+func (s *sqliteStore) GetGuidebyID(id int64) (*guide, error) {
 	var (
-		name        string
-		description string
-		latitude    float64
-		longitude   float64
+		name           string
+		description    string
+		latitude       float64
+		longitude      float64
+		ownerID        sql.NullInt64
+		forkedFromID   sql.NullInt64
+		forkedFromName sql.NullString
+		forkedFromSlug sql.NullString
+		cityID         sql.NullInt64
+		cityName       sql.NullString
+		citySlug       sql.NullString
+		slug           string
+		language       string
 	)
-	err := s.db.QueryRow(getPoi, guideID, poiID).Scan(&name, &description, &latitude, &longitude)
+	err := s.db.QueryRow(getGuide, id).Scan(&name, &slug, &description, &latitude, &longitude, &ownerID, &forkedFromID, &forkedFromName, &forkedFromSlug, &cityID, &cityName, &citySlug, &language)
 	switch {
 	case err == sql.ErrNoRows:
 		return nil, nil
 	case err != nil:
 		return nil, err
 	default:
-		p := pointOfInterest{
-			Id:      poiID,
-			GuideID: guideID,
+		g := guide{
+			Id:          id,
+			Name:        name,
+			Slug:        slug,
+			Description: description,
 			Coordinate: coordinate{
 				Latitude:  latitude,
 				Longitude: longitude,
 			},
-			Name:        name,
-			Description: description,
+			Pois:           nil,
+			OwnerID:        ownerID.Int64,
+			ForkedFromID:   forkedFromID.Int64,
+			ForkedFromName: forkedFromName.String,
+			ForkedFromSlug: forkedFromSlug.String,
+			Language:       language,
+			CityID:         cityID.Int64,
+			CityName:       cityName.String,
+			CitySlug:       citySlug.String,
 		}
-		return &p, nil
-
+		return &g, nil
 	}
 }
 
-func (s *sqliteStore) DeletePoi(guideId, poiID int64) error {
-	stmt, err := s.db.Prepare(deletePoi)
+// UpdateGuide saves the guide. Renaming it changes its slug, and the old slug is kept to redirect
+// to the guide.
+func (s *sqliteStore) UpdateGuide(g *guide) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-	_, err = stmt.Exec(guideId, poiID)
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow(getGuideSlug, g.Id).Scan(&current)
+	if err == sql.ErrNoRows {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	slug, err := newGuideSlug(tx, g.Id, g.Name, current)
+	if err != nil {
+		return err
+	}
+	if slug != current {
+		// renamed back to one of its old names
+		_, err = tx.Exec(deleteGuideSlugRedirect, slug)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(insertGuideSlugRedirect, current, g.Id)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(updateGuide, g.Name, slug, g.Description, g.Coordinate.Latitude, g.Coordinate.Longitude, nullableID(g.CityID), g.Language, g.Id)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	g.Slug = slug
 	return nil
 }
 
-func (s *sqliteStore) GetAllPois(guideId int64) []pointOfInterest {
-	rows, err := s.db.Query(getAllPois, guideId)
+func (s *sqliteStore) ResolveGuideSlug(slug string) (int64, string, error) {
+	var (
+		id      int64
+		current string
+	)
+	err := s.db.QueryRow(resolveGuideSlug, slug, slug).Scan(&id, &current)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, "", nil
+	case err != nil:
+		return 0, "", err
+	default:
+		return id, current, nil
+	}
+}
+
+func (s *sqliteStore) DeleteGuide(id int64) error {
+	stmt, err := s.db.Prepare(deleteGuide)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(id)
+	if isConstraintError(err) {
+		return fmt.Errorf("%w: guide still has points of interest", errConflict)
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ForkGuide copies the guide with its pois and itineraries under userID and records the upstream guide.
+// It returns nil if the guide doesn't exist.
+func (s *sqliteStore) ForkGuide(guideID, userID int64) (*guide, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rs, err := tx.Exec(forkGuide, nullableID(userID), guideID)
+	if err != nil {
+		return nil, err
+	}
+	copied, err := rs.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if copied == 0 {
+		return nil, nil
+	}
+	forkID, err := rs.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	var name string
+	err = tx.QueryRow(getGuideName, forkID).Scan(&name)
+	if err != nil {
+		return nil, err
+	}
+	slug, err := newGuideSlug(tx, forkID, name, "")
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(setGuideSlug, slug, forkID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(copyGuideTranslations, forkID, guideID)
+	if err != nil {
+		return nil, err
+	}
+
+	// upstream poi ID -> fork poi ID
+	poiIDs := map[int64]int64{}
+	rows, err := tx.Query(getAllPois, guideID)
+	if err != nil {
+		return nil, err
+	}
+	pois := make([]pointOfInterest, 0)
+	for rows.Next() {
+		var p pointOfInterest
+		err = rows.Scan(&p.Id, &p.Name, &p.Slug, &p.Description, &p.Coordinate.Latitude, &p.Coordinate.Longitude, &p.Category, &p.GuideSlug)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pois = append(pois, p)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, p := range pois {
+		rs, err = tx.Exec(insertPoi, p.Name, p.Slug, p.Description, p.Coordinate.Latitude, p.Coordinate.Longitude, p.Category, forkID)
+		if err != nil {
+			return nil, err
+		}
+		poiIDs[p.Id], err = rs.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(copyPoiTranslations, poiIDs[p.Id], p.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err = tx.Query(getAllItineraries, guideID)
+	if err != nil {
+		return nil, err
+	}
+	itineraries := make([]itinerary, 0)
+	for rows.Next() {
+		var i itinerary
+		err = rows.Scan(&i.Id, &i.Name)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		itineraries = append(itineraries, i)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, i := range itineraries {
+		rs, err = tx.Exec(insertItinerary, i.Name, forkID)
+		if err != nil {
+			return nil, err
+		}
+		itineraryID, err := rs.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		rows, err = tx.Query(getItineraryStops, i.Id)
+		if err != nil {
+			return nil, err
+		}
+		stops := map[int]int64{}
+		for rows.Next() {
+			var (
+				poiID    int64
+				position int
+			)
+			err = rows.Scan(&poiID, &position)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			stops[position] = poiIDs[poiID]
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		for position, poiID := range stops {
+			_, err = tx.Exec(insertItineraryPoi, itineraryID, poiID, position)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return s.GetGuidebyID(forkID)
+}
+
+func (s *sqliteStore) GetAllGuides() []guide {
+	rows, err := s.db.Query(getAllGuides)
+	if err != nil {
+		return []guide{}
+	}
+
+	guides := make([]guide, 0)
+
+	for rows.Next() {
+		var (
+			id          int64
+			name        string
+			slug        string
+			description string
+			latitude    float64
+			longitude   float64
+		)
+		err = rows.Scan(&id, &name, &slug, &description, &latitude, &longitude)
+		if err != nil {
+			return []guide{}
+		}
+		g := guide{
+			Id:          id,
+			Name:        name,
+			Slug:        slug,
+			Description: description,
+			Coordinate:  coordinate{Latitude: latitude, Longitude: longitude},
+		}
+		guides = append(guides, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return []guide{}
+	}
+
+	return guides
+}
+
+func (s *sqliteStore) CreatePoi(poi *pointOfInterest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	slug, err := newPoiSlug(tx, poi.GuideID, 0, poi.Name, "")
+	if err != nil {
+		return err
+	}
+	rs, err := tx.Exec(insertPoi, poi.Name, slug, poi.Description, poi.Coordinate.Latitude, poi.Coordinate.Longitude, poi.Category, poi.GuideID)
+	if err != nil {
+		return err
+	}
+	lastInsertID, err := rs.LastInsertId()
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	poi.Id = lastInsertID
+	poi.Slug = slug
+	return nil
+}
+
+// UpsertPois updates the pois with an ID and creates the others, setting their IDs. Either all
+// pois are saved or none of them.
+func (s *sqliteStore) UpsertPois(pois []pointOfInterest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, 0, len(pois))
+	slugs := make([]string, 0, len(pois))
+	for _, poi := range pois {
+		if poi.Id > 0 {
+			var current string
+			err := tx.QueryRow(getPoiSlug, poi.GuideID, poi.Id).Scan(&current)
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("poi %d is not in guide %d", poi.Id, poi.GuideID)
+			}
+			if err != nil {
+				return err
+			}
+			slug, err := newPoiSlug(tx, poi.GuideID, poi.Id, poi.Name, current)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(updateGuidePoi, poi.Name, slug, poi.Description, poi.Coordinate.Latitude, poi.Coordinate.Longitude, poi.Category, poi.Id, poi.GuideID)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, poi.Id)
+			slugs = append(slugs, slug)
+			continue
+		}
+		slug, err := newPoiSlug(tx, poi.GuideID, 0, poi.Name, "")
+		if err != nil {
+			return err
+		}
+		rs, err := tx.Exec(insertPoi, poi.Name, slug, poi.Description, poi.Coordinate.Latitude, poi.Coordinate.Longitude, poi.Category, poi.GuideID)
+		if err != nil {
+			return err
+		}
+		id, err := rs.LastInsertId()
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		slugs = append(slugs, slug)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	for i := range pois {
+		pois[i].Id = ids[i]
+		pois[i].Slug = slugs[i]
+	}
+	return nil
+}
+
+func (s *sqliteStore) UpdatePoi(poi *pointOfInterest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow(getPoiSlug, poi.GuideID, poi.Id).Scan(&current)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slug, err := newPoiSlug(tx, poi.GuideID, poi.Id, poi.Name, current)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(updatePoi, poi.Name, slug, poi.Description, poi.Coordinate.Latitude, poi.Coordinate.Longitude, poi.Category, poi.Id)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	poi.Slug = slug
+	return nil
+}
+
+func (s *sqliteStore) GetPoi(guideID, poiID int64) (*pointOfInterest, error) {
+	return s.scanPoi(guideID, s.db.QueryRow(getPoi, guideID, poiID))
+}
+
+func (s *sqliteStore) GetPoiBySlug(guideID int64, slug string) (*pointOfInterest, error) {
+	return s.scanPoi(guideID, s.db.QueryRow(getPoiBySlug, guideID, slug))
+}
+
+func (s *sqliteStore) scanPoi(guideID int64, row *sql.Row) (*pointOfInterest, error) {
+	p := pointOfInterest{GuideID: guideID}
+	err := row.Scan(&p.Id, &p.Name, &p.Slug, &p.Description, &p.Coordinate.Latitude, &p.Coordinate.Longitude, &p.Category, &p.GuideSlug)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	default:
+		return &p, nil
+	}
+}
+
+func (s *sqliteStore) GetPoisInBounds(guideID int64, south, west, north, east float64) ([]pointOfInterest, error) {
+	rows, err := s.db.Query(getPoisInBounds, guideID, south, north, west, east)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pois := make([]pointOfInterest, 0)
+	for rows.Next() {
+		p := pointOfInterest{GuideID: guideID}
+		err = rows.Scan(&p.Id, &p.Name, &p.Description, &p.Coordinate.Latitude, &p.Coordinate.Longitude, &p.Category)
+		if err != nil {
+			return nil, err
+		}
+		pois = append(pois, p)
+	}
+	return pois, rows.Err()
+}
+
+func (s *sqliteStore) DeletePoi(guideId, poiID int64) error {
+	stmt, err := s.db.Prepare(deletePoi)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(guideId, poiID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *sqliteStore) GetAllPois(guideId int64) []pointOfInterest {
+	rows, err := s.db.Query(getAllPois, guideId)
 	if err != nil {
 		return []pointOfInterest{}
 	}
@@ -254,20 +1134,26 @@ func (s *sqliteStore) GetAllPois(guideId int64) []pointOfInterest {
 		var (
 			id          int64
 			name        string
+			slug        string
 			description string
 			latitude    float64
 			longitude   float64
+			category    string
+			guideSlug   string
 		)
-		err = rows.Scan(&id, &name, &description, &latitude, &longitude)
+		err = rows.Scan(&id, &name, &slug, &description, &latitude, &longitude, &category, &guideSlug)
 		if err != nil {
 			return []pointOfInterest{}
 		}
 		p := pointOfInterest{
 			Id:          id,
 			Name:        name,
+			Slug:        slug,
 			Description: description,
 			Coordinate:  coordinate{Latitude: latitude, Longitude: longitude},
+			Category:    category,
 			GuideID:     guideId,
+			GuideSlug:   guideSlug,
 		}
 		pois = append(pois, p)
 	}
@@ -279,8 +1165,9 @@ func (s *sqliteStore) GetAllPois(guideId int64) []pointOfInterest {
 	return pois
 }
 
+// Search returns the guides whose name, or one of its translations, contains query.
 func (s *sqliteStore) Search(query string) ([]guide, error) {
-	rows, err := s.db.Query(searchGuides, "%"+query+"%")
+	rows, err := s.db.Query(searchGuides, "%"+query+"%", "%"+query+"%")
 	if err != nil {
 		return nil, err
 	}
@@ -290,17 +1177,19 @@ func (s *sqliteStore) Search(query string) ([]guide, error) {
 		var (
 			id          int64
 			name        string
+			slug        string
 			description string
 			latitude    float64
 			longitude   float64
 		)
-		err = rows.Scan(&id, &name, &description, &latitude, &longitude)
+		err = rows.Scan(&id, &name, &slug, &description, &latitude, &longitude)
 		if err != nil {
 			return nil, err
 		}
 		g := guide{
 			Id:          id,
 			Name:        name,
+			Slug:        slug,
 			Description: description,
 			Coordinate: coordinate{
 				Latitude:  latitude,
@@ -336,16 +1225,766 @@ func (s *sqliteStore) CountGuides() int {
 	return count
 }
 
-const pragmaWALEnabled = `PRAGMA journal_mode = WAL;`
-const pragma500BusyTimeout = `PRAGMA busy_timeout = 5000;`
-const pragmaForeignKeysON = `PRAGMA foreign_keys = on;`
+func (s *sqliteStore) CreateItinerary(i *itinerary) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-const createGuideTable = `
-CREATE TABLE IF NOT EXISTS guide(
-Id INTEGER NOT NULL PRIMARY KEY,
-name TEXT  NOT NULL,
-description TEXT,
-latitude REAL NOT NULL,
+	rs, err := tx.Exec(insertItinerary, i.Name, i.GuideID)
+	if err != nil {
+		return err
+	}
+	lastInsertID, err := rs.LastInsertId()
+	if err != nil {
+		return err
+	}
+	err = insertItineraryPois(tx, lastInsertID, i.PoiIDs())
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	i.Id = lastInsertID
+	return nil
+}
+
+// UpdateItineraryPois replaces the stops of an itinerary with i.Pois in the given order.
+func (s *sqliteStore) UpdateItineraryPois(i *itinerary) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(updateItinerary, i.Name, i.Id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(deleteItineraryPois, i.Id)
+	if err != nil {
+		return err
+	}
+	err = insertItineraryPois(tx, i.Id, i.PoiIDs())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertItineraryPois(tx *sql.Tx, itineraryID int64, poiIDs []int64) error {
+	stmt, err := tx.Prepare(insertItineraryPoi)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for position, poiID := range poiIDs {
+		_, err = stmt.Exec(itineraryID, poiID, position)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) GetItinerary(guideID, itineraryID int64) (*itinerary, error) {
+	var (
+		name      string
+		guideName string
+		guideSlug string
+	)
+	err := s.db.QueryRow(getItinerary, guideID, itineraryID).Scan(&name, &guideName, &guideSlug)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	rows, err := s.db.Query(getItineraryPois, itineraryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pois := make([]pointOfInterest, 0)
+	for rows.Next() {
+		var (
+			id          int64
+			poiName     string
+			description string
+			latitude    float64
+			longitude   float64
+		)
+		err = rows.Scan(&id, &poiName, &description, &latitude, &longitude)
+		if err != nil {
+			return nil, err
+		}
+		p := pointOfInterest{
+			Id:          id,
+			Name:        poiName,
+			Description: description,
+			Coordinate:  coordinate{Latitude: latitude, Longitude: longitude},
+			GuideID:     guideID,
+		}
+		pois = append(pois, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	i := itinerary{
+		Id:        itineraryID,
+		GuideID:   guideID,
+		GuideName: guideName,
+		GuideSlug: guideSlug,
+		Name:      name,
+		Pois:      pois,
+	}
+	return &i, nil
+}
+
+func (s *sqliteStore) DeleteItinerary(guideID, itineraryID int64) error {
+	stmt, err := s.db.Prepare(deleteItinerary)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(guideID, itineraryID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *sqliteStore) GetAllItineraries(guideID int64) []itinerary {
+	rows, err := s.db.Query(getAllItineraries, guideID)
+	if err != nil {
+		return []itinerary{}
+	}
+	defer rows.Close()
+
+	itineraries := make([]itinerary, 0)
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			return []itinerary{}
+		}
+		itineraries = append(itineraries, itinerary{Id: id, GuideID: guideID, Name: name})
+	}
+
+	if err = rows.Err(); err != nil {
+		return []itinerary{}
+	}
+	return itineraries
+}
+
+func (s *sqliteStore) CreateUser(u *user) error {
+	stmt, err := s.db.Prepare(insertUser)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rs, err := stmt.Exec(u.Username, u.Password, u.Email)
+	if err != nil {
+		return err
+	}
+	lastInsertID, err := rs.LastInsertId()
+	if err != nil {
+		return err
+	}
+	u.Id = lastInsertID
+	return nil
+}
+
+func (s *sqliteStore) GetUserByUsername(username string) (*user, error) {
+	u := user{Username: username}
+	err := s.db.QueryRow(getUserByUsername, username).Scan(&u.Id, &u.Password, &u.Email, &u.Admin)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	default:
+		return &u, nil
+	}
+}
+
+func (s *sqliteStore) CreateSession(token string, userID int64) error {
+	stmt, err := s.db.Prepare(insertSession)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(token, userID)
+	return err
+}
+
+func (s *sqliteStore) GetSessionUser(token string) (*user, error) {
+	var u user
+	err := s.db.QueryRow(getSessionUser, token).Scan(&u.Id, &u.Username, &u.Password, &u.Email, &u.Admin)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	default:
+		return &u, nil
+	}
+}
+
+func (s *sqliteStore) DeleteSession(token string) error {
+	stmt, err := s.db.Prepare(deleteSession)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(token)
+	return err
+}
+
+func (s *sqliteStore) SetUserAdmin(username string, admin bool) error {
+	rs, err := s.db.Exec(setUserAdmin, admin, username)
+	if err != nil {
+		return err
+	}
+	n, err := rs.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("there is no user named %s, sign up first", username)
+	}
+	return nil
+}
+
+// ToggleFavorite stars the guide for the user or removes the star if already starred.
+func (s *sqliteStore) ToggleFavorite(userID, guideID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rs, err := tx.Exec(deleteFavorite, userID, guideID)
+	if err != nil {
+		return err
+	}
+	deleted, err := rs.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		_, err = tx.Exec(insertFavorite, userID, guideID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetFavorite returns whether userID starred the guide and its favorite count. A userID of 0 is an anonymous user.
+func (s *sqliteStore) GetFavorite(userID, guideID int64) (favorite, error) {
+	f := favorite{GuideID: guideID}
+	err := s.db.QueryRow(getFavorite, userID, guideID).Scan(&f.Favorited, &f.Count)
+	if err != nil {
+		return favorite{}, err
+	}
+	return f, nil
+}
+
+func (s *sqliteStore) GetFavoriteGuides(userID int64) []guide {
+	rows, err := s.db.Query(getFavoriteGuides, userID)
+	if err != nil {
+		return []guide{}
+	}
+	defer rows.Close()
+
+	guides := make([]guide, 0)
+	for rows.Next() {
+		var g guide
+		err = rows.Scan(&g.Id, &g.Name, &g.Slug, &g.Description, &g.Coordinate.Latitude, &g.Coordinate.Longitude)
+		if err != nil {
+			return []guide{}
+		}
+		guides = append(guides, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return []guide{}
+	}
+	return guides
+}
+
+func (s *sqliteStore) CreateList(l *list) error {
+	stmt, err := s.db.Prepare(insertList)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rs, err := stmt.Exec(l.Name, l.UserID)
+	if err != nil {
+		return err
+	}
+	lastInsertID, err := rs.LastInsertId()
+	if err != nil {
+		return err
+	}
+	l.Id = lastInsertID
+	return nil
+}
+
+func (s *sqliteStore) DeleteList(userID, listID int64) error {
+	stmt, err := s.db.Prepare(deleteList)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(userID, listID)
+	return err
+}
+
+// GetAllLists returns the lists of a user with their saved pois.
+func (s *sqliteStore) GetAllLists(userID int64) []list {
+	rows, err := s.db.Query(getAllLists, userID)
+	if err != nil {
+		return []list{}
+	}
+	defer rows.Close()
+
+	lists := make([]list, 0)
+	for rows.Next() {
+		var (
+			listID   int64
+			listName string
+			poiID    sql.NullInt64
+			poi      pointOfInterest
+		)
+		err = rows.Scan(&listID, &listName, &poiID, &poi.GuideID, &poi.Name, &poi.Slug, &poi.Description, &poi.Coordinate.Latitude, &poi.Coordinate.Longitude, &poi.GuideSlug)
+		if err != nil {
+			return []list{}
+		}
+		if len(lists) == 0 || lists[len(lists)-1].Id != listID {
+			lists = append(lists, list{Id: listID, UserID: userID, Name: listName, Pois: []pointOfInterest{}})
+		}
+		if poiID.Valid {
+			poi.Id = poiID.Int64
+			lists[len(lists)-1].Pois = append(lists[len(lists)-1].Pois, poi)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return []list{}
+	}
+	return lists
+}
+
+// ToggleListPoi saves the poi into a list of the user or removes it if already saved.
+func (s *sqliteStore) ToggleListPoi(userID, listID, poiID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owned bool
+	err = tx.QueryRow(listBelongsToUser, userID, listID).Scan(&owned)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		return errors.New("list not found")
+	}
+
+	rs, err := tx.Exec(deleteListPoi, listID, poiID)
+	if err != nil {
+		return err
+	}
+	deleted, err := rs.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		_, err = tx.Exec(insertListPoi, listID, poiID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) CreateComment(c *comment) error {
+	stmt, err := s.db.Prepare(insertComment)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rs, err := stmt.Exec(c.GuideID, c.UserID, nullableID(c.ParentID), c.Body)
+	if err != nil {
+		return err
+	}
+	lastInsertID, err := rs.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.Id = lastInsertID
+	return nil
+}
+
+func (s *sqliteStore) GetComment(guideID, commentID int64) (*comment, error) {
+	c, err := scanComment(s.db.QueryRow(getComment, guideID, commentID))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	default:
+		return &c, nil
+	}
+}
+
+func (s *sqliteStore) UpdateComment(c *comment) error {
+	stmt, err := s.db.Prepare(updateComment)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(c.Body, c.Hidden, c.GuideID, c.Id)
+	return err
+}
+
+// DeleteComment removes a comment. Comments with replies are kept as deleted placeholders so the
+// thread stays readable.
+func (s *sqliteStore) DeleteComment(guideID, commentID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var replies int
+	err = tx.QueryRow(countCommentReplies, commentID).Scan(&replies)
+	if err != nil {
+		return err
+	}
+	if replies > 0 {
+		_, err = tx.Exec(markCommentDeleted, guideID, commentID)
+	} else {
+		_, err = tx.Exec(deleteComment, guideID, commentID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAllComments returns the comments of a guide sorted by Id, replies aren't nested.
+func (s *sqliteStore) GetAllComments(guideID int64) []comment {
+	rows, err := s.db.Query(getAllComments, guideID)
+	if err != nil {
+		return []comment{}
+	}
+	defer rows.Close()
+
+	comments := make([]comment, 0)
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return []comment{}
+		}
+		comments = append(comments, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return []comment{}
+	}
+	return comments
+}
+
+func scanComment(row interface{ Scan(...any) error }) (comment, error) {
+	var (
+		c         comment
+		parentID  sql.NullInt64
+		createdAt string
+	)
+	err := row.Scan(&c.Id, &c.GuideID, &c.UserID, &c.Username, &parentID, &c.Body, &c.Hidden, &c.Deleted, &createdAt)
+	if err != nil {
+		return comment{}, err
+	}
+	c.ParentID = parentID.Int64
+	c.CreatedAt, err = time.Parse(sqliteTimestamp, createdAt)
+	if err != nil {
+		return comment{}, err
+	}
+	return c, nil
+}
+
+func (s *sqliteStore) CreateCity(c *city) error {
+	stmt, err := s.db.Prepare(insertCity)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rs, err := stmt.Exec(c.Name, c.Country, c.Timezone, c.Slug, c.Center.Latitude, c.Center.Longitude, c.Bounds.South, c.Bounds.West, c.Bounds.North, c.Bounds.East)
+	if isConstraintError(err) {
+		return fmt.Errorf("%w: there is already a city named %s", errConflict, c.Slug)
+	}
+	if err != nil {
+		return err
+	}
+	lastInsertID, err := rs.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.Id = lastInsertID
+	return nil
+}
+
+func (s *sqliteStore) GetCityBySlug(slug string) (*city, error) {
+	c, err := scanCity(s.db.QueryRow(getCityBySlug, slug))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	default:
+		return &c, nil
+	}
+}
+
+func (s *sqliteStore) GetAllCities() []city {
+	rows, err := s.db.Query(getAllCities)
+	if err != nil {
+		return []city{}
+	}
+	defer rows.Close()
+
+	cities := make([]city, 0)
+	for rows.Next() {
+		var c city
+		err = rows.Scan(&c.Id, &c.Name, &c.Country, &c.Timezone, &c.Slug, &c.Center.Latitude, &c.Center.Longitude, &c.Bounds.South, &c.Bounds.West, &c.Bounds.North, &c.Bounds.East, &c.GuideCount)
+		if err != nil {
+			return []city{}
+		}
+		cities = append(cities, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return []city{}
+	}
+	return cities
+}
+
+func (s *sqliteStore) GetCityGuides(cityID int64) []guide {
+	rows, err := s.db.Query(getCityGuides, cityID)
+	if err != nil {
+		return []guide{}
+	}
+	defer rows.Close()
+
+	guides := make([]guide, 0)
+	for rows.Next() {
+		g := guide{CityID: cityID}
+		err = rows.Scan(&g.Id, &g.Name, &g.Slug, &g.Description, &g.Coordinate.Latitude, &g.Coordinate.Longitude)
+		if err != nil {
+			return []guide{}
+		}
+		guides = append(guides, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return []guide{}
+	}
+	return guides
+}
+
+func (s *sqliteStore) SuggestCity(c coordinate) (*city, error) {
+	rows, err := s.db.Query(getCitiesContaining, c.Latitude, c.Longitude)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nearest *city
+	for rows.Next() {
+		candidate, err := scanCity(rows)
+		if err != nil {
+			return nil, err
+		}
+		if nearest == nil || distance(c, candidate.Center) < distance(c, nearest.Center) {
+			nearest = &candidate
+		}
+	}
+	return nearest, rows.Err()
+}
+
+func scanCity(row interface{ Scan(...any) error }) (city, error) {
+	var c city
+	err := row.Scan(&c.Id, &c.Name, &c.Country, &c.Timezone, &c.Slug, &c.Center.Latitude, &c.Center.Longitude, &c.Bounds.South, &c.Bounds.West, &c.Bounds.North, &c.Bounds.East)
+	if err != nil {
+		return city{}, err
+	}
+	return c, nil
+}
+
+func (s *sqliteStore) GetTranslations(guideID int64) (guideTranslations, error) {
+	t := guideTranslations{Guide: map[string]translation{}, Pois: map[int64]map[string]translation{}}
+	err := s.db.QueryRow(getGuideLanguage, guideID).Scan(&t.Language)
+	if err != nil && err != sql.ErrNoRows {
+		return guideTranslations{}, err
+	}
+	rows, err := s.db.Query(getGuideTranslations, guideID)
+	if err != nil {
+		return guideTranslations{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			locale string
+			tr     translation
+		)
+		err = rows.Scan(&locale, &tr.Name, &tr.Description)
+		if err != nil {
+			return guideTranslations{}, err
+		}
+		t.Guide[locale] = tr
+	}
+	if err = rows.Err(); err != nil {
+		return guideTranslations{}, err
+	}
+
+	rows, err = s.db.Query(getPoiTranslations, guideID)
+	if err != nil {
+		return guideTranslations{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			poiID  int64
+			locale string
+			tr     translation
+		)
+		err = rows.Scan(&poiID, &locale, &tr.Name, &tr.Description)
+		if err != nil {
+			return guideTranslations{}, err
+		}
+		if t.Pois[poiID] == nil {
+			t.Pois[poiID] = map[string]translation{}
+		}
+		t.Pois[poiID][locale] = tr
+	}
+	return t, rows.Err()
+}
+
+func (s *sqliteStore) GetAllGuideTranslations() (map[int64]guideTranslations, error) {
+	rows, err := s.db.Query(getAllGuideTranslations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	all := map[int64]guideTranslations{}
+	for rows.Next() {
+		var (
+			guideID          int64
+			language, locale string
+			tr               translation
+		)
+		err = rows.Scan(&guideID, &language, &locale, &tr.Name, &tr.Description)
+		if err != nil {
+			return nil, err
+		}
+		t, ok := all[guideID]
+		if !ok {
+			t = guideTranslations{Language: language, Guide: map[string]translation{}}
+			all[guideID] = t
+		}
+		t.Guide[locale] = tr
+	}
+	return all, rows.Err()
+}
+
+func (s *sqliteStore) SaveTranslations(guideID int64, locale string, guide *translation, pois map[int64]translation) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = deleteTranslationsTx(tx, guideID, locale)
+	if err != nil {
+		return err
+	}
+	if guide != nil {
+		_, err = tx.Exec(insertGuideTranslation, guideID, locale, guide.Name, guide.Description)
+		if err != nil {
+			return err
+		}
+	}
+	for poiID, t := range pois {
+		// pois of other guides are skipped
+		_, err = tx.Exec(insertPoiTranslation, poiID, locale, t.Name, t.Description, poiID, guideID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) DeleteTranslations(guideID int64, locale string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = deleteTranslationsTx(tx, guideID, locale)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteTranslationsTx(tx *sql.Tx, guideID int64, locale string) error {
+	_, err := tx.Exec(deleteGuideTranslation, guideID, locale)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(deletePoiTranslations, guideID, locale)
+	return err
+}
+
+const pragmaWALEnabled = `PRAGMA journal_mode = WAL;`
+
+// connectionPragmas are the DSN parameters with the busy timeout of 5s and foreign keys on.
+const connectionPragmas = `_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)`
+
+const pragmaUserVersion = `PRAGMA user_version;`
+
+const pragmaQuickCheck = `PRAGMA quick_check;`
+
+const vacuumInto = `VACUUM INTO ?`
+
+const countGuideTables = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'guide'`
+const pragmaSetUserVersion = `PRAGMA user_version = %d;`
+
+const createGuideTable = `
+CREATE TABLE IF NOT EXISTS guide(
+Id INTEGER NOT NULL PRIMARY KEY,
+name TEXT  NOT NULL,
+description TEXT,
+latitude REAL NOT NULL,
 longitude REAL NOT NULL,
 CHECK (name <> ''));`
 
@@ -360,26 +1999,327 @@ guideId INTEGER NOT NULL,
 FOREIGN KEY(guideId) REFERENCES guide(Id),
 CHECK (name <> ''));`
 
-const insertGuide = `INSERT INTO guide(name, description, latitude, longitude ) VALUES (?, ?, ?, ?);`
+const insertGuide = `INSERT INTO guide(name, slug, description, latitude, longitude, ownerId, cityId, language) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+
+const insertPoi = `INSERT INTO poi(name, slug, description, latitude, longitude, category, guideId ) VALUES (?, ?, ?, ?, ?, ?, ?);`
+
+const getGuide = `SELECT guide.name, guide.slug, guide.description, guide.latitude, guide.longitude, guide.ownerId, guide.forkedFromId, upstream.name, upstream.slug, guide.cityId, city.name, city.slug, guide.language FROM guide LEFT JOIN guide AS upstream ON upstream.Id = guide.forkedFromId LEFT JOIN city ON city.Id = guide.cityId WHERE guide.Id = ?`
+
+const forkGuide = `INSERT INTO guide(name, description, latitude, longitude, ownerId, forkedFromId, cityId, language) SELECT name, description, latitude, longitude, ?, Id, cityId, language FROM guide WHERE Id = ?;`
+
+const selectPoi = `SELECT poi.Id, poi.name, poi.slug, poi.description, poi.latitude, poi.longitude, poi.category, guide.slug FROM poi JOIN guide ON guide.Id = poi.guideId`
+
+const getPoi = selectPoi + ` WHERE poi.guideId = ? AND poi.Id = ?`
 
-const insertPoi = `INSERT INTO poi(name, description, latitude, longitude, guideId ) VALUES (?, ?, ?, ?, ?);`
+const getPoiBySlug = selectPoi + ` WHERE poi.guideId = ? AND poi.slug = ?`
 
-const getGuide = `SELECT name, description, latitude, longitude FROM guide WHERE Id = ?`
+const getPoiSlug = `SELECT slug FROM poi WHERE guideId = ? AND Id = ?`
 
-const getPoi = `SELECT name, description, latitude, longitude FROM poi WHERE guideid = ? AND Id = ?`
+const poiSlugTaken = `SELECT EXISTS(SELECT 1 FROM poi WHERE guideId = ? AND slug = ? AND Id <> ?)`
 
-const updateGuide = `UPDATE guide SET name = ?, description = ?, latitude = ?, longitude = ? WHERE Id = ?`
+const getPoisWithoutSlug = `SELECT Id, guideId, name FROM poi WHERE slug IS NULL ORDER BY Id`
 
-const updatePoi = `UPDATE poi SET name = ?, description = ?, latitude = ?, longitude = ? WHERE Id = ?`
+const setPoiSlug = `UPDATE poi SET slug = ? WHERE Id = ?`
+
+const updateGuide = `UPDATE guide SET name = ?, slug = ?, description = ?, latitude = ?, longitude = ?, cityId = ?, language = ? WHERE Id = ?`
+
+const updatePoi = `UPDATE poi SET name = ?, slug = ?, description = ?, latitude = ?, longitude = ?, category = ? WHERE Id = ?`
+
+const updateGuidePoi = `UPDATE poi SET name = ?, slug = ?, description = ?, latitude = ?, longitude = ?, category = ? WHERE Id = ? AND guideId = ?`
 
 const deleteGuide = `DELETE FROM guide WHERE Id = ?`
 
+const getGuideName = `SELECT name FROM guide WHERE Id = ?`
+
+const getGuideSlug = `SELECT slug FROM guide WHERE Id = ?`
+
+const guideSlugTaken = `SELECT EXISTS(SELECT 1 FROM guide WHERE slug = ? AND Id <> ?) OR EXISTS(SELECT 1 FROM guide_slug_redirect WHERE slug = ? AND guideId <> ?)`
+
+const getGuidesWithoutSlug = `SELECT Id, Id, name FROM guide WHERE slug IS NULL ORDER BY Id`
+
+const setGuideSlug = `UPDATE guide SET slug = ? WHERE Id = ?`
+
+// createGuideSlugRedirectTable keeps the slugs of renamed guides, their old URLs redirect to them.
+const createGuideSlugRedirectTable = `
+CREATE TABLE IF NOT EXISTS guide_slug_redirect(
+slug TEXT NOT NULL PRIMARY KEY,
+guideId INTEGER NOT NULL,
+FOREIGN KEY(guideId) REFERENCES guide(Id) ON DELETE CASCADE);`
+
+const insertGuideSlugRedirect = `INSERT INTO guide_slug_redirect(slug, guideId) VALUES (?, ?);`
+
+const deleteGuideSlugRedirect = `DELETE FROM guide_slug_redirect WHERE slug = ?`
+
+// resolveGuideSlug finds the guide by its slug, or by one of its old slugs.
+const resolveGuideSlug = `SELECT Id, slug FROM guide WHERE slug = ? UNION ALL SELECT guide.Id, guide.slug FROM guide_slug_redirect JOIN guide ON guide.Id = guide_slug_redirect.guideId WHERE guide_slug_redirect.slug = ? LIMIT 1`
+
 const deletePoi = `DELETE FROM poi WHERE guideid =? AND Id = ?`
 
-const getAllGuides = `SELECT Id,name, description, latitude, longitude FROM guide`
+const getAllGuides = `SELECT Id,name, slug, description, latitude, longitude FROM guide`
+
+const getAllPois = selectPoi + ` WHERE poi.guideId = ? ORDER BY poi.Id`
 
-const getAllPois = `SELECT Id, name, description, latitude, longitude FROM poi WHERE guideid = ?`
+const getPoisInBounds = `SELECT Id, name, description, latitude, longitude, category FROM poi WHERE guideId = ? AND latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ? ORDER BY Id`
 
-const searchGuides = `SELECT Id,name, description, latitude, longitude FROM guide WHERE name LIKE ?`
+const searchGuides = `SELECT Id,name, slug, description, latitude, longitude FROM guide WHERE name LIKE ? OR Id IN (SELECT guideId FROM guide_translation WHERE name LIKE ?)`
 
 const countGuides = `SELECT COUNT (*) FROM guide`
+
+const createItineraryTable = `
+CREATE TABLE IF NOT EXISTS itinerary(
+Id INTEGER NOT NULL PRIMARY KEY,
+name TEXT NOT NULL,
+guideId INTEGER NOT NULL,
+FOREIGN KEY(guideId) REFERENCES guide(Id) ON DELETE CASCADE,
+CHECK (name <> ''));`
+
+const createItineraryPoiTable = `
+CREATE TABLE IF NOT EXISTS itinerary_poi(
+itineraryId INTEGER NOT NULL,
+poiId INTEGER NOT NULL,
+position INTEGER NOT NULL,
+PRIMARY KEY(itineraryId, position),
+FOREIGN KEY(itineraryId) REFERENCES itinerary(Id) ON DELETE CASCADE,
+FOREIGN KEY(poiId) REFERENCES poi(Id) ON DELETE CASCADE);`
+
+const insertItinerary = `INSERT INTO itinerary(name, guideId) VALUES (?, ?);`
+
+const insertItineraryPoi = `INSERT INTO itinerary_poi(itineraryId, poiId, position) VALUES (?, ?, ?);`
+
+const getItinerary = `SELECT itinerary.name, guide.name, guide.slug FROM itinerary JOIN guide ON guide.Id = itinerary.guideId WHERE itinerary.guideId = ? AND itinerary.Id = ?`
+
+const getItineraryPois = `SELECT poi.Id, poi.name, poi.description, poi.latitude, poi.longitude FROM itinerary_poi JOIN poi ON poi.Id = itinerary_poi.poiId WHERE itinerary_poi.itineraryId = ? ORDER BY itinerary_poi.position`
+
+const updateItinerary = `UPDATE itinerary SET name = ? WHERE Id = ?`
+
+const deleteItineraryPois = `DELETE FROM itinerary_poi WHERE itineraryId = ?`
+
+const deleteItinerary = `DELETE FROM itinerary WHERE guideId = ? AND Id = ?`
+
+const getItineraryStops = `SELECT poiId, position FROM itinerary_poi WHERE itineraryId = ?`
+
+const getAllItineraries = `SELECT Id, name FROM itinerary WHERE guideId = ?`
+
+const createUserTable = `
+CREATE TABLE IF NOT EXISTS user(
+Id INTEGER NOT NULL PRIMARY KEY,
+username TEXT NOT NULL UNIQUE,
+password TEXT NOT NULL,
+email TEXT NOT NULL,
+CHECK (username <> ''));`
+
+const createSessionTable = `
+CREATE TABLE IF NOT EXISTS session(
+token TEXT NOT NULL PRIMARY KEY,
+userId INTEGER NOT NULL,
+FOREIGN KEY(userId) REFERENCES user(Id) ON DELETE CASCADE);`
+
+const createFavoriteTable = `
+CREATE TABLE IF NOT EXISTS favorite(
+userId INTEGER NOT NULL,
+guideId INTEGER NOT NULL,
+PRIMARY KEY(userId, guideId),
+FOREIGN KEY(userId) REFERENCES user(Id) ON DELETE CASCADE,
+FOREIGN KEY(guideId) REFERENCES guide(Id) ON DELETE CASCADE);`
+
+const createListTable = `
+CREATE TABLE IF NOT EXISTS list(
+Id INTEGER NOT NULL PRIMARY KEY,
+name TEXT NOT NULL,
+userId INTEGER NOT NULL,
+FOREIGN KEY(userId) REFERENCES user(Id) ON DELETE CASCADE,
+CHECK (name <> ''));`
+
+const createListPoiTable = `
+CREATE TABLE IF NOT EXISTS list_poi(
+listId INTEGER NOT NULL,
+poiId INTEGER NOT NULL,
+PRIMARY KEY(listId, poiId),
+FOREIGN KEY(listId) REFERENCES list(Id) ON DELETE CASCADE,
+FOREIGN KEY(poiId) REFERENCES poi(Id) ON DELETE CASCADE);`
+
+const insertUser = `INSERT INTO user(username, password, email) VALUES (?, ?, ?);`
+
+const getUserByUsername = `SELECT Id, password, email, admin FROM user WHERE username = ?`
+
+const insertSession = `INSERT INTO session(token, userId) VALUES (?, ?);`
+
+const getSessionUser = `SELECT user.Id, user.username, user.password, user.email, user.admin FROM session JOIN user ON user.Id = session.userId WHERE session.token = ?`
+
+const deleteSession = `DELETE FROM session WHERE token = ?`
+
+const setUserAdmin = `UPDATE user SET admin = ? WHERE username = ?`
+
+const insertFavorite = `INSERT INTO favorite(userId, guideId) VALUES (?, ?);`
+
+const deleteFavorite = `DELETE FROM favorite WHERE userId = ? AND guideId = ?`
+
+const getFavorite = `SELECT COALESCE(SUM(userId = ?), 0) > 0, COUNT(*) FROM favorite WHERE guideId = ?`
+
+const getFavoriteGuides = `SELECT guide.Id, guide.name, guide.slug, guide.description, guide.latitude, guide.longitude FROM favorite JOIN guide ON guide.Id = favorite.guideId WHERE favorite.userId = ?`
+
+const insertList = `INSERT INTO list(name, userId) VALUES (?, ?);`
+
+const deleteList = `DELETE FROM list WHERE userId = ? AND Id = ?`
+
+const getAllLists = `SELECT list.Id, list.name, poi.Id, COALESCE(poi.guideId, 0), COALESCE(poi.name, ''), COALESCE(poi.slug, ''), COALESCE(poi.description, ''), COALESCE(poi.latitude, 0), COALESCE(poi.longitude, 0), COALESCE(guide.slug, '') FROM list LEFT JOIN list_poi ON list_poi.listId = list.Id LEFT JOIN poi ON poi.Id = list_poi.poiId LEFT JOIN guide ON guide.Id = poi.guideId WHERE list.userId = ? ORDER BY list.Id`
+
+const listBelongsToUser = `SELECT COUNT(*) > 0 FROM list WHERE userId = ? AND Id = ?`
+
+const insertListPoi = `INSERT INTO list_poi(listId, poiId) VALUES (?, ?);`
+
+const deleteListPoi = `DELETE FROM list_poi WHERE listId = ? AND poiId = ?`
+
+// sqliteTimestamp is the layout of CURRENT_TIMESTAMP.
+const sqliteTimestamp = "2006-01-02 15:04:05"
+
+const createCommentTable = `
+CREATE TABLE IF NOT EXISTS comment(
+Id INTEGER NOT NULL PRIMARY KEY,
+guideId INTEGER NOT NULL,
+userId INTEGER NOT NULL,
+parentId INTEGER,
+body TEXT NOT NULL,
+hidden INTEGER NOT NULL DEFAULT 0,
+deleted INTEGER NOT NULL DEFAULT 0,
+createdAt TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+FOREIGN KEY(guideId) REFERENCES guide(Id) ON DELETE CASCADE,
+FOREIGN KEY(userId) REFERENCES user(Id) ON DELETE CASCADE,
+FOREIGN KEY(parentId) REFERENCES comment(Id) ON DELETE CASCADE);`
+
+const insertComment = `INSERT INTO comment(guideId, userId, parentId, body) VALUES (?, ?, ?, ?);`
+
+const selectComment = `SELECT comment.Id, comment.guideId, comment.userId, user.username, comment.parentId, comment.body, comment.hidden, comment.deleted, comment.createdAt FROM comment JOIN user ON user.Id = comment.userId`
+
+const getComment = selectComment + ` WHERE comment.guideId = ? AND comment.Id = ?`
+
+const getAllComments = selectComment + ` WHERE comment.guideId = ? ORDER BY comment.Id`
+
+const updateComment = `UPDATE comment SET body = ?, hidden = ? WHERE guideId = ? AND Id = ?`
+
+const countCommentReplies = `SELECT COUNT(*) FROM comment WHERE parentId = ?`
+
+const markCommentDeleted = `UPDATE comment SET body = '', deleted = 1 WHERE guideId = ? AND Id = ?`
+
+const deleteComment = `DELETE FROM comment WHERE guideId = ? AND Id = ?`
+
+const createCityTable = `
+CREATE TABLE IF NOT EXISTS city(
+Id INTEGER NOT NULL PRIMARY KEY,
+name TEXT NOT NULL,
+country TEXT NOT NULL,
+timezone TEXT NOT NULL,
+slug TEXT NOT NULL UNIQUE,
+latitude REAL NOT NULL,
+longitude REAL NOT NULL,
+south REAL NOT NULL,
+west REAL NOT NULL,
+north REAL NOT NULL,
+east REAL NOT NULL,
+CHECK (name <> '' AND slug <> ''));`
+
+const insertCity = `INSERT INTO city(name, country, timezone, slug, latitude, longitude, south, west, north, east) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+const selectCity = `SELECT Id, name, country, timezone, slug, latitude, longitude, south, west, north, east FROM city`
+
+const getCityBySlug = selectCity + ` WHERE slug = ?`
+
+const getCitiesContaining = selectCity + ` WHERE ? BETWEEN south AND north AND ? BETWEEN west AND east`
+
+const getAllCities = `SELECT city.Id, city.name, city.country, city.timezone, city.slug, city.latitude, city.longitude, city.south, city.west, city.north, city.east, COUNT(guide.Id) FROM city LEFT JOIN guide ON guide.cityId = city.Id GROUP BY city.Id ORDER BY city.name`
+
+const getCityGuides = `SELECT Id, name, slug, COALESCE(description, ''), latitude, longitude FROM guide WHERE cityId = ? ORDER BY name`
+
+const dumpUsers = `SELECT Id, username, password, email, admin FROM user ORDER BY Id`
+
+const dumpCities = `SELECT Id, name, country, timezone, slug, latitude, longitude, south, west, north, east FROM city ORDER BY Id`
+
+const dumpGuides = `SELECT Id, name, COALESCE(slug, ''), COALESCE(description, ''), latitude, longitude, ownerId, forkedFromId, cityId, language FROM guide ORDER BY Id`
+
+const dumpPois = `SELECT Id, guideId, name, COALESCE(slug, ''), COALESCE(description, ''), latitude, longitude, category FROM poi ORDER BY Id`
+
+const dumpItineraries = `SELECT Id, guideId, name FROM itinerary ORDER BY Id`
+
+const dumpItineraryPois = `SELECT itineraryId, poiId FROM itinerary_poi ORDER BY itineraryId, position`
+
+const dumpFavorites = `SELECT userId, guideId FROM favorite ORDER BY userId, guideId`
+
+const dumpLists = `SELECT Id, userId, name FROM list ORDER BY Id`
+
+const dumpListPois = `SELECT listId, poiId FROM list_poi ORDER BY listId, poiId`
+
+const dumpGuideSlugRedirects = `SELECT guideId, slug FROM guide_slug_redirect ORDER BY guideId, slug`
+
+const dumpGuideTranslations = `SELECT guideId, locale, name, description FROM guide_translation ORDER BY guideId, locale`
+
+const dumpPoiTranslations = `SELECT poiId, locale, name, description FROM poi_translation ORDER BY poiId, locale`
+
+const dumpComments = `SELECT Id, guideId, userId, parentId, body, hidden, deleted, createdAt FROM comment ORDER BY Id`
+
+const loadUser = `INSERT INTO user(Id, username, password, email, admin) VALUES (?, ?, ?, ?, ?);`
+
+const loadCity = `INSERT INTO city(Id, name, country, timezone, slug, latitude, longitude, south, west, north, east) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+const loadGuide = `INSERT INTO guide(Id, name, slug, description, latitude, longitude, ownerId, forkedFromId, cityId, language) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+const loadPoi = `INSERT INTO poi(Id, guideId, name, slug, description, latitude, longitude, category) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+
+const loadItinerary = `INSERT INTO itinerary(Id, guideId, name) VALUES (?, ?, ?);`
+
+const loadList = `INSERT INTO list(Id, userId, name) VALUES (?, ?, ?);`
+
+const loadPoiTranslation = `INSERT INTO poi_translation(poiId, locale, name, description) VALUES (?, ?, ?, ?);`
+
+const loadComment = `INSERT INTO comment(Id, guideId, userId, parentId, body, hidden, deleted, createdAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+
+const countEntities = `SELECT
+(SELECT COUNT(*) FROM user),
+(SELECT COUNT(*) FROM city),
+(SELECT COUNT(*) FROM guide),
+(SELECT COUNT(*) FROM poi),
+(SELECT COUNT(*) FROM itinerary),
+(SELECT COUNT(*) FROM favorite),
+(SELECT COUNT(*) FROM list),
+(SELECT COUNT(*) FROM comment)`
+
+// createGuideTranslationTable and createPoiTranslationTable keep the names and descriptions of
+// guides and pois in other locales.
+const createGuideTranslationTable = `
+CREATE TABLE IF NOT EXISTS guide_translation(
+guideId INTEGER NOT NULL,
+locale TEXT NOT NULL,
+name TEXT NOT NULL,
+description TEXT NOT NULL DEFAULT '',
+PRIMARY KEY(guideId, locale),
+FOREIGN KEY(guideId) REFERENCES guide(Id) ON DELETE CASCADE,
+CHECK (name <> ''));`
+
+const createPoiTranslationTable = `
+CREATE TABLE IF NOT EXISTS poi_translation(
+poiId INTEGER NOT NULL,
+locale TEXT NOT NULL,
+name TEXT NOT NULL,
+description TEXT NOT NULL DEFAULT '',
+PRIMARY KEY(poiId, locale),
+FOREIGN KEY(poiId) REFERENCES poi(Id) ON DELETE CASCADE,
+CHECK (name <> ''));`
+
+const getGuideLanguage = `SELECT language FROM guide WHERE Id = ?`
+
+const getGuideTranslations = `SELECT locale, name, description FROM guide_translation WHERE guideId = ?`
+
+const getPoiTranslations = `SELECT poi_translation.poiId, poi_translation.locale, poi_translation.name, poi_translation.description FROM poi_translation JOIN poi ON poi.Id = poi_translation.poiId WHERE poi.guideId = ?`
+
+const getAllGuideTranslations = `SELECT guide.Id, guide.language, guide_translation.locale, guide_translation.name, guide_translation.description FROM guide_translation JOIN guide ON guide.Id = guide_translation.guideId`
+
+const insertGuideTranslation = `INSERT INTO guide_translation(guideId, locale, name, description) VALUES (?, ?, ?, ?);`
+
+const insertPoiTranslation = `INSERT INTO poi_translation(poiId, locale, name, description) SELECT ?, ?, ?, ? FROM poi WHERE Id = ? AND guideId = ?;`
+
+const deleteGuideTranslation = `DELETE FROM guide_translation WHERE guideId = ? AND locale = ?`
+
+const deletePoiTranslations = `DELETE FROM poi_translation WHERE poiId IN (SELECT Id FROM poi WHERE guideId = ?) AND locale = ?`
+
+const copyGuideTranslations = `INSERT INTO guide_translation(guideId, locale, name, description) SELECT ?, locale, name, description FROM guide_translation WHERE guideId = ?;`
+
+const copyPoiTranslations = `INSERT INTO poi_translation(poiId, locale, name, description) SELECT ?, locale, name, description FROM poi_translation WHERE poiId = ?;`
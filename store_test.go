@@ -2,6 +2,7 @@ package guide_test
 
 import (
 	"guide"
+	"sync"
 	"testing"
 )
 
@@ -166,6 +167,7 @@ func TestSqliteStore_PoiRoundtripCreateUpdateGetDeletePoi(t *testing.T) {
 	want := "testPOI"
 	poi.Name = want
 	poi.Description = want
+	poi.Category = want
 	err = sqliteStore.UpdatePoi(&poi)
 	if err != nil {
 		t.Fatal(err)
@@ -182,6 +184,9 @@ func TestSqliteStore_PoiRoundtripCreateUpdateGetDeletePoi(t *testing.T) {
 	if want != got.Description {
 		t.Errorf("want rountrip(create,update,get) description to be %s, got %s", want, got.Description)
 	}
+	if want != got.Category {
+		t.Errorf("want rountrip(create,update,get) category to be %s, got %s", want, got.Category)
+	}
 
 	err = sqliteStore.DeletePoi(g.Id, poi.Id)
 	if err != nil {
@@ -293,3 +298,220 @@ func TestSqliteStore_SearchNoResults(t *testing.T) {
 	}
 
 }
+
+func TestSqliteStore_ItineraryRoundtripCreateReorderGetDelete(t *testing.T) {
+	t.Parallel()
+	s := openTmpStorage(t)
+	g, err := guide.NewGuide("newGuide", guide.WithValidStringCoordinates("10", "10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CreateGuide(&g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"A", "B", "C"} {
+		poi, err := guide.NewPointOfInterest(name, g.Id, guide.PoiWithValidStringCoordinates("10", "10"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.CreatePoi(&poi)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pois := s.GetAllPois(g.Id)
+
+	i, err := guide.NewItinerary("day 1", g.Id, guide.ItineraryWithPois(pois...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CreateItinerary(&i)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i.Pois = append(pois[:0:0], pois[2], pois[0], pois[1])
+	err = s.UpdateItineraryPois(&i)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetItinerary(g.Id, i.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "CAB"
+	order := ""
+	for _, poi := range got.Pois {
+		order += poi.Name
+	}
+	if want != order {
+		t.Errorf("want itinerary order %s, got %s", want, order)
+	}
+
+	err = s.DeleteItinerary(g.Id, i.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.GetItinerary(g.Id, i.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Error("expect itinerary to be nil as a result of delete")
+	}
+}
+
+func TestSqliteStore_ToggleFavorite(t *testing.T) {
+	t.Parallel()
+	s := openTmpStorage(t)
+	g, err := guide.NewGuide("newGuide", guide.WithValidStringCoordinates("10", "10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CreateGuide(&g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.ToggleFavorite(1, g.Id)
+	if err == nil {
+		t.Error("want error on favorite of non-existing user")
+	}
+
+	f, err := s.GetFavorite(0, g.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Favorited || f.Count != 0 {
+		t.Errorf("want guide without favorites, got %+v", f)
+	}
+}
+
+func TestOpenSQLiteStorageReopensExistingStore(t *testing.T) {
+	t.Parallel()
+	tempDB := t.TempDir() + t.Name() + ".store"
+	for i := 0; i < 2; i++ {
+		_, err := guide.OpenSQLiteStorage(tempDB)
+		if err != nil {
+			t.Fatalf("want store to open %d times, got %s", i+1, err)
+		}
+	}
+}
+
+func TestSqliteStore_ForkGuideCopiesPoisAndItineraries(t *testing.T) {
+	t.Parallel()
+	s := openTmpStorage(t)
+	g, err := guide.NewGuide("Berlin", guide.WithValidStringCoordinates("52.52", "13.40"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CreateGuide(&g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"A", "B", "C"} {
+		poi, err := guide.NewPointOfInterest(name, g.Id, guide.PoiWithValidStringCoordinates("52.52", "13.40"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.CreatePoi(&poi)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pois := s.GetAllPois(g.Id)
+	i, err := guide.NewItinerary("day 1", g.Id, guide.ItineraryWithPois(pois[2], pois[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CreateItinerary(&i)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fork, err := s.ForkGuide(g.Id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.Id == g.Id || fork.Name != g.Name {
+		t.Errorf("want a new guide named %s, got %+v", g.Name, fork)
+	}
+	if fork.ForkedFromID != g.Id || fork.ForkedFromName != g.Name {
+		t.Errorf("want fork to record upstream guide %d, got %d", g.Id, fork.ForkedFromID)
+	}
+	if len(s.GetAllPois(fork.Id)) != len(pois) {
+		t.Errorf("want fork to have %d pois, got %d", len(pois), len(s.GetAllPois(fork.Id)))
+	}
+
+	itineraries := s.GetAllItineraries(fork.Id)
+	if len(itineraries) != 1 {
+		t.Fatalf("want fork to have 1 itinerary, got %d", len(itineraries))
+	}
+	forkItinerary, err := s.GetItinerary(fork.Id, itineraries[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := ""
+	for _, poi := range forkItinerary.Pois {
+		if poi.GuideID != fork.Id {
+			t.Errorf("want itinerary poi to belong to the fork, got guide %d", poi.GuideID)
+		}
+		order += poi.Name
+	}
+	if order != "CA" {
+		t.Errorf("want fork itinerary order CA, got %s", order)
+	}
+
+	missing, err := s.ForkGuide(99, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing != nil {
+		t.Error("want nil fork of non-existing guide")
+	}
+}
+
+func TestSqliteStore_ForeignKeysEnforcedOnConcurrentDeletes(t *testing.T) {
+	t.Parallel()
+	sqliteStore := openTmpStorage(t)
+	const guides = 20
+	for i := 0; i < guides; i++ {
+		g, err := guide.NewGuide("newGuide", guide.WithValidStringCoordinates("10", "10"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sqliteStore.CreateGuide(&g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		poi, err := guide.NewPointOfInterest("test", g.Id, guide.PoiWithValidStringCoordinates("10", "10"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sqliteStore.CreatePoi(&poi)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every connection of the pool has to refuse deleting guides that still have pois
+	var wg sync.WaitGroup
+	errs := make([]error, guides)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = sqliteStore.DeleteGuide(int64(i + 1))
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("want guide %d with pois not deleted", i+1)
+		}
+	}
+	if got := sqliteStore.CountGuides(); got != guides {
+		t.Errorf("want %d guides left, got %d", guides, got)
+	}
+}
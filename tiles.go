@@ -0,0 +1,417 @@
+package guide
+
+import (
+	linkedlist "container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// tileLayer is the base map of the pages, templated into the map scripts.
+type tileLayer struct {
+	URL string
+	// Attribution is HTML, Leaflet shows it in the corner of the map.
+	Attribution string
+	MaxZoom     int
+}
+
+// osmTileLayer loads the tiles from OpenStreetMap directly, fine for small sites but against the
+// OSM tile usage policy for busy ones, which should proxy them with a tile cache.
+var osmTileLayer = tileLayer{
+	URL:         "https://tile.openstreetmap.org/{z}/{x}/{y}.png",
+	Attribution: osmAttribution,
+	MaxZoom:     19,
+}
+
+const (
+	osmAttribution = `&copy; <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors`
+	// localTileURL is the tile route of the server, for tile sources.
+	localTileURL = "/tiles/{z}/{x}/{y}.png"
+	// maxTileZoom is the highest zoom the tile route accepts.
+	maxTileZoom = 22
+)
+
+var errTileNotFound = errors.New("tile not found")
+
+// tileSource serves the map tiles of the tile route.
+type tileSource interface {
+	// Tile returns the image of a tile in XYZ coordinates or errTileNotFound.
+	Tile(ctx context.Context, z, x, y int) ([]byte, error)
+	Attribution() string
+	MaxZoom() int
+}
+
+// WithTileSource serves the map tiles from source on the tile route instead of loading them from
+// OpenStreetMap.
+func WithTileSource(source tileSource) serverOption {
+	return func(s *Server) error {
+		if source == nil {
+			return errors.New("tile source cannot be nil")
+		}
+		s.tiles = source
+		s.tileLayer = tileLayer{URL: localTileURL, Attribution: source.Attribution(), MaxZoom: source.MaxZoom()}
+		return nil
+	}
+}
+
+// HandleTile serves a map tile of the tile source.
+func (s *Server) HandleTile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.tiles == nil {
+			http.Error(w, "tiles are not served", http.StatusNotFound)
+			return
+		}
+		vars := mux.Vars(r)
+		z, errZ := strconv.Atoi(vars["z"])
+		x, errX := strconv.Atoi(vars["x"])
+		y, errY := strconv.Atoi(vars["y"])
+		if errZ != nil || errX != nil || errY != nil || z > maxTileZoom || x >= 1<<z || y >= 1<<z {
+			http.Error(w, "tile Not Found", http.StatusNotFound)
+			return
+		}
+
+		tile, err := s.tiles.Tile(r.Context(), z, x, y)
+		if errors.Is(err, errTileNotFound) {
+			http.Error(w, "tile Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(s.output, err)
+			http.Error(w, "not able to load tile", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", http.DetectContentType(tile))
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Write(tile)
+	}
+}
+
+// tileSourceFromEnv is the tile source configured in the environment, nil to load the tiles from
+// OpenStreetMap: TILE_MBTILES serves an MBTiles file, TILE_UPSTREAM proxies a tile server with a
+// cache of TILE_CACHE_MB megabytes in TILE_CACHE_PATH, the tiles directory next to the database by
+// default. TILE_ATTRIBUTION is the attribution of the upstream.
+func tileSourceFromEnv(dataDir string) (tileSource, error) {
+	if path := os.Getenv("TILE_MBTILES"); path != "" {
+		return OpenMBTiles(path)
+	}
+	upstream := os.Getenv("TILE_UPSTREAM")
+	if upstream == "" {
+		return nil, nil
+	}
+	cacheDir := os.Getenv("TILE_CACHE_PATH")
+	if cacheDir == "" {
+		cacheDir = filepath.Join(dataDir, "tiles")
+	}
+	cacheMB := int64(512)
+	if size := os.Getenv("TILE_CACHE_MB"); size != "" {
+		var err error
+		cacheMB, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("TILE_CACHE_MB has to be a number: %w", err)
+		}
+	}
+	return NewTileProxy(upstream, os.Getenv("TILE_ATTRIBUTION"), cacheDir, cacheMB<<20)
+}
+
+// tileProxy loads tiles from an upstream tile server, keeping them in an on-disk cache.
+type tileProxy struct {
+	upstream    string
+	attribution string
+	client      *http.Client
+	cache       *tileCache
+}
+
+// tileUserAgent identifies the proxy to tile servers, as the OSM tile usage policy requires.
+const tileUserAgent = "CityGuide/1.0 (+https://github.com/crmejia/CityGuide)"
+
+// NewTileProxy proxies the tile server upstream, a URL with {z}, {x} and {y} placeholders. Tiles
+// are cached in cacheDir up to cacheSize bytes, dropping the least recently used ones.
+func NewTileProxy(upstream, attribution, cacheDir string, cacheSize int64) (*tileProxy, error) {
+	for _, placeholder := range []string{"{z}", "{x}", "{y}"} {
+		if !strings.Contains(upstream, placeholder) {
+			return nil, fmt.Errorf("tile upstream has to have the %s placeholder", placeholder)
+		}
+	}
+	cache, err := newTileCache(cacheDir, cacheSize)
+	if err != nil {
+		return nil, err
+	}
+	if attribution == "" {
+		attribution = osmAttribution
+	}
+	return &tileProxy{
+		upstream:    upstream,
+		attribution: attribution,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		cache:       cache,
+	}, nil
+}
+
+func (p *tileProxy) Tile(ctx context.Context, z, x, y int) ([]byte, error) {
+	key := fmt.Sprintf("%d/%d/%d.png", z, x, y)
+	if tile, ok := p.cache.get(key); ok {
+		return tile, nil
+	}
+
+	url := strings.NewReplacer("{z}", strconv.Itoa(z), "{x}", strconv.Itoa(x), "{y}", strconv.Itoa(y)).Replace(p.upstream)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", tileUserAgent)
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errTileNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tile upstream %s: %s", url, res.Status)
+	}
+	tile, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = p.cache.put(key, tile)
+	if err != nil {
+		return nil, err
+	}
+	return tile, nil
+}
+
+func (p *tileProxy) Attribution() string {
+	return p.attribution
+}
+
+func (p *tileProxy) MaxZoom() int {
+	return 19
+}
+
+// tileCache is a least recently used cache of tiles on disk. Reading a tile touches its file, so the
+// order is kept across restarts.
+type tileCache struct {
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	order   *linkedlist.List // of *tileCacheEntry, the most recently used first
+	entries map[string]*linkedlist.Element
+}
+
+type tileCacheEntry struct {
+	key  string
+	size int64
+}
+
+func newTileCache(dir string, maxSize int64) (*tileCache, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("tile cache size has to be positive")
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	c := &tileCache{dir: dir, maxSize: maxSize, order: linkedlist.New(), entries: map[string]*linkedlist.Element{}}
+
+	type cachedTile struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	tiles := make([]cachedTile, 0)
+	err = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		tiles = append(tiles, cachedTile{key: filepath.ToSlash(key), size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tiles, func(i, j int) bool { return tiles[i].modTime.Before(tiles[j].modTime) })
+	for _, t := range tiles {
+		c.entries[t.key] = c.order.PushFront(&tileCacheEntry{key: t.key, size: t.size})
+		c.size += t.size
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c, c.evict()
+}
+
+func (c *tileCache) filename(key string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(key))
+}
+
+func (c *tileCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		c.order.MoveToFront(e)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	tile, err := os.ReadFile(c.filename(key))
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(c.filename(key), now, now)
+	return tile, true
+}
+
+func (c *tileCache) put(key string, tile []byte) error {
+	filename := c.filename(key)
+	err := os.MkdirAll(filepath.Dir(filename), 0o755)
+	if err != nil {
+		return err
+	}
+	// written aside and renamed so readers never see half a tile, each writer to its own file as
+	// concurrent misses of a tile all put it
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(tile)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), 0o644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), filename)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.size -= e.Value.(*tileCacheEntry).size
+		c.order.Remove(e)
+	}
+	c.entries[key] = c.order.PushFront(&tileCacheEntry{key: key, size: int64(len(tile))})
+	c.size += int64(len(tile))
+	return c.evict()
+}
+
+// evict removes the least recently used tiles until the cache fits its size, c.mu must be held.
+func (c *tileCache) evict() error {
+	for c.size > c.maxSize && c.order.Len() > 0 {
+		e := c.order.Back()
+		entry := e.Value.(*tileCacheEntry)
+		err := os.Remove(c.filename(entry.key))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		c.order.Remove(e)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+	}
+	return nil
+}
+
+// mbtiles serves the tiles of an MBTiles file, a SQLite database of tiles, to serve maps offline.
+type mbtiles struct {
+	db          *sql.DB
+	attribution string
+	maxZoom     int
+}
+
+// OpenMBTiles opens the raster MBTiles file at path. Its attribution and max zoom are read from its
+// metadata.
+func OpenMBTiles(path string) (*mbtiles, error) {
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	m := &mbtiles{db: db, attribution: osmAttribution, maxZoom: 19}
+	rows, err := db.Query(getMBTilesMetadata)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s is not an MBTiles file: %w", path, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		err = rows.Scan(&name, &value)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		switch name {
+		case "attribution":
+			m.attribution = value
+		case "maxzoom":
+			m.maxZoom, err = strconv.Atoi(value)
+			if err != nil {
+				db.Close()
+				return nil, fmt.Errorf("MBTiles maxzoom has to be a number: %w", err)
+			}
+		case "format":
+			if value == "pbf" {
+				db.Close()
+				return nil, errors.New("MBTiles has vector tiles, raster tiles are needed")
+			}
+		}
+	}
+	return m, rows.Err()
+}
+
+func (m *mbtiles) Tile(ctx context.Context, z, x, y int) ([]byte, error) {
+	var tile []byte
+	// MBTiles rows count from the bottom, TMS style
+	err := m.db.QueryRowContext(ctx, getMBTile, z, x, (1<<z)-1-y).Scan(&tile)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errTileNotFound
+	}
+	return tile, err
+}
+
+func (m *mbtiles) Attribution() string {
+	return m.attribution
+}
+
+func (m *mbtiles) MaxZoom() int {
+	return m.maxZoom
+}
+
+const getMBTilesMetadata = `SELECT name, value FROM metadata`
+
+const getMBTile = `SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`
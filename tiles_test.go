@@ -0,0 +1,282 @@
+package guide_test
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"guide"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// pngTile is enough of a PNG for the content type to be detected.
+var pngTile = []byte("\x89PNG\r\n\x1a\n tile")
+
+func newTileUpstream(t *testing.T, hits *int64) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(hits, 1)
+		if !strings.HasPrefix(r.UserAgent(), "CityGuide/") {
+			http.Error(w, "identify yourself", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/9/0/0.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(append(pngTile, r.URL.Path...))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func getTile(t *testing.T, server *guide.Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTileProxyCachesUpstreamTiles(t *testing.T) {
+	t.Parallel()
+	var hits int64
+	upstream := newTileUpstream(t, &hits)
+	proxy, err := guide.NewTileProxy(upstream.URL+"/{z}/{x}/{y}.png", "", t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := guide.NewServer(":8080", openTmpStorage(t), io.Discard, guide.WithTileSource(proxy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rr := getTile(t, &server, "/tiles/3/2/1.png")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("want status %d, got %d", http.StatusOK, rr.Code)
+		}
+		if !strings.HasSuffix(rr.Body.String(), "/3/2/1.png") {
+			t.Errorf("want tile 3/2/1 from upstream, got %q", rr.Body.String())
+		}
+		if rr.Header().Get("Content-Type") != "image/png" {
+			t.Errorf("want content type image/png, got %q", rr.Header().Get("Content-Type"))
+		}
+	}
+	if hits != 1 {
+		t.Errorf("want tile requested upstream once, got %d", hits)
+	}
+
+	testCases := map[string]int{
+		"/tiles/9/0/0.png":  http.StatusNotFound,
+		"/tiles/2/4/0.png":  http.StatusNotFound,
+		"/tiles/30/0/0.png": http.StatusNotFound,
+	}
+	for path, want := range testCases {
+		rr := getTile(t, &server, path)
+		if rr.Code != want {
+			t.Errorf("%s: want status %d, got %d", path, want, rr.Code)
+		}
+	}
+}
+
+func TestTileProxyServesConcurrentMissesOfATile(t *testing.T) {
+	t.Parallel()
+	const misses = 20
+	// upstream answers once all the misses reached it, so they put the tile at the same time
+	var hits int64
+	allMissed := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&hits, 1) == misses {
+			close(allMissed)
+		}
+		<-allMissed
+		w.Write(append(pngTile, bytes.Repeat([]byte{0}, 1<<16)...))
+	}))
+	t.Cleanup(upstream.Close)
+	cacheDir := t.TempDir()
+	proxy, err := guide.NewTileProxy(upstream.URL+"/{z}/{x}/{y}.png", "", cacheDir, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := guide.NewServer(":8080", openTmpStorage(t), io.Discard, guide.WithTileSource(proxy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	codes := make([]int, misses)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = getTile(t, &server, "/tiles/5/3/7.png").Code
+		}(i)
+	}
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d: want status %d, got %d", i, http.StatusOK, code)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(cacheDir, "5", "3", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("want only the tile left in the cache, got %v", files)
+	}
+}
+
+func TestTileProxyEvictsLeastRecentlyUsedTiles(t *testing.T) {
+	t.Parallel()
+	var hits int64
+	upstream := newTileUpstream(t, &hits)
+	cacheDir := t.TempDir()
+	tileSize := int64(len(pngTile) + len("/1/0/0.png"))
+	proxy, err := guide.NewTileProxy(upstream.URL+"/{z}/{x}/{y}.png", "", cacheDir, 2*tileSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := guide.NewServer(":8080", openTmpStorage(t), io.Discard, guide.WithTileSource(proxy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/tiles/1/0/0.png", "/tiles/1/0/1.png", "/tiles/1/0/0.png", "/tiles/1/1/0.png"} {
+		rr := getTile(t, &server, path)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: want status %d, got %d", path, http.StatusOK, rr.Code)
+		}
+	}
+	if hits != 3 {
+		t.Errorf("want 3 tiles requested upstream, got %d", hits)
+	}
+	for tile, want := range map[string]bool{"1/0/0.png": true, "1/0/1.png": false, "1/1/0.png": true} {
+		_, err := os.Stat(filepath.Join(cacheDir, filepath.FromSlash(tile)))
+		if got := err == nil; got != want {
+			t.Errorf("%s: want cached %t, got %t", tile, want, got)
+		}
+	}
+
+	// a new proxy picks up the cache on disk
+	reopened, err := guide.NewTileProxy(upstream.URL+"/{z}/{x}/{y}.png", "", cacheDir, 2*tileSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = guide.NewServer(":8080", openTmpStorage(t), io.Discard, guide.WithTileSource(reopened))
+	if err != nil {
+		t.Fatal(err)
+	}
+	getTile(t, &server, "/tiles/1/1/0.png")
+	if hits != 3 {
+		t.Errorf("want cached tile served after reopening, got %d upstream requests", hits)
+	}
+}
+
+func TestNewTileProxyRejectsUpstreamWithoutPlaceholders(t *testing.T) {
+	t.Parallel()
+	_, err := guide.NewTileProxy("https://tiles.example.com/{z}/{x}.png", "", t.TempDir(), 1<<20)
+	if err == nil {
+		t.Error("want error for upstream without {y}")
+	}
+}
+
+// newMBTiles writes an MBTiles file with tile 1/0/0 in XYZ coordinates.
+func newMBTiles(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "city.mbtiles")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE metadata (name TEXT, value TEXT)`,
+		`CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB)`,
+		`INSERT INTO metadata VALUES ('format', 'png'), ('maxzoom', '14'), ('attribution', 'Offline tiles')`,
+	} {
+		_, err = db.Exec(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// row 1 of zoom 1 is the top row in TMS
+	_, err = db.Exec(`INSERT INTO tiles VALUES (1, 0, 1, ?)`, pngTile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMBTilesServesTilesAndAttribution(t *testing.T) {
+	t.Parallel()
+	tiles, err := guide.OpenMBTiles(newMBTiles(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := guide.NewServer(":8080", openTmpStorage(t), io.Discard, guide.WithTileSource(tiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := getTile(t, &server, "/tiles/1/0/0.png")
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), pngTile) {
+		t.Errorf("want tile 1/0/0, got status %d %q", rr.Code, rr.Body.String())
+	}
+	rr = getTile(t, &server, "/tiles/1/0/1.png")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("want missing tile not found, got status %d", rr.Code)
+	}
+
+	_, err = guide.OpenMBTiles(filepath.Join(t.TempDir(), "missing.mbtiles"))
+	if err == nil {
+		t.Error("want error opening a missing MBTiles file")
+	}
+}
+
+func TestMapScriptUsesConfiguredTileLayer(t *testing.T) {
+	t.Parallel()
+	tiles, err := guide.OpenMBTiles(newMBTiles(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := openTmpStorage(t)
+	newProvisionedServerWithStore(storage, t)
+	configured, err := guide.NewServer(":8080", storage, io.Discard, guide.WithTileSource(tiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		server          *guide.Server
+		url             string
+		attribution     string
+		maxZoom         int
+		tileRouteStatus int
+	}{
+		"default":     {newProvisionedServer(t), `https://tile.openstreetmap.org/{z}/{x}/{y}.png`, "OpenStreetMap", 19, http.StatusNotFound},
+		"tile source": {&configured, `/tiles/{z}/{x}/{y}.png`, "Offline tiles", 14, http.StatusOK},
+	}
+	for name, tc := range testCases {
+		for _, path := range []string{"/guide/1", "/guide/1/itinerary/1"} {
+			rr := getTile(t, tc.server, path)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%s %s: want status %d, got %d", name, path, http.StatusOK, rr.Code)
+			}
+			body := rr.Body.String()
+			for _, want := range []string{tc.url, tc.attribution, fmt.Sprintf("maxZoom:  %d ", tc.maxZoom)} {
+				if !strings.Contains(body, want) {
+					t.Errorf("%s %s: want map script with %q", name, path, want)
+				}
+			}
+		}
+		rr := getTile(t, tc.server, "/tiles/1/0/0.png")
+		if rr.Code != tc.tileRouteStatus {
+			t.Errorf("%s: want tile route status %d, got %d", name, tc.tileRouteStatus, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package guide
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// translation is the name and description of a guide or poi in another locale.
+type translation struct {
+	Name, Description string
+}
+
+// guideTranslations are the translations of a guide and of its pois, by locale and by poi ID.
+// Language is the locale of the original guide, empty if it isn't known.
+type guideTranslations struct {
+	Language string
+	Guide    map[string]translation
+	Pois     map[int64]map[string]translation
+}
+
+// Locales are the locales the guide or any of its pois are translated to, sorted.
+func (t guideTranslations) Locales() []string {
+	seen := map[string]bool{}
+	for locale := range t.Guide {
+		seen[locale] = true
+	}
+	for _, pois := range t.Pois {
+		for locale := range pois {
+			seen[locale] = true
+		}
+	}
+	locales := make([]string, 0, len(seen))
+	for locale := range seen {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// match is the locale to show of those preferred, empty for the original language, which is also
+// the fallback when no translation matches.
+func (t guideTranslations) match(preferred []string) string {
+	available := t.Locales()
+	if t.Language != "" {
+		// the original comes first, so a preference for its language doesn't pick a regional translation
+		available = append([]string{t.Language}, available...)
+	}
+	locale := matchLocale(preferred, available)
+	if locale == t.Language {
+		return ""
+	}
+	return locale
+}
+
+// localize shows the guide and its pois in locale, those without a translation stay in the original
+// language.
+func (t guideTranslations) localize(g *guide, locale string) {
+	g.Language = t.Language
+	g.Locales = t.Locales()
+	g.Locale = locale
+	if tr, ok := t.Guide[locale]; ok {
+		g.Name, g.Description = tr.Name, tr.Description
+	}
+	for i := range g.Pois {
+		t.localizePoi(&g.Pois[i], locale)
+	}
+}
+
+func (t guideTranslations) localizePoi(p *pointOfInterest, locale string) {
+	if tr, ok := t.Pois[p.Id][locale]; ok {
+		p.Name, p.Description = tr.Name, tr.Description
+	}
+}
+
+// ContentLocale is the locale the guide is shown in, empty if it isn't known.
+func (g guide) ContentLocale() string {
+	if g.Locale != "" {
+		return g.Locale
+	}
+	return g.Language
+}
+
+// setContentLanguage tells caches that the response depends on the languages the request accepts,
+// and which one it is in, if known.
+func setContentLanguage(w http.ResponseWriter, locale string) {
+	addVary(w, "Accept-Language")
+	if locale != "" {
+		w.Header().Set("Content-Language", locale)
+	}
+}
+
+var rxLocale = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// parseLocale normalizes a language tag, like pt-BR, to the lower case locale the store keeps,
+// pt-br.
+func parseLocale(tag string) (string, error) {
+	locale := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if !rxLocale.MatchString(locale) {
+		return "", newValidationError("locale", errLocaleInvalid)
+	}
+	return locale, nil
+}
+
+// langParam is the query parameter that picks the locale of a page, e.g. /g/lisbon?lang=pt.
+const langParam = "lang"
+
+// preferredLocales are the locales the request asks for, best first: the lang query parameter, the
+// one of the page that made the htmx request, then the Accept-Language header by quality.
+func preferredLocales(r *http.Request) []string {
+	var preferred []string
+	add := func(tag string) {
+		if locale, err := parseLocale(tag); err == nil {
+			preferred = append(preferred, locale)
+		}
+	}
+	add(r.URL.Query().Get(langParam))
+	if current, err := url.Parse(r.Header.Get("HX-Current-URL")); err == nil {
+		add(current.Query().Get(langParam))
+	}
+
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if tag == "" || tag == "*" || quality <= 0 {
+			continue
+		}
+		accepted = append(accepted, weighted{tag: tag, quality: quality})
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].quality > accepted[j].quality })
+	for _, a := range accepted {
+		add(a.tag)
+	}
+	return preferred
+}
+
+// matchLocale is the first available locale that matches a preferred one: the same locale, or the
+// same language when no locale of the preferred one's region is available, e.g. es for es-mx.
+func matchLocale(preferred, available []string) string {
+	for _, p := range preferred {
+		for _, a := range available {
+			if a == p {
+				return a
+			}
+		}
+		language, _, _ := strings.Cut(p, "-")
+		for _, a := range available {
+			if l, _, _ := strings.Cut(a, "-"); l == language {
+				return a
+			}
+		}
+	}
+	return ""
+}
+
+// alternate is a link to the page in another language, for search engines.
+type alternate struct {
+	Hreflang, URL string
+}
+
+// Alternates link the guide page to itself in each of its languages, the original being the default.
+func (p guidePage) Alternates() []alternate {
+	if len(p.Locales) == 0 {
+		return nil
+	}
+	permalink := guidePermalink(p.Slug, "")
+	alternates := []alternate{{Hreflang: "x-default", URL: permalink}}
+	if p.Language != "" {
+		alternates = append(alternates, alternate{Hreflang: p.Language, URL: localeURL(permalink, p.Language)})
+	}
+	for _, locale := range p.Locales {
+		if locale != p.Language {
+			alternates = append(alternates, alternate{Hreflang: locale, URL: localeURL(permalink, locale)})
+		}
+	}
+	return alternates
+}
+
+// alternates are the alternates of the page data, if it has any.
+func alternates(data any) []alternate {
+	if page, ok := data.(interface{ Alternates() []alternate }); ok {
+		return page.Alternates()
+	}
+	return nil
+}
+
+func localeURL(path, locale string) string {
+	return path + "?" + url.Values{langParam: {locale}}.Encode()
+}
+
+// translationForm edits the translations of a guide and its pois to a locale. The fields of the
+// pois are named poi-{id}-name and poi-{id}-description.
+type translationForm struct {
+	GuideID   int64
+	GuideSlug string
+	Language  string
+	// Locales are the locales the guide is translated to, Locale the one edited.
+	Locales []string
+	Locale  string
+	Guide   translationField
+	Pois    []translationField
+	Errors  []string
+}
+
+// translationField is the translation of a guide or poi next to its original.
+type translationField struct {
+	PoiID    int64
+	Original translation
+	translation
+}
+
+// NamePrefix is the prefix of the names of the inputs of the field.
+func (f translationField) NamePrefix() string {
+	if f.PoiID == 0 {
+		return ""
+	}
+	return "poi-" + strconv.FormatInt(f.PoiID, 10) + "-"
+}
+
+// newTranslationForm is the form of the guide translations to locale, filled with the saved ones.
+func newTranslationForm(g guide, t guideTranslations, locale string) translationForm {
+	f := translationForm{
+		GuideID:   g.Id,
+		GuideSlug: g.Slug,
+		Language:  t.Language,
+		Locales:   t.Locales(),
+		Locale:    locale,
+		Guide:     translationField{Original: translation{Name: g.Name, Description: g.Description}, translation: t.Guide[locale]},
+		Pois:      make([]translationField, 0, len(g.Pois)),
+		Errors:    []string{},
+	}
+	for _, p := range g.Pois {
+		f.Pois = append(f.Pois, translationField{
+			PoiID:       p.Id,
+			Original:    translation{Name: p.Name, Description: p.Description},
+			translation: t.Pois[p.Id][locale],
+		})
+	}
+	return f
+}
+
+// read fills the translations from the posted form values.
+func (f *translationForm) read(r *http.Request) {
+	f.Guide.Name, f.Guide.Description = strings.TrimSpace(r.PostFormValue("name")), r.PostFormValue("description")
+	for i := range f.Pois {
+		prefix := f.Pois[i].NamePrefix()
+		f.Pois[i].Name, f.Pois[i].Description = strings.TrimSpace(r.PostFormValue(prefix+"name")), r.PostFormValue(prefix+"description")
+	}
+}
+
+// translations are the translations of the form. A guide or poi without a translated name isn't
+// translated, it needs one to translate its description.
+func (f translationForm) translations() (guide *translation, pois map[int64]translation, err error) {
+	pois = map[int64]translation{}
+	if f.Guide.Name != "" {
+		guide = &f.Guide.translation
+	} else if strings.TrimSpace(f.Guide.Description) != "" {
+		return nil, nil, errors.New("guide name cannot be empty to translate its description")
+	}
+	for _, p := range f.Pois {
+		if p.Name != "" {
+			pois[p.PoiID] = p.translation
+		} else if strings.TrimSpace(p.Description) != "" {
+			return nil, nil, errors.New("name of " + p.Original.Name + " cannot be empty to translate its description")
+		}
+	}
+	if guide == nil && len(pois) == 0 {
+		return nil, nil, errors.New("translation cannot be empty")
+	}
+	return guide, pois, nil
+}
+
+// HandleTranslationsGet lists the locales a guide is translated to, and edits the translations to
+// the locale query parameter if given.
+func (s *Server) HandleTranslationsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, translations, ok := s.guideWithTranslations(w, r)
+		if !ok {
+			return
+		}
+		form := newTranslationForm(*g, translations, "")
+		if tag := r.URL.Query().Get("locale"); tag != "" {
+			locale, err := parseLocale(tag)
+			if err != nil {
+				form.Errors = append(form.Errors, localizeError(r, err))
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				form = newTranslationForm(*g, translations, locale)
+			}
+		}
+		err := s.templates(w, r).renderPage(w, translationsTemplate, form)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// HandleTranslationsPost saves the translations of a guide and its pois to a locale and shows the
+// guide in it.
+func (s *Server) HandleTranslationsPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, translations, ok := s.guideWithTranslations(w, r)
+		if !ok {
+			return
+		}
+		locale, err := parseLocale(r.PostFormValue("locale"))
+		form := newTranslationForm(*g, translations, locale)
+		form.read(r)
+		if err == nil && locale == translations.Language {
+			err = errors.New("the guide is written in " + locale + ", translate it to another locale")
+		}
+		var (
+			guideTranslation *translation
+			poiTranslations  map[int64]translation
+		)
+		if err == nil {
+			guideTranslation, poiTranslations, err = form.translations()
+		}
+		if err != nil {
+			form.Locale = r.PostFormValue("locale")
+			form.Errors = append(form.Errors, localizeError(r, err))
+			w.WriteHeader(http.StatusBadRequest)
+			err := s.templates(w, r).renderPage(w, translationsTemplate, form)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		err = s.store.SaveTranslations(g.Id, locale, guideTranslation, poiTranslations)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, localeURL(guidePermalink(g.Slug, ""), locale), http.StatusSeeOther)
+	}
+}
+
+// HandleDeleteTranslations removes the translations of a guide and its pois to a locale.
+func (s *Server) HandleDeleteTranslations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		locale, err := parseLocale(mux.Vars(r)["locale"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = s.store.DeleteTranslations(id, locale)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// guideWithTranslations gets the guide of the request with its pois in the original language, and
+// their translations. It writes the error response when not ok.
+func (s *Server) guideWithTranslations(w http.ResponseWriter, r *http.Request) (*guide, guideTranslations, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+		return nil, guideTranslations{}, false
+	}
+	g, err := s.store.GetGuidebyID(id)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return nil, guideTranslations{}, false
+	}
+	if g == nil {
+		http.Error(w, "guide Not Found", http.StatusNotFound)
+		return nil, guideTranslations{}, false
+	}
+	g.Pois = s.store.GetAllPois(id)
+	translations, err := s.store.GetTranslations(id)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return nil, guideTranslations{}, false
+	}
+	return g, translations, true
+}
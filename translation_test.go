@@ -0,0 +1,169 @@
+package guide_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGuideTranslations(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	server := newProvisionedServerWithStore(storage, t)
+	routes := server.Routes()
+	serve := func(method, target string, form url.Values, header map[string]string) (*http.Response, string) {
+		t.Helper()
+		var body io.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		req := httptest.NewRequest(method, target, body)
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		b, err := io.ReadAll(rec.Result().Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec.Result(), string(b)
+	}
+
+	form := url.Values{"name": {"test 1"}, "latitude": {"10"}, "longitude": {"10"}, "language": {"en"}}
+	res, _ := serve(http.MethodPost, "/guide/1/edit", form, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("want guide language set, got status %d", res.StatusCode)
+	}
+	form = url.Values{"locale": {"es"}, "name": {"prueba uno"}, "description": {"una *guía*"}, "poi-1-name": {"punto uno"}}
+	res, _ = serve(http.MethodPost, "/guide/1/translations", form, nil)
+	if res.StatusCode != http.StatusSeeOther || res.Header.Get("Location") != "/g/test-1?lang=es" {
+		t.Fatalf("want translation saved and redirect to it, got status %d to %s", res.StatusCode, res.Header.Get("Location"))
+	}
+
+	testCases := map[string]struct {
+		target          string
+		header          map[string]string
+		want, notWant   []string
+		contentLanguage string
+	}{
+		"lang parameter": {
+			target:          "/g/test-1?lang=es",
+			want:            []string{"<title>prueba uno</title>", "una <em>guía</em>", "punto uno", `lang="es"`},
+			contentLanguage: "es",
+		},
+		"accept language of a region": {
+			target:          "/guide/1",
+			header:          map[string]string{"Accept-Language": "es-MX,es;q=0.9,en;q=0.5"},
+			want:            []string{"prueba uno", "test 2", `<link rel="alternate" hreflang="x-default" href="/g/test-1">`, `hreflang="en" href="/g/test-1?lang=en"`, `hreflang="es" href="/g/test-1?lang=es"`},
+			contentLanguage: "es",
+		},
+		"original language preferred": {
+			target:          "/g/test-1",
+			header:          map[string]string{"Accept-Language": "en-US,es;q=0.8"},
+			want:            []string{"<title>test 1</title>"},
+			notWant:         []string{"prueba uno"},
+			contentLanguage: "en",
+		},
+		"fallback to the original": {
+			target:          "/g/test-1?lang=fr",
+			want:            []string{"<title>test 1</title>"},
+			notWant:         []string{"prueba uno"},
+			contentLanguage: "en",
+		},
+		"poi of a translated page": {
+			target:          "/guide/1/poi/1",
+			header:          map[string]string{"HX-Request": "true", "HX-Current-URL": "http://example.com/g/test-1?lang=es"},
+			want:            []string{"punto uno"},
+			contentLanguage: "es",
+		},
+		"search of translated names": {
+			target:          "/guides?q=prueba",
+			header:          map[string]string{"Accept-Language": "es"},
+			want:            []string{"prueba uno"},
+			notWant:         []string{"test 2"},
+			contentLanguage: "",
+		},
+		"untranslated guide": {
+			target:  "/guide/2",
+			header:  map[string]string{"Accept-Language": "es"},
+			notWant: []string{"hreflang"},
+		},
+	}
+	for name, tc := range testCases {
+		res, body := serve(http.MethodGet, tc.target, nil, tc.header)
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s: want status 200, got %d", name, res.StatusCode)
+		}
+		if got := res.Header.Get("Content-Language"); got != tc.contentLanguage {
+			t.Errorf("%s: want Content-Language %q, got %q", name, tc.contentLanguage, got)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: want response to contain %s", name, want)
+			}
+		}
+		for _, notWant := range tc.notWant {
+			if strings.Contains(body, notWant) {
+				t.Errorf("%s: want response not to contain %s", name, notWant)
+			}
+		}
+	}
+
+	fork, err := storage.ForkGuide(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, body := serve(http.MethodGet, "/g/"+fork.Slug+"?lang=es", nil, nil)
+	if !strings.Contains(body, "prueba uno") {
+		t.Errorf("want translations forked with the guide")
+	}
+
+	res, _ = serve(http.MethodDelete, "/guide/1/translations/es", nil, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("want translation deleted, got status %d", res.StatusCode)
+	}
+	_, body = serve(http.MethodGet, "/g/test-1?lang=es", nil, nil)
+	if strings.Contains(body, "prueba uno") || strings.Contains(body, "punto uno") {
+		t.Errorf("want deleted translation not shown")
+	}
+}
+
+func TestTranslationsPostErrors(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	routes := server.Routes()
+	testCases := map[string]struct {
+		form url.Values
+		want string
+	}{
+		"invalid locale":         {url.Values{"locale": {"spanish!"}, "name": {"prueba"}}, "locale has to be a language code"},
+		"empty translation":      {url.Values{"locale": {"es"}}, "translation cannot be empty"},
+		"description of no name": {url.Values{"locale": {"es"}, "poi-2-description": {"un punto"}}, "name of guide 1 cannot be empty"},
+	}
+	for name, tc := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/guide/1/translations", strings.NewReader(tc.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: want status 400, got %d", name, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), tc.want) {
+			t.Errorf("%s: want error %q", name, tc.want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/guide/1/translations?locale=pt-BR", nil)
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `name="poi-1-name"`) || !strings.Contains(rec.Body.String(), "Translation to pt-br") {
+		t.Errorf("want translation form of pt-br with the pois, got status %d", rec.Code)
+	}
+}
@@ -0,0 +1,201 @@
+package guide
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// errorCode identifies a validation error, so its message can be shown in the language of the user.
+// The codes are the keys of the errors in the message catalogs.
+type errorCode string
+
+const (
+	errGuideNameEmpty      errorCode = "guide_name_empty"
+	errGuideIDEmpty        errorCode = "guide_id_empty"
+	errPoiNameEmpty        errorCode = "poi_name_empty"
+	errPoiIDInvalid        errorCode = "poi_id_invalid"
+	errLatitudeEmpty       errorCode = "latitude_empty"
+	errLongitudeEmpty      errorCode = "longitude_empty"
+	errLatitudeNotNumber   errorCode = "latitude_not_number"
+	errLongitudeNotNumber  errorCode = "longitude_not_number"
+	errLatitudeOutOfRange  errorCode = "latitude_out_of_range"
+	errLongitudeOutOfRange errorCode = "longitude_out_of_range"
+	errUsernameEmpty       errorCode = "username_empty"
+	errPasswordEmpty       errorCode = "password_empty"
+	errPasswordTooShort    errorCode = "password_too_short"
+	errPasswordsDoNotMatch errorCode = "passwords_do_not_match"
+	errEmailEmpty          errorCode = "email_empty"
+	errEmailInvalid        errorCode = "email_invalid"
+	errLocaleInvalid       errorCode = "locale_invalid"
+	errRadiusInvalid       errorCode = "radius_invalid"
+	errUsernameTaken       errorCode = "username_taken"
+	errCityNameEmpty       errorCode = "city_name_empty"
+	errCityNameNoLetter    errorCode = "city_name_no_letter"
+	errCountryInvalid      errorCode = "country_invalid"
+	errTimezoneEmpty       errorCode = "timezone_empty"
+	errTimezoneInvalid     errorCode = "timezone_invalid"
+	errCityCenterEmpty     errorCode = "city_center_empty"
+	errBoundsInverted      errorCode = "bounds_inverted"
+	errCenterOutOfBounds   errorCode = "center_out_of_bounds"
+	errItineraryNameEmpty  errorCode = "itinerary_name_empty"
+	errItineraryPoiGuide   errorCode = "itinerary_poi_other_guide"
+)
+
+// errorMessages are the English messages of the validation errors, the ones of the API and logs.
+var errorMessages = map[errorCode]string{
+	errGuideNameEmpty:      "guide name cannot be empty",
+	errGuideIDEmpty:        "guide ID cannot be empty",
+	errPoiNameEmpty:        "poi name cannot be empty",
+	errPoiIDInvalid:        "poi ID has to be a positive number",
+	errLatitudeEmpty:       "latitude cannot be empty",
+	errLongitudeEmpty:      "longitude cannot be empty",
+	errLatitudeNotNumber:   "latitude has to be a number",
+	errLongitudeNotNumber:  "longitude has to be a number",
+	errLatitudeOutOfRange:  "latitude has to be in the -90°, 90° range",
+	errLongitudeOutOfRange: "longitude has to be in the -180°, 180° range",
+	errUsernameEmpty:       "username cannot be empty",
+	errPasswordEmpty:       "password cannot be empty",
+	errPasswordTooShort:    "password has to be at least 8 characters long",
+	errPasswordsDoNotMatch: "passwords do not match",
+	errEmailEmpty:          "email cannot be empty",
+	errEmailInvalid:        "email has to be a valid address",
+	errLocaleInvalid:       "locale has to be a language code, like es or pt-BR",
+	errRadiusInvalid:       "radius has to be a positive number of kilometers",
+	errUsernameTaken:       "username is already taken",
+	errCityNameEmpty:       "city name cannot be empty",
+	errCityNameNoLetter:    "city name needs a letter or digit",
+	errCountryInvalid:      "country has to be a two letter code, like MX",
+	errTimezoneEmpty:       "timezone cannot be empty",
+	errTimezoneInvalid:     "timezone has to be an IANA time zone, like America/Mexico_City",
+	errCityCenterEmpty:     "city center cannot be empty",
+	errBoundsInverted:      "bounds have to be south of north and west of east",
+	errCenterOutOfBounds:   "city center has to be within its bounds",
+	errItineraryNameEmpty:  "itinerary name cannot be empty",
+	errItineraryPoiGuide:   "itinerary pois have to belong to the itinerary guide",
+}
+
+// validationError is an input the user has to correct. Field is the name of the input, as in the
+// forms and the API, empty when the error isn't of one input. The code localizes the message.
+type validationError struct {
+	Field string
+	Code  errorCode
+}
+
+func (e *validationError) Error() string {
+	if message, ok := errorMessages[e.Code]; ok {
+		return message
+	}
+	return string(e.Code)
+}
+
+// MarshalJSON writes the error with its English message, for the 422 responses of the API.
+func (e *validationError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Field   string    `json:"field,omitempty"`
+		Code    errorCode `json:"code"`
+		Message string    `json:"message"`
+	}{e.Field, e.Code, e.Error()})
+}
+
+func newValidationError(field string, code errorCode) error {
+	return &validationError{Field: field, Code: code}
+}
+
+// validationErrors are all the errors of an input at once, in the order of its fields, so the user
+// corrects them in one go.
+type validationErrors []*validationError
+
+func (e validationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, ", ")
+}
+
+// collect adds the validation errors of err. It reports false when err is another kind of error,
+// which has to be returned instead.
+func (e *validationErrors) collect(err error) bool {
+	if err == nil {
+		return true
+	}
+	var all validationErrors
+	if errors.As(err, &all) {
+		*e = append(*e, all...)
+		return true
+	}
+	var one *validationError
+	if errors.As(err, &one) {
+		*e = append(*e, one)
+		return true
+	}
+	return false
+}
+
+// err is nil when there are no errors, so callers don't return a nil slice as a non-nil error.
+func (e validationErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Fields are the messages by field, the first one of each. Errors of no field are under "input".
+func (e validationErrors) Fields() map[string]string {
+	fields := map[string]string{}
+	for _, err := range e {
+		field := err.Field
+		if field == "" {
+			field = "input"
+		}
+		if _, ok := fields[field]; !ok {
+			fields[field] = err.Error()
+		}
+	}
+	return fields
+}
+
+// asValidationErrors are the validation errors of err, nil if it has none.
+func asValidationErrors(err error) validationErrors {
+	var errs validationErrors
+	if !errs.collect(err) {
+		return nil
+	}
+	return errs
+}
+
+// formErrors are the errors of a form in the locale of the interface: validation errors of a field
+// are shown next to its input, and the others above the form.
+type formErrors struct {
+	Errors      []string
+	FieldErrors map[string]string
+}
+
+// addError adds the messages of err in the locale of the interface for r.
+func (f *formErrors) addError(r *http.Request, err error) {
+	c := catalogs[uiLocale(r)]
+	errs := asValidationErrors(err)
+	if errs == nil {
+		f.Errors = append(f.Errors, c.translateError(err))
+		return
+	}
+	for _, err := range errs {
+		if err.Field == "" {
+			f.Errors = append(f.Errors, c.translateError(err))
+			continue
+		}
+		if f.FieldErrors == nil {
+			f.FieldErrors = map[string]string{}
+		}
+		if _, ok := f.FieldErrors[err.Field]; !ok {
+			f.FieldErrors[err.Field] = c.translateError(err)
+		}
+	}
+}
+
+// FieldError is the message of the error of field, empty if it is valid.
+func (f formErrors) FieldError(field string) string {
+	return f.FieldErrors[field]
+}
@@ -0,0 +1,147 @@
+package guide_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFormsShowAllValidationErrorsNextToTheirInputs(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	routes := server.Routes()
+	testCases := map[string]struct {
+		method, target, form string
+		want                 []string
+	}{
+		"create guide": {
+			method: http.MethodPost, target: "/guide/create", form: "name=&latitude=&longitude=notanumber",
+			want: []string{
+				`class="input is-danger" type="text" id="name"`,
+				`<p class="help is-danger">guide name cannot be empty</p>`,
+				`<p class="help is-danger">latitude cannot be empty</p>`,
+				`<p class="help is-danger">longitude has to be a number</p>`,
+			},
+		},
+		"edit guide": {
+			method: http.MethodPost, target: "/guide/1/edit", form: "name=&latitude=91&longitude=181&language=spanish!",
+			want: []string{
+				`action="/guide/1/edit"`,
+				`<p class="help is-danger">guide name cannot be empty</p>`,
+				`<p class="help is-danger">latitude has to be in the -90°, 90° range</p>`,
+				`<p class="help is-danger">longitude has to be in the -180°, 180° range</p>`,
+				`<p class="help is-danger">locale has to be a language code, like es or pt-BR</p>`,
+			},
+		},
+		"create poi": {
+			method: http.MethodPost, target: "/guide/1/poi/create", form: "name=&latitude=10&longitude=",
+			want: []string{
+				`<p class="help is-danger">poi name cannot be empty</p>`,
+				`<p class="help is-danger">longitude cannot be empty</p>`,
+			},
+		},
+		"edit poi": {
+			method: http.MethodPatch, target: "/guide/1/poi/1", form: "name=&latitude=notanumber&longitude=10",
+			want: []string{
+				`hx-patch="/guide/1/poi/1"`,
+				`value="notanumber"`,
+				`<p class="help is-danger">poi name cannot be empty</p>`,
+				`<p class="help is-danger">latitude has to be a number</p>`,
+			},
+		},
+		"create itinerary": {
+			method: http.MethodPost, target: "/guide/1/itinerary/create", form: "name=&poi=1",
+			want: []string{
+				`class="input is-danger" type="text" id="name"`,
+				`<p class="help is-danger">itinerary name cannot be empty</p>`,
+			},
+		},
+		"sign up": {
+			method: http.MethodPost, target: "/user/signup", form: "username=&password=short&confirm-password=other&email=not-an-email",
+			want: []string{
+				`<p class="help is-danger">username cannot be empty</p>`,
+				`<p class="help is-danger">password has to be at least 8 characters long</p>`,
+				`<p class="help is-danger">passwords do not match</p>`,
+				`<p class="help is-danger">email has to be a valid address</p>`,
+			},
+		},
+	}
+	for name, tc := range testCases {
+		req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: want status 400, got %d", name, rec.Code)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s: want response to contain %s", name, want)
+			}
+		}
+	}
+}
+
+func TestAPIValidationErrorsHaveAllFieldsAndCodes(t *testing.T) {
+	t.Parallel()
+	server := newProvisionedServer(t)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/guides", strings.NewReader(`{"name":"","latitude":-91}`))
+	server.HandleAPICreateGuide()(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("want status 422, got %d", rec.Code)
+	}
+	var got struct {
+		Fields map[string]string
+		Errors []struct{ Field, Code, Message string }
+	}
+	err := json.NewDecoder(rec.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"name": "guide_name_empty", "latitude": "latitude_out_of_range", "longitude": "longitude_empty"}
+	if len(got.Errors) != len(want) {
+		t.Fatalf("want %d errors, got %+v", len(want), got.Errors)
+	}
+	for _, e := range got.Errors {
+		if want[e.Field] != e.Code || got.Fields[e.Field] != e.Message {
+			t.Errorf("want error %s of %s in errors and fields, got %+v and %v", want[e.Field], e.Field, e, got.Fields)
+		}
+	}
+}
+
+func TestCityFormShowsAllValidationErrorsNextToTheirInputs(t *testing.T) {
+	t.Parallel()
+	storage := openTmpStorage(t)
+	server := newProvisionedServerWithStore(storage, t)
+	admin := newSessionCookie(t, server, "admin")
+	err := storage.SetUserAdmin("admin", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := "name=&country=MEX&timezone=Mars/Olympus&latitude=17&longitude=-96&south=abc&west=&north=18&east=200"
+	req := httptest.NewRequest(http.MethodPost, "/city/create", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept-Language", "es")
+	req.AddCookie(admin)
+	rec := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("want status 400, got %d", rec.Code)
+	}
+	for _, want := range []string{
+		`class="input is-danger" type="text" id="name"`,
+		`<p class="help is-danger">el nombre de la ciudad no puede estar vacío</p>`,
+		`<p class="help is-danger">el país tiene que ser un código de dos letras, como MX</p>`,
+		`<p class="help is-danger">la zona horaria tiene que ser una zona horaria IANA, como America/Mexico_City</p>`,
+		`class="input is-danger" type="text" id="south"`,
+		`class="input is-danger" type="text" id="west"`,
+		`<p class="help is-danger">la longitud tiene que estar entre -180° y 180°</p>`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("want response to contain %s", want)
+		}
+	}
+}
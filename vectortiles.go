@@ -0,0 +1,314 @@
+package guide
+
+import (
+	linkedlist "container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	mediaTypeMVT = "application/vnd.mapbox-vector-tile"
+	// poiTileLayer is the layer of the pois in the vector tiles.
+	poiTileLayer = "pois"
+	// poiClusterZoom is the zoom from which every poi is its own feature. Below it the pois in the
+	// same cell of poiClusterCell tile units are one cluster feature, so tiles of large guides stay
+	// small when zoomed out.
+	poiClusterZoom = 14
+	poiClusterCell = 64
+	// poiTileCacheSize is how many encoded tiles are kept in memory.
+	poiTileCacheSize = 10000
+)
+
+// HandlePoiTile serves the pois of a guide as a Mapbox Vector Tile. Tiles are cached until a poi
+// in them changes, and browsers revalidate them with their ETag.
+func (s *Server) HandlePoiTile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		guideID, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "not able to parse guide ID", http.StatusBadRequest)
+			return
+		}
+		z, errZ := strconv.Atoi(vars["z"])
+		x, errX := strconv.Atoi(vars["x"])
+		y, errY := strconv.Atoi(vars["y"])
+		if errZ != nil || errX != nil || errY != nil || z > maxTileZoom || x >= 1<<z || y >= 1<<z {
+			http.Error(w, "tile Not Found", http.StatusNotFound)
+			return
+		}
+
+		key := poiTileKey{guideID: guideID, z: z, x: x, y: y}
+		tile, ok := s.poiTiles.get(key)
+		if !ok {
+			generation := s.poiTiles.currentGeneration()
+			g, err := s.store.GetGuidebyID(guideID)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			if g == nil {
+				http.Error(w, "guide Not Found", http.StatusNotFound)
+				return
+			}
+			data, err := s.renderPoiTile(key)
+			if err != nil {
+				fmt.Fprintln(s.output, err)
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			sum := sha256.Sum256(data)
+			tile = cachedPoiTile{data: data, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+			s.poiTiles.put(key, tile, generation)
+		}
+
+		w.Header().Set("ETag", tile.etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == tile.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeMVT)
+		w.Write(tile.data)
+	}
+}
+
+// renderPoiTile encodes the pois of the tile, with those in its buffer, as a vector tile.
+func (s *Server) renderPoiTile(key poiTileKey) ([]byte, error) {
+	buffer := float64(mvtBuffer) / mvtExtent
+	nw := mercatorCoordinate(float64(key.x)-buffer, float64(key.y)-buffer, key.z)
+	se := mercatorCoordinate(float64(key.x+1)+buffer, float64(key.y+1)+buffer, key.z)
+	pois, err := s.store.GetPoisInBounds(key.guideID, se.Latitude, nw.Longitude, nw.Latitude, se.Longitude)
+	if err != nil {
+		return nil, err
+	}
+
+	type cluster struct {
+		pois   []pointOfInterest
+		sx, sy int
+	}
+	clusters := map[[2]int]*cluster{}
+	cells := make([][2]int, 0)
+	features := make([]mvtFeature, 0, len(pois))
+	for _, p := range pois {
+		wx, wy := mercatorTile(p.Coordinate, key.z)
+		px := int(math.Round((wx - float64(key.x)) * mvtExtent))
+		py := int(math.Round((wy - float64(key.y)) * mvtExtent))
+		if px < -mvtBuffer || px > mvtExtent+mvtBuffer || py < -mvtBuffer || py > mvtExtent+mvtBuffer {
+			continue
+		}
+		if key.z >= poiClusterZoom {
+			features = append(features, poiTileFeature(p, px, py))
+			continue
+		}
+		cell := [2]int{floorDiv(px, poiClusterCell), floorDiv(py, poiClusterCell)}
+		c, ok := clusters[cell]
+		if !ok {
+			c = &cluster{}
+			clusters[cell] = c
+			cells = append(cells, cell)
+		}
+		c.pois = append(c.pois, p)
+		c.sx += px
+		c.sy += py
+	}
+	for _, cell := range cells {
+		c := clusters[cell]
+		if len(c.pois) == 1 {
+			features = append(features, poiTileFeature(c.pois[0], c.sx, c.sy))
+			continue
+		}
+		features = append(features, mvtFeature{
+			X:          c.sx / len(c.pois),
+			Y:          c.sy / len(c.pois),
+			Properties: []mvtProperty{{Key: "point_count", Value: int64(len(c.pois))}},
+		})
+	}
+	return encodeMVT(poiTileLayer, features), nil
+}
+
+func poiTileFeature(p pointOfInterest, x, y int) mvtFeature {
+	properties := []mvtProperty{{Key: "name", Value: p.Name}}
+	if p.Category != "" {
+		properties = append(properties, mvtProperty{Key: "category", Value: p.Category})
+	}
+	return mvtFeature{ID: uint64(p.Id), X: x, Y: y, Properties: properties}
+}
+
+func floorDiv(a, b int) int {
+	return int(math.Floor(float64(a) / float64(b)))
+}
+
+type poiTileKey struct {
+	guideID int64
+	z, x, y int
+}
+
+type cachedPoiTile struct {
+	data []byte
+	etag string
+}
+
+// poiTileCache keeps the most recently used poi tiles in memory.
+type poiTileCache struct {
+	maxTiles int
+
+	mu      sync.Mutex
+	order   *linkedlist.List // of *poiTileCacheEntry, the most recently used first
+	entries map[poiTileKey]*linkedlist.Element
+	// generation counts the invalidations, so a tile rendered before one isn't cached after it.
+	generation uint64
+}
+
+type poiTileCacheEntry struct {
+	key  poiTileKey
+	tile cachedPoiTile
+}
+
+func newPoiTileCache(maxTiles int) *poiTileCache {
+	return &poiTileCache{maxTiles: maxTiles, order: linkedlist.New(), entries: map[poiTileKey]*linkedlist.Element{}}
+}
+
+func (c *poiTileCache) get(key poiTileKey) (cachedPoiTile, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return cachedPoiTile{}, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*poiTileCacheEntry).tile, true
+}
+
+func (c *poiTileCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put caches the tile rendered at generation, unless tiles were invalidated since.
+func (c *poiTileCache) put(key poiTileKey, tile cachedPoiTile, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+	}
+	c.entries[key] = c.order.PushFront(&poiTileCacheEntry{key: key, tile: tile})
+	for c.order.Len() > c.maxTiles {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*poiTileCacheEntry).key)
+	}
+}
+
+// invalidate drops the tiles of the guide, at every zoom, that show a poi at one of coordinates.
+// A poi is in the tiles whose buffer it is in, and moves a cluster within its cell.
+func (c *poiTileCache) invalidate(guideID int64, coordinates ...coordinate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	margin := float64(mvtBuffer+poiClusterCell) / mvtExtent
+	for _, coord := range coordinates {
+		for z := 0; z <= maxTileZoom; z++ {
+			wx, wy := mercatorTile(coord, z)
+			last := 1<<z - 1
+			for x := max(0, int(wx-margin)); x <= min(last, int(wx+margin)); x++ {
+				for y := max(0, int(wy-margin)); y <= min(last, int(wy+margin)); y++ {
+					c.remove(poiTileKey{guideID: guideID, z: z, x: x, y: y})
+				}
+			}
+		}
+	}
+}
+
+// invalidateGuide drops all the tiles of the guide.
+func (c *poiTileCache) invalidateGuide(guideID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for key := range c.entries {
+		if key.guideID == guideID {
+			c.remove(key)
+		}
+	}
+}
+
+// remove drops the tile of key, c.mu must be held.
+func (c *poiTileCache) remove(key poiTileKey) {
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// poiTileStore invalidates the cached poi tiles of the pois it changes.
+type poiTileStore struct {
+	Storage
+	tiles *poiTileCache
+}
+
+func (s poiTileStore) CreatePoi(poi *pointOfInterest) error {
+	err := s.Storage.CreatePoi(poi)
+	if err == nil {
+		s.tiles.invalidate(poi.GuideID, poi.Coordinate)
+	}
+	return err
+}
+
+func (s poiTileStore) UpsertPois(pois []pointOfInterest) error {
+	err := s.Storage.UpsertPois(pois)
+	if err == nil {
+		invalidated := map[int64]bool{}
+		for _, p := range pois {
+			if !invalidated[p.GuideID] {
+				s.tiles.invalidateGuide(p.GuideID)
+				invalidated[p.GuideID] = true
+			}
+		}
+	}
+	return err
+}
+
+func (s poiTileStore) UpdatePoi(poi *pointOfInterest) error {
+	old, err := s.Storage.GetPoi(poi.GuideID, poi.Id)
+	if err != nil {
+		return err
+	}
+	err = s.Storage.UpdatePoi(poi)
+	if err == nil {
+		s.tiles.invalidate(poi.GuideID, poi.Coordinate)
+		if old != nil {
+			s.tiles.invalidate(poi.GuideID, old.Coordinate)
+		}
+	}
+	return err
+}
+
+func (s poiTileStore) DeletePoi(guideID, poiID int64) error {
+	old, err := s.Storage.GetPoi(guideID, poiID)
+	if err != nil {
+		return err
+	}
+	err = s.Storage.DeletePoi(guideID, poiID)
+	if err == nil && old != nil {
+		s.tiles.invalidate(guideID, old.Coordinate)
+	}
+	return err
+}
+
+func (s poiTileStore) DeleteGuide(id int64) error {
+	err := s.Storage.DeleteGuide(id)
+	if err == nil {
+		s.tiles.invalidateGuide(id)
+	}
+	return err
+}
@@ -0,0 +1,288 @@
+package guide_test
+
+import (
+	"fmt"
+	"guide"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// mvtTestFeature is a decoded feature of the pois layer.
+type mvtTestFeature struct {
+	ID         uint64
+	Properties map[string]any
+}
+
+// decodePoiTile decodes the features of a vector tile, enough of protobuf for the tiles the server
+// writes.
+func decodePoiTile(t *testing.T, tile []byte) []mvtTestFeature {
+	t.Helper()
+	type rawFeature struct {
+		id   uint64
+		tags []uint64
+	}
+	var (
+		layerName string
+		keys      []string
+		values    []any
+		raw       []rawFeature
+	)
+	for _, layer := range protoFields(t, tile) {
+		if layer.field != 3 {
+			t.Fatalf("want only layers in tile, got field %d", layer.field)
+		}
+		for _, f := range protoFields(t, layer.data) {
+			switch f.field {
+			case 1:
+				layerName = string(f.data)
+			case 2:
+				var feature rawFeature
+				for _, ff := range protoFields(t, f.data) {
+					switch ff.field {
+					case 1:
+						feature.id = ff.value
+					case 2:
+						for b := ff.data; len(b) > 0; {
+							v, n := readVarint(t, b)
+							feature.tags = append(feature.tags, v)
+							b = b[n:]
+						}
+					}
+				}
+				raw = append(raw, feature)
+			case 3:
+				keys = append(keys, string(f.data))
+			case 4:
+				for _, v := range protoFields(t, f.data) {
+					switch v.field {
+					case 1:
+						values = append(values, string(v.data))
+					case 4:
+						values = append(values, int64(v.value))
+					}
+				}
+			}
+		}
+	}
+	if len(raw) > 0 && layerName != "pois" {
+		t.Fatalf("want pois layer, got %q", layerName)
+	}
+	features := make([]mvtTestFeature, 0, len(raw))
+	for _, r := range raw {
+		f := mvtTestFeature{ID: r.id, Properties: map[string]any{}}
+		for i := 0; i+1 < len(r.tags); i += 2 {
+			f.Properties[keys[r.tags[i]]] = values[r.tags[i+1]]
+		}
+		features = append(features, f)
+	}
+	return features
+}
+
+type protoField struct {
+	field int
+	value uint64
+	data  []byte
+}
+
+func protoFields(t *testing.T, b []byte) []protoField {
+	t.Helper()
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := readVarint(t, b)
+		b = b[n:]
+		f := protoField{field: int(key >> 3)}
+		switch key & 0x7 {
+		case 0:
+			f.value, n = readVarint(t, b)
+			b = b[n:]
+		case 2:
+			size, n := readVarint(t, b)
+			f.data = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&0x7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func readVarint(t *testing.T, b []byte) (uint64, int) {
+	t.Helper()
+	var v uint64
+	for i, c := range b {
+		v |= uint64(c&0x7f) << (7 * i)
+		if c < 0x80 {
+			return v, i + 1
+		}
+	}
+	t.Fatal("truncated varint")
+	return 0, 0
+}
+
+// tilePath is the path of the poi tile of the guide at zoom z with the coordinate.
+func tilePath(guideID int64, latitude, longitude float64, z int) string {
+	n := math.Exp2(float64(z))
+	lat := latitude * math.Pi / 180
+	x := int((longitude + 180) / 360 * n)
+	y := int((1 - math.Asinh(math.Tan(lat))/math.Pi) / 2 * n)
+	return fmt.Sprintf("/guide/%d/tiles/%d/%d/%d.pbf", guideID, z, x, y)
+}
+
+func newPoiTileServer(t *testing.T) (*guide.Server, int64) {
+	t.Helper()
+	storage := openTmpStorage(t)
+	g, err := guide.NewGuide("Oaxaca", guide.WithValidStringCoordinates("17.06", "-96.72"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.CreateGuide(&g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, poi := range []struct{ name, latitude, longitude string }{
+		{"Zocalo", "17.0610", "-96.7253"},
+		{"Santo Domingo", "17.0660", "-96.7240"},
+		{"Mercado 20 de Noviembre", "17.0585", "-96.7266"},
+	} {
+		p, err := guide.NewPointOfInterest(poi.name, g.Id, guide.PoiWithValidStringCoordinates(poi.latitude, poi.longitude), guide.PoiWithCategory("sights"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.CreatePoi(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	server, err := guide.NewServer(":8080", storage, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &server, g.Id
+}
+
+func getPoiTile(t *testing.T, server *guide.Server, path, etag string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rr := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPoiTileServesPoisWithETag(t *testing.T) {
+	t.Parallel()
+	server, guideID := newPoiTileServer(t)
+	path := tilePath(guideID, 17.0610, -96.7253, 16)
+	rr := getPoiTile(t, server, path, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Header().Get("Content-Type") != "application/vnd.mapbox-vector-tile" {
+		t.Errorf("want vector tile content type, got %q", rr.Header().Get("Content-Type"))
+	}
+	features := decodePoiTile(t, rr.Body.Bytes())
+	found := false
+	for _, f := range features {
+		if f.ID == 1 {
+			found = true
+			if f.Properties["name"] != "Zocalo" || f.Properties["category"] != "sights" {
+				t.Errorf("want poi 1 name and category, got %v", f.Properties)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("want poi 1 in tile, got %+v", features)
+	}
+
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("want ETag")
+	}
+	rr = getPoiTile(t, server, path, etag)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("want status %d revalidating, got %d", http.StatusNotModified, rr.Code)
+	}
+
+	rr = getPoiTile(t, server, tilePath(guideID, 48.85, 2.35, 16), "")
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+		t.Errorf("want empty tile away from the pois, got status %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+
+	testCases := map[string]int{
+		"/guide/42/tiles/0/0/0.pbf": http.StatusNotFound,
+		"/guide/1/tiles/2/4/0.pbf":  http.StatusNotFound,
+		"/guide/1/tiles/23/0/0.pbf": http.StatusNotFound,
+	}
+	for path, want := range testCases {
+		rr := getPoiTile(t, server, path, "")
+		if rr.Code != want {
+			t.Errorf("%s: want status %d, got %d", path, want, rr.Code)
+		}
+	}
+}
+
+func TestPoiTileClustersPoisWhenZoomedOut(t *testing.T) {
+	t.Parallel()
+	server, guideID := newPoiTileServer(t)
+	rr := getPoiTile(t, server, tilePath(guideID, 17.06, -96.72, 6), "")
+	features := decodePoiTile(t, rr.Body.Bytes())
+	if len(features) != 1 || features[0].Properties["point_count"] != int64(3) {
+		t.Errorf("want the pois as one cluster of 3, got %+v", features)
+	}
+}
+
+func TestPoiTileInvalidatedWhenPoisChange(t *testing.T) {
+	t.Parallel()
+	server, guideID := newPoiTileServer(t)
+	path := tilePath(guideID, 17.0610, -96.7253, 14)
+	featureNames := func(etag string) ([]string, string) {
+		t.Helper()
+		rr := getPoiTile(t, server, path, etag)
+		if rr.Code == http.StatusNotModified {
+			return nil, etag
+		}
+		var names []string
+		for _, f := range decodePoiTile(t, rr.Body.Bytes()) {
+			names = append(names, fmt.Sprint(f.Properties["name"]))
+		}
+		return names, rr.Header().Get("ETag")
+	}
+	send := func(method, target string, form url.Values) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, req)
+		if rr.Code >= http.StatusBadRequest {
+			t.Fatalf("%s %s: want success, got %d", method, target, rr.Code)
+		}
+	}
+
+	names, etag := featureNames("")
+	if len(names) != 3 {
+		t.Fatalf("want 3 pois in tile, got %v", names)
+	}
+	send(http.MethodPost, fmt.Sprintf("/guide/%d/poi/create", guideID), url.Values{"name": {"Jardin Etnobotanico"}, "latitude": {"17.0650"}, "longitude": {"-96.7245"}})
+	names, etag = featureNames(etag)
+	if len(names) != 4 {
+		t.Errorf("want created poi in tile, got %v", names)
+	}
+	send(http.MethodPatch, fmt.Sprintf("/guide/%d/poi/4", guideID), url.Values{"name": {"Jardin Etnobotanico"}, "latitude": {"48.85"}, "longitude": {"2.35"}})
+	names, etag = featureNames(etag)
+	if len(names) != 3 {
+		t.Errorf("want moved poi out of tile, got %v", names)
+	}
+	send(http.MethodDelete, fmt.Sprintf("/guide/%d/poi/1", guideID), nil)
+	names, _ = featureNames(etag)
+	if len(names) != 2 {
+		t.Errorf("want deleted poi out of tile, got %v", names)
+	}
+}